@@ -0,0 +1,42 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+USE seata_client;
+
+-- the fence log table named by tcc.fence.log-table-name in conf/seatago.yml
+CREATE TABLE IF NOT EXISTS `tcc_fence_log_test`
+(
+    `xid`           VARCHAR(128)  NOT NULL COMMENT 'global id',
+    `branch_id`     BIGINT        NOT NULL COMMENT 'branch id',
+    `action_name`   VARCHAR(64)   NOT NULL COMMENT 'action name',
+    `status`        TINYINT       NOT NULL COMMENT 'status(tried:1;committed:2;rollbacked:3;suspended:4)',
+    `gmt_create`    DATETIME(3)   NOT NULL COMMENT 'create time',
+    `gmt_modified`  DATETIME(3)   NOT NULL COMMENT 'update time',
+    PRIMARY KEY (`xid`, `branch_id`),
+    KEY `idx_gmt_modified` (`gmt_modified`),
+    KEY `idx_status` (`status`)
+) ENGINE = InnoDB
+DEFAULT CHARSET = utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `account_tbl`
+(
+    `user_id`        VARCHAR(64)   NOT NULL COMMENT 'user id',
+    `balance`        BIGINT        NOT NULL COMMENT 'balance, including the frozen part',
+    `frozen_balance` BIGINT        NOT NULL DEFAULT 0 COMMENT 'amount frozen by tried branches',
+    PRIMARY KEY (`user_id`)
+) ENGINE = InnoDB
+DEFAULT CHARSET = utf8mb4;
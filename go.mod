@@ -6,6 +6,7 @@ require (
 	dubbo.apache.org/dubbo-go/v3 v3.1.1
 	github.com/gin-gonic/gin v1.9.1
 	github.com/go-sql-driver/mysql v1.7.0
+	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/parnurzeal/gorequest v0.2.16
 	google.golang.org/grpc v1.57.0
 	google.golang.org/protobuf v1.31.0
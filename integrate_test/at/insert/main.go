@@ -20,6 +20,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
 	"log"
 	"time"
@@ -29,6 +30,9 @@ import (
 	"seata.apache.org/seata-go/pkg/client"
 	sql2 "seata.apache.org/seata-go/pkg/datasource/sql"
 	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
+	"seata.apache.org/seata-go-samples/util/faketc"
 )
 
 type OrderTblModel struct {
@@ -41,13 +45,24 @@ type OrderTblModel struct {
 }
 
 func main() {
+	fakeTC := util.FakeTCFlag()
+	flag.Parse()
+	var tc *faketc.Server
+	if *fakeTC {
+		tc = util.StartFakeTC()
+		defer tc.Close()
+	}
 	initConfig()
 
 	// test: insert
+	var xid string
 	err := tm.WithGlobalTx(context.Background(), &tm.GtxConfig{
 		Name:    "ATSampleLocalGlobalTx",
 		Timeout: time.Second * 30,
-	}, insertData)
+	}, func(ctx context.Context) error {
+		xid = tm.GetXID(ctx)
+		return insertData(ctx)
+	})
 
 	if err != nil {
 		log.Fatalf("failed to init transaction: %v", err)
@@ -60,6 +75,10 @@ func main() {
 	if checkData(ctx) != nil {
 		panic("failed")
 	}
+	if err := util.ExpectGlobal(tc, xid, faketc.GlobalCommitted,
+		faketc.Branch{Type: faketc.BranchAT, Status: faketc.BranchPhaseTwoCommitted}); err != nil {
+		log.Fatal(err)
+	}
 
 	// wait clean undo log
 	time.Sleep(time.Second * 10)
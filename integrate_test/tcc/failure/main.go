@@ -0,0 +1,328 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+
+	"seata.apache.org/seata-go/pkg/client"
+	"seata.apache.org/seata-go/pkg/rm/tcc/fence/enum"
+	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
+)
+
+const (
+	descsTried     = "TCC failure test tried"
+	descsCommitted = "TCC failure test committed"
+)
+
+type OrderTblModel struct {
+	Id            int64  `gorm:"column:id;primaryKey"`
+	UserId        string `gorm:"column:user_id"`
+	CommodityCode string `gorm:"column:commodity_code"`
+	Count         int64  `gorm:"column:count"`
+	Money         int64  `gorm:"column:money"`
+	Descs         string `gorm:"column:descs"`
+}
+
+var (
+	sqlDB  *sql.DB
+	gormDB *gorm.DB
+)
+
+// orderAction is the order action with failures injected around the fenced
+// phases: Prepare can be delayed before its fence check, and Commit can
+// fail a number of times per order before it runs.
+type orderAction struct {
+	*util.FencedTCCAction[OrderTblModel]
+
+	mu             sync.Mutex
+	prepareDelay   map[int64]time.Duration
+	commitFailures map[int64]int
+	commitCalls    map[int64]int
+}
+
+func newOrderAction() *orderAction {
+	return &orderAction{
+		FencedTCCAction: util.NewFencedTCCAction[OrderTblModel]("FailureOrderTCCService", sqlDB, prepareOrder, commitOrder, rollbackOrder),
+		prepareDelay:    make(map[int64]time.Duration),
+		commitFailures:  make(map[int64]int),
+		commitCalls:     make(map[int64]int),
+	}
+}
+
+func (a *orderAction) Prepare(ctx context.Context, order OrderTblModel) error {
+	a.mu.Lock()
+	delay := a.prepareDelay[order.Id]
+	a.mu.Unlock()
+	if delay > 0 {
+		log.Printf("[Prepare] order id=%d sleeps %s", order.Id, delay)
+		time.Sleep(delay)
+	}
+	return a.FencedTCCAction.Prepare(ctx, order)
+}
+
+func (a *orderAction) Commit(ctx context.Context, order OrderTblModel) error {
+	a.mu.Lock()
+	a.commitCalls[order.Id]++
+	call := a.commitCalls[order.Id]
+	fail := call <= a.commitFailures[order.Id]
+	a.mu.Unlock()
+	if fail {
+		log.Printf("[Commit] order id=%d fails on call %d", order.Id, call)
+		return fmt.Errorf("injected commit failure %d of order %d", call, order.Id)
+	}
+	return a.FencedTCCAction.Commit(ctx, order)
+}
+
+func (a *orderAction) commits(id int64) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.commitCalls[id]
+}
+
+func prepareOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	order.Descs = descsTried
+	if err := util.GormTx(ctx, gormDB, tx).Table("order_tbl").Create(&order).Error; err != nil {
+		return err
+	}
+	log.Printf("[Prepare] insert order id=%d", order.Id)
+	return nil
+}
+
+func commitOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	if err := util.GormTx(ctx, gormDB, tx).
+		Table("order_tbl").
+		Where("id = ?", order.Id).
+		Update("descs", descsCommitted).Error; err != nil {
+		return err
+	}
+	log.Printf("[Commit] confirm order id=%d", order.Id)
+	return nil
+}
+
+func rollbackOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	if err := util.GormTx(ctx, gormDB, tx).
+		Table("order_tbl").
+		Where("id = ?", order.Id).
+		Delete(nil).Error; err != nil {
+		return err
+	}
+	log.Printf("[Rollback] cancel order id=%d", order.Id)
+	return nil
+}
+
+var (
+	action   *orderAction
+	orderTCC *util.TypedTCC[OrderTblModel]
+)
+
+type scenario struct {
+	name string
+	run  func(order OrderTblModel) error
+}
+
+func initDB() {
+	var err error
+	sqlDB, err = sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
+	if err != nil {
+		panic(err)
+	}
+	gormDB, err = gorm.Open(mysql.New(mysql.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		panic(err)
+	}
+}
+
+func initConfig() {
+	client.InitPath("conf/seatago.yml")
+	initDB()
+}
+
+func main() {
+	initConfig()
+
+	var err error
+	action = newOrderAction()
+	orderTCC, err = util.NewTypedTCC[OrderTblModel](action)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scenarios := []scenario{
+		{"business error after prepare", businessError},
+		{"commit retried by the TC", commitRetry},
+		{"prepare slower than the global timeout", prepareTimeout},
+	}
+	for i, s := range scenarios {
+		order := getData(int64(30001 + i))
+		if err := deleteOrder(order.Id); err != nil {
+			log.Fatalf("clean order %d: %v", order.Id, err)
+		}
+		if err := s.run(order); err != nil {
+			log.Fatalf("%s: %v", s.name, err)
+		}
+		log.Printf("%s passed", s.name)
+	}
+
+	log.Println("TCC failure integration test passed! 🎉")
+}
+
+// businessError fails the global transaction after a successful Prepare.
+// The TC must call Rollback, which deletes the order.
+func businessError(order OrderTblModel) error {
+	errBusiness := errors.New("business failed after prepare")
+	var xid string
+	err := tm.WithGlobalTx(context.Background(), &tm.GtxConfig{Name: "TCC_Failure_BusinessError"}, func(ctx context.Context) error {
+		xid = tm.GetXID(ctx)
+		if err := orderTCC.Prepare(ctx, order); err != nil {
+			return err
+		}
+		return errBusiness
+	})
+	if !errors.Is(err, errBusiness) {
+		return fmt.Errorf("global transaction returned %v, want %v", err, errBusiness)
+	}
+	if err := util.WaitFenceStatus(sqlDB, xid, enum.StatusRollbacked, 10*time.Second); err != nil {
+		return err
+	}
+	if err := expectNoOrder(order.Id); err != nil {
+		return err
+	}
+	return expectNoUndoLog(xid)
+}
+
+// commitRetry fails Commit twice. The global transaction still commits, and
+// the TC keeps retrying the branch until Commit succeeds.
+func commitRetry(order OrderTblModel) error {
+	const failures = 2
+	action.mu.Lock()
+	action.commitFailures[order.Id] = failures
+	action.mu.Unlock()
+
+	var xid string
+	err := tm.WithGlobalTx(context.Background(), &tm.GtxConfig{Name: "TCC_Failure_CommitRetry"}, func(ctx context.Context) error {
+		xid = tm.GetXID(ctx)
+		return orderTCC.Prepare(ctx, order)
+	})
+	if err != nil {
+		// The TC may report the retrying status; the branch is what counts.
+		log.Printf("commit retry: global transaction returned %v", err)
+	}
+	if err := util.WaitFenceStatus(sqlDB, xid, enum.StatusCommitted, 30*time.Second); err != nil {
+		return err
+	}
+	if calls := action.commits(order.Id); calls != failures+1 {
+		return fmt.Errorf("commit was called %d times, want %d", calls, failures+1)
+	}
+	if err := expectOrder(order.Id, descsCommitted); err != nil {
+		return err
+	}
+	return expectNoUndoLog(xid)
+}
+
+// prepareTimeout holds Prepare, before its fence check, for longer than the
+// timeout of the global transaction. The TC rolls the branch back while
+// Prepare is still waiting, so the rollback is empty and leaves a suspended
+// record, which then refuses the late Prepare: no order is written.
+func prepareTimeout(order OrderTblModel) error {
+	action.mu.Lock()
+	action.prepareDelay[order.Id] = 5 * time.Second
+	action.mu.Unlock()
+
+	var xid string
+	err := tm.WithGlobalTx(context.Background(), &tm.GtxConfig{Name: "TCC_Failure_Timeout", Timeout: time.Second}, func(ctx context.Context) error {
+		xid = tm.GetXID(ctx)
+		return orderTCC.Prepare(ctx, order)
+	})
+	if err == nil {
+		return errors.New("global transaction committed after its timeout")
+	}
+	log.Printf("prepare timeout: global transaction returned %v", err)
+	if err := util.WaitFenceStatus(sqlDB, xid, enum.StatusSuspended, 15*time.Second); err != nil {
+		return err
+	}
+	if err := expectNoOrder(order.Id); err != nil {
+		return err
+	}
+	if calls := action.commits(order.Id); calls != 0 {
+		return fmt.Errorf("commit was called %d times after the timeout", calls)
+	}
+	return expectNoUndoLog(xid)
+}
+
+func deleteOrder(id int64) error {
+	_, err := sqlDB.Exec("DELETE FROM order_tbl WHERE id = ?", id)
+	return err
+}
+
+func expectOrder(id int64, descs string) error {
+	var got string
+	if err := sqlDB.QueryRow("SELECT descs FROM order_tbl WHERE id = ?", id).Scan(&got); err != nil {
+		return fmt.Errorf("order %d: %w", id, err)
+	}
+	if got != descs {
+		return fmt.Errorf("order %d has descs %q, want %q", id, got, descs)
+	}
+	return nil
+}
+
+func expectNoOrder(id int64) error {
+	var n int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM order_tbl WHERE id = ?", id).Scan(&n); err != nil {
+		return err
+	}
+	if n != 0 {
+		return fmt.Errorf("order %d is still in order_tbl", id)
+	}
+	return nil
+}
+
+// expectNoUndoLog checks that the branch left no AT undo log: TCC branches
+// are undone by Rollback, not by undo records.
+func expectNoUndoLog(xid string) error {
+	var n int
+	if err := sqlDB.QueryRow("SELECT COUNT(*) FROM undo_log WHERE xid = ?", xid).Scan(&n); err != nil {
+		return err
+	}
+	if n != 0 {
+		return fmt.Errorf("undo_log has %d record(s) of %s, want none", n, xid)
+	}
+	return nil
+}
+
+func getData(id int64) OrderTblModel {
+	return OrderTblModel{
+		Id:            id,
+		UserId:        "NO-100004",
+		CommodityCode: "C100002",
+		Count:         1,
+		Money:         50,
+		Descs:         descsTried,
+	}
+}
@@ -0,0 +1,264 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"seata.apache.org/seata-go/pkg/client"
+	"seata.apache.org/seata-go/pkg/rm/tcc/fence/enum"
+	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/tcc/fence/service"
+	"seata.apache.org/seata-go-samples/util"
+)
+
+const (
+	initialBalance = 1000
+	amount         = 30
+)
+
+var (
+	db      *sql.DB
+	account *util.FencedTCCAction[service.FreezeParam]
+)
+
+type scenario struct {
+	name string
+	run  func(userID string) error
+}
+
+func main() {
+	client.InitPath("conf/seatago.yml")
+	db = util.GetTccMySqlDb()
+	defer db.Close()
+	account = service.NewAccountService(db)
+
+	scenarios := []scenario{
+		{"global commit", globalCommit},
+		{"duplicate commit", duplicateCommit},
+		{"duplicate rollback", duplicateRollback},
+		{"empty rollback", emptyRollback},
+		{"suspension", suspension},
+		{"insufficient balance", insufficientBalance},
+	}
+	for i, s := range scenarios {
+		userID := fmt.Sprintf("FENCE-IT-%d", i+1)
+		if err := resetAccount(userID); err != nil {
+			log.Fatalf("reset account %s: %v", userID, err)
+		}
+		if err := s.run(userID); err != nil {
+			log.Fatalf("%s: %v", s.name, err)
+		}
+		log.Printf("%s passed", s.name)
+	}
+
+	log.Println("TCC fence integration test passed! 🎉")
+}
+
+// globalCommit runs a freeze through the TC and waits for the branch commit.
+func globalCommit(userID string) error {
+	tcc, err := account.TCC()
+	if err != nil {
+		return err
+	}
+	var xid string
+	err = tm.WithGlobalTx(context.Background(), &tm.GtxConfig{Name: "TCC_Fence_Commit"}, func(ctx context.Context) error {
+		xid = tm.GetXID(ctx)
+		return tcc.Prepare(ctx, service.FreezeParam{UserID: userID, Amount: amount})
+	})
+	if err != nil {
+		return err
+	}
+	if err := util.WaitFenceStatus(db, xid, enum.StatusCommitted, 10*time.Second); err != nil {
+		return err
+	}
+	return expectAccount(userID, initialBalance-amount, 0)
+}
+
+// duplicateCommit delivers the second phase twice, as a TC retry after a
+// lost commit response would.
+func duplicateCommit(userID string) error {
+	param := service.FreezeParam{UserID: userID, Amount: amount}
+	bac := newActionContext(param)
+	if err := call(enum.FencePhasePrepare, bac, param); err != nil {
+		return err
+	}
+	if err := call(enum.FencePhaseCommit, bac, param); err != nil {
+		return err
+	}
+	// The fence answers a repeated second phase with success, so that the
+	// TC stops retrying it.
+	if err := call(enum.FencePhaseCommit, bac, param); err != nil {
+		return fmt.Errorf("duplicate commit: %w", err)
+	}
+	if err := expectStatus(bac, enum.StatusCommitted); err != nil {
+		return err
+	}
+	return expectAccount(userID, initialBalance-amount, 0)
+}
+
+// duplicateRollback delivers the rollback twice after a prepare.
+func duplicateRollback(userID string) error {
+	param := service.FreezeParam{UserID: userID, Amount: amount}
+	bac := newActionContext(param)
+	if err := call(enum.FencePhasePrepare, bac, param); err != nil {
+		return err
+	}
+	if err := call(enum.FencePhaseRollback, bac, param); err != nil {
+		return err
+	}
+	if err := call(enum.FencePhaseRollback, bac, param); err != nil {
+		return fmt.Errorf("duplicate rollback: %w", err)
+	}
+	if err := expectStatus(bac, enum.StatusRollbacked); err != nil {
+		return err
+	}
+	return expectAccount(userID, initialBalance, 0)
+}
+
+// emptyRollback rolls back a branch whose prepare never ran. Nothing may be
+// unfrozen, and the fence log records the branch as suspended.
+func emptyRollback(userID string) error {
+	param := service.FreezeParam{UserID: userID, Amount: amount}
+	bac := newActionContext(param)
+	if err := call(enum.FencePhaseRollback, bac, param); err != nil {
+		return fmt.Errorf("empty rollback must succeed so the TC stops retrying: %w", err)
+	}
+	if err := expectStatus(bac, enum.StatusSuspended); err != nil {
+		return err
+	}
+	return expectAccount(userID, initialBalance, 0)
+}
+
+// suspension lets the prepare arrive after the rollback of its branch. It
+// must not freeze anything, since no second phase will ever release it.
+func suspension(userID string) error {
+	param := service.FreezeParam{UserID: userID, Amount: amount}
+	bac := newActionContext(param)
+	if err := call(enum.FencePhaseRollback, bac, param); err != nil {
+		return err
+	}
+	if err := call(enum.FencePhasePrepare, bac, param); err == nil {
+		return errors.New("a prepare after the rollback of its branch succeeded")
+	}
+	if err := expectStatus(bac, enum.StatusSuspended); err != nil {
+		return err
+	}
+	return expectAccount(userID, initialBalance, 0)
+}
+
+// insufficientBalance fails the business update of a prepare and checks
+// that its fence record was rolled back with it.
+func insufficientBalance(userID string) error {
+	param := service.FreezeParam{UserID: userID, Amount: initialBalance + 1}
+	bac := newActionContext(param)
+	err := call(enum.FencePhasePrepare, bac, param)
+	if !errors.Is(err, service.ErrInsufficientBalance) {
+		return fmt.Errorf("prepare returned %v, want %v", err, service.ErrInsufficientBalance)
+	}
+	if status, err := fenceStatus(bac); err != sql.ErrNoRows {
+		return fmt.Errorf("fence log has status %d (%v), want no record", status, err)
+	}
+	return expectAccount(userID, initialBalance, 0)
+}
+
+var branchSeq int64
+
+// newActionContext returns the action context of a fresh branch, shaped like
+// the one the TC delivers for a Prepare of param.
+func newActionContext(param service.FreezeParam) *tm.BusinessActionContext {
+	branchSeq++
+	payload, _ := json.Marshal(param)
+	return &tm.BusinessActionContext{
+		Xid:        fmt.Sprintf("fence-it-%d", time.Now().UnixNano()),
+		BranchId:   branchSeq,
+		ActionName: account.GetActionName(),
+		ActionContext: map[string]interface{}{
+			util.TCCPayloadKey: string(payload),
+		},
+	}
+}
+
+// phaseContext prepares ctx the way the TCC proxy and the resource manager
+// do before they call a phase.
+func phaseContext(phase enum.FencePhase, bac *tm.BusinessActionContext) context.Context {
+	ctx := tm.InitSeataContext(context.Background())
+	tm.SetXID(ctx, bac.Xid)
+	tm.SetFencePhase(ctx, phase)
+	tm.SetBusinessActionContext(ctx, bac)
+	return ctx
+}
+
+// call runs one phase of the branch bac with param, which the proxy would
+// have decoded from the action context.
+func call(phase enum.FencePhase, bac *tm.BusinessActionContext, param service.FreezeParam) error {
+	ctx := phaseContext(phase, bac)
+	switch phase {
+	case enum.FencePhasePrepare:
+		return account.Prepare(ctx, param)
+	case enum.FencePhaseCommit:
+		return account.Commit(ctx, param)
+	case enum.FencePhaseRollback:
+		return account.Rollback(ctx, param)
+	}
+	return fmt.Errorf("unknown fence phase %v", phase)
+}
+
+func resetAccount(userID string) error {
+	_, err := db.Exec("INSERT INTO account_tbl (user_id, balance, frozen_balance) VALUES (?, ?, 0) "+
+		"ON DUPLICATE KEY UPDATE balance = VALUES(balance), frozen_balance = 0", userID, initialBalance)
+	return err
+}
+
+func expectAccount(userID string, balance, frozen int64) error {
+	var gotBalance, gotFrozen int64
+	if err := db.QueryRow("SELECT balance, frozen_balance FROM account_tbl WHERE user_id = ?", userID).Scan(&gotBalance, &gotFrozen); err != nil {
+		return err
+	}
+	if gotBalance != balance || gotFrozen != frozen {
+		return fmt.Errorf("account %s has balance=%d frozen_balance=%d, want balance=%d frozen_balance=%d",
+			userID, gotBalance, gotFrozen, balance, frozen)
+	}
+	return nil
+}
+
+func fenceStatus(bac *tm.BusinessActionContext) (enum.FenceStatus, error) {
+	var status enum.FenceStatus
+	err := db.QueryRow("SELECT status FROM "+util.FenceLogTable+" WHERE xid = ? AND branch_id = ?", bac.Xid, bac.BranchId).Scan(&status)
+	return status, err
+}
+
+func expectStatus(bac *tm.BusinessActionContext, want enum.FenceStatus) error {
+	status, err := fenceStatus(bac)
+	if err != nil {
+		return fmt.Errorf("fence log of %s/%d: %w", bac.Xid, bac.BranchId, err)
+	}
+	if status != want {
+		return fmt.Errorf("fence log of %s/%d has status %d, want %d", bac.Xid, bac.BranchId, status, want)
+	}
+	return nil
+}
@@ -21,14 +21,17 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"flag"
 	"log"
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 
 	"seata.apache.org/seata-go/pkg/client"
-	"seata.apache.org/seata-go/pkg/rm/tcc"
 	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
+	"seata.apache.org/seata-go-samples/util/faketc"
 )
 
 type OrderTblModel struct {
@@ -40,41 +43,44 @@ type OrderTblModel struct {
 	Descs         string `gorm:"column:descs"`
 }
 
-var gormDB *gorm.DB
-
-type OrderTCCService struct{}
+var (
+	sqlDB  *sql.DB
+	gormDB *gorm.DB
+)
 
-func (o *OrderTCCService) GetActionName() string {
-	return "OrderTCCService"
+func newOrderTCCService() *util.FencedTCCAction[OrderTblModel] {
+	return util.NewFencedTCCAction[OrderTblModel]("OrderTCCService", sqlDB, prepareOrder, commitOrder, rollbackOrder)
 }
 
-func (o *OrderTCCService) Prepare(ctx context.Context, params interface{}) (bool, error) {
-	order := params.(OrderTblModel)
-	if err := gormDB.WithContext(ctx).Table("order_tbl").Create(&order).Error; err != nil {
-		return false, err
+func prepareOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	if err := util.GormTx(ctx, gormDB, tx).Table("order_tbl").Create(&order).Error; err != nil {
+		return err
 	}
 	log.Printf("[Prepare] insert order %+v", order)
-	return true, nil
+	return nil
 }
 
-func (o *OrderTCCService) Commit(ctx context.Context, bac *tm.BusinessActionContext) (bool, error) {
-	log.Printf("[Commit] confirm order")
-	return true, nil
+func commitOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	log.Printf("[Commit] confirm order id=%d", order.Id)
+	return nil
 }
 
-func (o *OrderTCCService) Rollback(ctx context.Context, bac *tm.BusinessActionContext) (bool, error) {
-	if err := gormDB.WithContext(ctx).
+// rollbackOrder deletes the order Prepare inserted, which TypedTCC hands
+// back from the action context.
+func rollbackOrder(ctx context.Context, tx *sql.Tx, order OrderTblModel) error {
+	if err := util.GormTx(ctx, gormDB, tx).
 		Table("order_tbl").
-		Where("user_id = ? AND commodity_code = ?", "U10001", "C10001").
+		Where("id = ?", order.Id).
 		Delete(nil).Error; err != nil {
-		return false, err
+		return err
 	}
-	log.Printf("[Rollback] cancel order")
-	return true, nil
+	log.Printf("[Rollback] cancel order id=%d", order.Id)
+	return nil
 }
 
 func initDB() {
-	sqlDB, err := sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
+	var err error
+	sqlDB, err = sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
 	if err != nil {
 		panic(err)
 	}
@@ -90,10 +96,17 @@ func initConfig() {
 }
 
 func main() {
+	fakeTC := util.FakeTCFlag()
+	flag.Parse()
+	var tc *faketc.Server
+	if *fakeTC {
+		tc = util.StartFakeTC()
+		defer tc.Close()
+	}
 	initConfig()
 	ctx := context.Background()
 
-	tccServiceProxy, err := tcc.NewTCCServiceProxy(&OrderTCCService{})
+	orderTCC, err := newOrderTCCService().TCC()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -101,19 +114,18 @@ func main() {
 	// ---------------- Insert ----------------
 	order := getData()
 
+	var xid string
 	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{Name: "TCC_Insert"}, func(txCtx context.Context) error {
-		ok, err := tccServiceProxy.Prepare(txCtx, order)
-		if err != nil {
-			return err
-		}
-		if okBool, ok := ok.(bool); !ok || !okBool {
-			return errors.New("prepare insert failed")
-		}
-		return nil
+		xid = tm.GetXID(txCtx)
+		return orderTCC.Prepare(txCtx, order)
 	})
 	if err != nil {
 		log.Fatalf("insert transaction failed: %v", err)
 	}
+	if err := util.ExpectGlobal(tc, xid, faketc.GlobalCommitted,
+		faketc.Branch{Type: faketc.BranchTCC, Status: faketc.BranchPhaseTwoCommitted}); err != nil {
+		log.Fatal(err)
+	}
 	log.Println("Insert success")
 
 	// ---------------- Read ----------------
@@ -158,6 +170,32 @@ func main() {
 	}
 	log.Println("Delete success")
 
+	// ---------------- Rollback ----------------
+	aborted := getData()
+	aborted.Id = 20002
+	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{Name: "TCC_Rollback"}, func(txCtx context.Context) error {
+		xid = tm.GetXID(txCtx)
+		if err := orderTCC.Prepare(txCtx, aborted); err != nil {
+			return err
+		}
+		return errors.New("abort after prepare")
+	})
+	if err == nil {
+		log.Fatal("rollback transaction committed")
+	}
+	var left int64
+	if err := gormDB.WithContext(ctx).Table("order_tbl").Where("id = ?", aborted.Id).Count(&left).Error; err != nil {
+		log.Fatal(err)
+	}
+	if left != 0 {
+		log.Fatalf("order %d is still there after the rollback", aborted.Id)
+	}
+	if err := util.ExpectGlobal(tc, xid, faketc.GlobalRollbacked,
+		faketc.Branch{Type: faketc.BranchTCC, Status: faketc.BranchPhaseTwoRollbacked}); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Rollback success")
+
 	log.Println("TCC CRUD integration test passed! 🎉")
 
 }
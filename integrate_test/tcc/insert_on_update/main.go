@@ -21,6 +21,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
 
 	"gorm.io/driver/mysql"
@@ -28,8 +29,9 @@ import (
 	"gorm.io/gorm/clause"
 
 	"seata.apache.org/seata-go/pkg/client"
-	"seata.apache.org/seata-go/pkg/rm/tcc"
 	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
 )
 
 type OrderTblModel struct {
@@ -41,52 +43,92 @@ type OrderTblModel struct {
 	Descs         string `gorm:"column:descs"`
 }
 
-var gormDB *gorm.DB
+var (
+	sqlDB  *sql.DB
+	gormDB *gorm.DB
+)
+
+// UpsertOrder is the Prepare param of the insert on update. PreviousDescs is
+// the descs of the row Prepare updates, or nil when Prepare inserts it, so
+// that Rollback undoes exactly what Prepare did.
+type UpsertOrder struct {
+	Order         OrderTblModel `json:"order"`
+	PreviousDescs *string       `json:"previousDescs"`
+}
+
+func newTCCInsertOnUpdateService() *util.FencedTCCAction[UpsertOrder] {
+	return util.NewFencedTCCAction[UpsertOrder]("TCCInsertOnUpdateService", sqlDB, prepareInsertOnUpdate, commitInsertOnUpdate, rollbackInsertOnUpdate)
+}
 
-type TCCInsertOnUpdateService struct{}
+// newUpsertOrder records the current descs of order's row in the param.
+func newUpsertOrder(ctx context.Context, order OrderTblModel) (UpsertOrder, error) {
+	descs, err := currentDescs(gormDB.WithContext(ctx), order.Id)
+	return UpsertOrder{Order: order, PreviousDescs: descs}, err
+}
+
+func currentDescs(db *gorm.DB, id int64) (*string, error) {
+	var rows []OrderTblModel
+	if err := db.Table("order_tbl").Where("id = ?", id).Limit(1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	return &rows[0].Descs, nil
+}
 
-func (t *TCCInsertOnUpdateService) Prepare(ctx context.Context, params interface{}) (bool, error) {
-	order := params.(OrderTblModel)
+func prepareInsertOnUpdate(ctx context.Context, tx *sql.Tx, param UpsertOrder) error {
+	// The row must still be as the param recorded it, otherwise Rollback
+	// would restore the wrong state.
+	db := util.GormTx(ctx, gormDB, tx)
+	descs, err := currentDescs(db.Clauses(clause.Locking{Strength: "UPDATE"}), param.Order.Id)
+	if err != nil {
+		return err
+	}
+	if (descs == nil) != (param.PreviousDescs == nil) || (descs != nil && *descs != *param.PreviousDescs) {
+		return fmt.Errorf("order %d changed since the upsert was prepared", param.Order.Id)
+	}
 
 	// Insert on update operation using GORM
-	err := gormDB.WithContext(ctx).Table("order_tbl").Clauses(clause.OnConflict{
+	order := param.Order
+	err = db.Table("order_tbl").Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "id"}}, // by primary key
 		DoUpdates: clause.Assignments(map[string]interface{}{"descs": order.Descs}),
 	}).Create(&order).Error
 
 	if err != nil {
-		return false, err
+		return err
 	}
 	log.Printf("[Prepare] insert on update order %+v", order)
-	return true, nil
+	return nil
 }
 
-func (t *TCCInsertOnUpdateService) Commit(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
-	log.Printf("[Commit] confirm insert on update order")
-	return true, nil
+func commitInsertOnUpdate(ctx context.Context, tx *sql.Tx, param UpsertOrder) error {
+	log.Printf("[Commit] confirm insert on update order id=%d", param.Order.Id)
+	return nil
 }
 
-func (t *TCCInsertOnUpdateService) Rollback(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
-	log.Printf("[Rollback] cancel insert on update")
-
-	// Delete the record that was inserted/updated in Prepare phase
-	// Using the same ID that was used in the test
-	if err := gormDB.WithContext(ctx).
-		Table("order_tbl").
-		Where("id = ?", 1). // The test uses ID=1
-		Delete(nil).Error; err != nil {
-		return false, err
+// rollbackInsertOnUpdate deletes the row Prepare inserted, or restores the
+// descs of the row it updated.
+func rollbackInsertOnUpdate(ctx context.Context, tx *sql.Tx, param UpsertOrder) error {
+	db := util.GormTx(ctx, gormDB, tx).Table("order_tbl").Where("id = ?", param.Order.Id)
+	if param.PreviousDescs == nil {
+		if err := db.Delete(nil).Error; err != nil {
+			return err
+		}
+		log.Printf("[Rollback] deleted order with id=%d", param.Order.Id)
+		return nil
 	}
-	log.Printf("[Rollback] deleted order with id=1")
-	return true, nil
-}
-
-func (t *TCCInsertOnUpdateService) GetActionName() string {
-	return "TCCInsertOnUpdateService"
+	if err := db.Update("descs", *param.PreviousDescs).Error; err != nil {
+		return err
+	}
+	log.Printf("[Rollback] restored descs of order id=%d", param.Order.Id)
+	return nil
 }
 
 func initDB() {
-	sqlDB, err := sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
+	var err error
+	sqlDB, err = sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
 	if err != nil {
 		panic(err)
 	}
@@ -105,23 +147,20 @@ func main() {
 	initConfig()
 	ctx := context.Background()
 
-	tccServiceProxy, err := tcc.NewTCCServiceProxy(&TCCInsertOnUpdateService{})
+	insertOnUpdateTCC, err := newTCCInsertOnUpdateService().TCC()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// ---------------- Insert On Update ----------------
 	order := getData()
+	param, err := newUpsertOrder(ctx, order)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{Name: "TCC_InsertOnUpdate"}, func(txCtx context.Context) error {
-		ok, err := tccServiceProxy.Prepare(txCtx, order)
-		if err != nil {
-			return err
-		}
-		if okBool, ok := ok.(bool); !ok || !okBool {
-			return errors.New("prepare insert on update failed")
-		}
-		return nil
+		return insertOnUpdateTCC.Prepare(txCtx, param)
 	})
 	if err != nil {
 		log.Fatalf("insert on update transaction failed: %v", err)
@@ -138,6 +177,36 @@ func main() {
 	}
 	log.Printf("Verify success Found: %+v", result)
 
+	// ---------------- Rollback Update ----------------
+	// Rolling back an upsert that updated the row restores its descs and
+	// keeps the row.
+	changed := result
+	changed.Descs = "TCC insert on update rollback"
+	param, err = newUpsertOrder(ctx, changed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{Name: "TCC_InsertOnUpdate_Rollback"}, func(txCtx context.Context) error {
+		if err := insertOnUpdateTCC.Prepare(txCtx, param); err != nil {
+			return err
+		}
+		return errors.New("abort after prepare")
+	})
+	if err == nil {
+		log.Fatal("rollback transaction committed")
+	}
+	var restored OrderTblModel
+	if err := gormDB.WithContext(ctx).
+		Table("order_tbl").
+		Where("id = ?", order.Id).
+		First(&restored).Error; err != nil {
+		log.Fatalf("order %d is gone after the rollback: %v", order.Id, err)
+	}
+	if restored.Descs != result.Descs {
+		log.Fatalf("rollback left descs %q, want %q", restored.Descs, result.Descs)
+	}
+	log.Println("Rollback update success")
+
 	log.Println("TCC insert on update integration test passed! 🎉")
 }
 
@@ -20,7 +20,6 @@ package main
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"log"
 
 	"gorm.io/driver/mysql"
@@ -28,8 +27,9 @@ import (
 	"gorm.io/gorm/clause"
 
 	"seata.apache.org/seata-go/pkg/client"
-	"seata.apache.org/seata-go/pkg/rm/tcc"
 	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
 )
 
 type OrderTblModel struct {
@@ -41,47 +41,51 @@ type OrderTblModel struct {
 	Descs         string `gorm:"column:descs"`
 }
 
-var gormDB *gorm.DB
+// OrderQuery selects the order locked by Prepare.
+type OrderQuery struct {
+	UserId        string
+	CommodityCode string
+}
 
-type TCCSelectForUpdateService struct{}
+var (
+	sqlDB  *sql.DB
+	gormDB *gorm.DB
+)
 
-func (t *TCCSelectForUpdateService) Prepare(ctx context.Context, params interface{}) (bool, error) {
-	queryParams := params.(map[string]interface{})
-	userId := queryParams["userId"].(string)
-	commodityCode := queryParams["commodityCode"].(string)
+func newTCCSelectForUpdateService() *util.FencedTCCAction[OrderQuery] {
+	return util.NewFencedTCCAction[OrderQuery]("TCCSelectForUpdateService", sqlDB, prepareSelectForUpdate, commitSelectForUpdate, rollbackSelectForUpdate)
+}
 
+func prepareSelectForUpdate(ctx context.Context, tx *sql.Tx, query OrderQuery) error {
 	// Select for update operation using GORM
 	var order OrderTblModel
-	err := gormDB.WithContext(ctx).Table("order_tbl").
-		Where("user_id = ? AND commodity_code = ?", userId, commodityCode).
+	err := util.GormTx(ctx, gormDB, tx).Table("order_tbl").
+		Where("user_id = ? AND commodity_code = ?", query.UserId, query.CommodityCode).
 		Clauses(clause.Locking{Strength: "UPDATE"}).
 		First(&order).Error
 
 	if err != nil {
-		return false, err
+		return err
 	}
 	log.Printf("[Prepare] select for update found order %+v", order)
-	return true, nil
+	return nil
 }
 
-func (t *TCCSelectForUpdateService) Commit(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
+func commitSelectForUpdate(ctx context.Context, tx *sql.Tx, query OrderQuery) error {
 	log.Printf("[Commit] confirm select for update")
-	return true, nil
+	return nil
 }
 
-func (t *TCCSelectForUpdateService) Rollback(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
+func rollbackSelectForUpdate(ctx context.Context, tx *sql.Tx, query OrderQuery) error {
 	log.Printf("[Rollback] cancel select for update")
 	// Select for update doesn't modify data, just releases the lock
 	// The database will automatically release the lock when transaction ends
-	return true, nil
-}
-
-func (t *TCCSelectForUpdateService) GetActionName() string {
-	return "TCCSelectForUpdateService"
+	return nil
 }
 
 func initDB() {
-	sqlDB, err := sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
+	var err error
+	sqlDB, err = sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client?parseTime=true")
 	if err != nil {
 		panic(err)
 	}
@@ -100,23 +104,16 @@ func main() {
 	initConfig()
 	ctx := context.Background()
 
-	tccServiceProxy, err := tcc.NewTCCServiceProxy(&TCCSelectForUpdateService{})
+	selectForUpdateTCC, err := newTCCSelectForUpdateService().TCC()
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	// ---------------- Select For Update ----------------
-	queryParams := getData()
+	query := getData()
 
 	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{Name: "TCC_SelectForUpdate"}, func(txCtx context.Context) error {
-		ok, err := tccServiceProxy.Prepare(txCtx, queryParams)
-		if err != nil {
-			return err
-		}
-		if okBool, ok := ok.(bool); !ok || !okBool {
-			return errors.New("prepare select for update failed")
-		}
-		return nil
+		return selectForUpdateTCC.Prepare(txCtx, query)
 	})
 	if err != nil {
 		log.Fatalf("select for update transaction failed: %v", err)
@@ -126,9 +123,9 @@ func main() {
 	log.Println("TCC select for update integration test passed! 🎉")
 }
 
-func getData() map[string]interface{} {
-	return map[string]interface{}{
-		"userId":        "NO-100001",
-		"commodityCode": "C100000",
+func getData() OrderQuery {
+	return OrderQuery{
+		UserId:        "NO-100001",
+		CommodityCode: "C100000",
 	}
 }
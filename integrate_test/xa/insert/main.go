@@ -0,0 +1,141 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"seata.apache.org/seata-go/pkg/client"
+	"seata.apache.org/seata-go/pkg/tm"
+
+	"seata.apache.org/seata-go-samples/util"
+	"seata.apache.org/seata-go-samples/util/faketc"
+)
+
+const (
+	userID        = "NO-XA-INSERT"
+	committedCode = "C-XA-COMMIT"
+	rollbackCode  = "C-XA-ROLLBACK"
+)
+
+var (
+	// xaDB runs statements in XA branches of the global transaction in
+	// their context, checkDB reads the outcome outside of any.
+	xaDB    *sql.DB
+	checkDB *sql.DB
+)
+
+func main() {
+	fakeTC := util.FakeTCFlag()
+	flag.Parse()
+	var tc *faketc.Server
+	if *fakeTC {
+		tc = util.StartFakeTC()
+		defer tc.Close()
+	}
+	initConfig()
+	ctx := context.Background()
+	if _, err := checkDB.ExecContext(ctx, "DELETE FROM order_tbl WHERE user_id = ?", userID); err != nil {
+		log.Fatal(err)
+	}
+
+	// ---------------- Commit ----------------
+	var xid string
+	err := tm.WithGlobalTx(ctx, &tm.GtxConfig{
+		Name:    "XA_Insert",
+		Timeout: time.Second * 30,
+	}, func(txCtx context.Context) error {
+		xid = tm.GetXID(txCtx)
+		return insertOrder(txCtx, committedCode)
+	})
+	if err != nil {
+		log.Fatalf("insert transaction failed: %v", err)
+	}
+	if err := expectOrders(ctx, committedCode, 1); err != nil {
+		log.Fatal(err)
+	}
+	if err := util.ExpectGlobal(tc, xid, faketc.GlobalCommitted,
+		faketc.Branch{Type: faketc.BranchXA, Status: faketc.BranchPhaseTwoCommitted}); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Commit success")
+
+	// ---------------- Rollback ----------------
+	err = tm.WithGlobalTx(ctx, &tm.GtxConfig{
+		Name:    "XA_Insert_Rollback",
+		Timeout: time.Second * 30,
+	}, func(txCtx context.Context) error {
+		xid = tm.GetXID(txCtx)
+		if err := insertOrder(txCtx, rollbackCode); err != nil {
+			return err
+		}
+		return errors.New("abort after insert")
+	})
+	if err == nil {
+		log.Fatal("rollback transaction committed")
+	}
+	if err := expectOrders(ctx, rollbackCode, 0); err != nil {
+		log.Fatal(err)
+	}
+	if err := util.ExpectGlobal(tc, xid, faketc.GlobalRollbacked,
+		faketc.Branch{Type: faketc.BranchXA, Status: faketc.BranchPhaseTwoRollbacked}); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Rollback success")
+
+	if _, err := checkDB.ExecContext(ctx, "DELETE FROM order_tbl WHERE user_id = ?", userID); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func initConfig() {
+	client.InitPath("./conf/seatago.yml")
+	xaDB = util.GetXAMySqlDb()
+	var err error
+	checkDB, err = sql.Open("mysql", "root:12345678@tcp(127.0.0.1:3306)/seata_client")
+	if err != nil {
+		panic(err)
+	}
+}
+
+func insertOrder(ctx context.Context, commodityCode string) error {
+	_, err := xaDB.ExecContext(ctx,
+		"INSERT INTO order_tbl (user_id, commodity_code, count, money, descs) VALUES (?, ?, ?, ?, ?)",
+		userID, commodityCode, 1, 10, "xa insert desc")
+	return err
+}
+
+func expectOrders(ctx context.Context, commodityCode string, want int) error {
+	var count int
+	if err := checkDB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM order_tbl WHERE user_id = ? AND commodity_code = ?",
+		userID, commodityCode).Scan(&count); err != nil {
+		return err
+	}
+	if count != want {
+		return fmt.Errorf("found %d %s orders, want %d", count, commodityCode, want)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// Service names the actions are registered under, as referenced by the
+// ServiceName of the states in statelang/*.json.
+const (
+	inventoryService = "inventoryAction"
+	balanceService   = "balanceAction"
+)
+
+// tracer prints a line for every action call when it is true. The load
+// runner turns it off.
+type tracer bool
+
+func (t tracer) printf(format string, args ...any) {
+	if t {
+		fmt.Printf(format, args...)
+	}
+}
+
+// CrashExitCode is the status a process exits with when an injected crash
+// fires.
+const CrashExitCode = 3
+
+// Crash makes the process exit, as if it had been killed, when the engine
+// invokes one service method. Nothing is written before the exit, so the
+// state that invoked it stays running in the Saga store. A nil *Crash never
+// fires.
+type Crash struct {
+	Service string
+	Method  string
+}
+
+// CrashBefore builds the crash for the service method state invokes.
+func CrashBefore(def *statelang.StateMachine, state string) (*Crash, error) {
+	s := def.State(state)
+	if s == nil {
+		return nil, fmt.Errorf("state %s is not declared in %s", state, def.Name)
+	}
+	if s.ServiceName == "" || s.ServiceMethod == "" {
+		return nil, fmt.Errorf("state %s does not invoke a service", state)
+	}
+	return &Crash{Service: s.ServiceName, Method: s.ServiceMethod}, nil
+}
+
+func (c *Crash) before(service, method string) {
+	if c == nil || c.Service != service || c.Method != method {
+		return
+	}
+	fmt.Printf("CRASH before %s.%s, exiting with status %d\n", service, method, CrashExitCode)
+	os.Exit(CrashExitCode)
+}
+
+// InventoryAction (DB-backed) implements reduce/compensate with explicit params
+type InventoryAction struct {
+	db    *sql.DB
+	crash *Crash
+	trace tracer
+}
+
+func NewInventoryAction(db *sql.DB, crash *Crash, trace bool) *InventoryAction {
+	return &InventoryAction{db: db, crash: crash, trace: tracer(trace)}
+}
+
+// Reduce(businessKey, productId, count) -> (bool, error)
+func (a *InventoryAction) Reduce(businessKey string, productId string, count int) (bool, error) {
+	a.crash.before(inventoryService, "Reduce")
+	if count <= 0 {
+		count = 1
+	}
+	res, err := a.db.Exec("UPDATE e2e_inventory SET stock = stock - ? WHERE product_id = ? AND stock >= ?", count, productId, count)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, fmt.Errorf("INVENTORY_NOT_ENOUGH")
+	}
+	a.trace.printf("InventoryAction.Reduce: biz=%s, product=%s, count=%d\n", businessKey, productId, count)
+	return true, nil
+}
+
+func (a *InventoryAction) CompensateReduce(businessKey string, productId string, count int) (bool, error) {
+	a.crash.before(inventoryService, "CompensateReduce")
+	if count <= 0 {
+		count = 1
+	}
+	if _, err := a.db.Exec("UPDATE e2e_inventory SET stock = stock + ? WHERE product_id = ?", count, productId); err != nil {
+		return false, err
+	}
+	a.trace.printf("InventoryAction.CompensateReduce: biz=%s, product=%s, count=%d\n", businessKey, productId, count)
+	return true, nil
+}
+
+// BalanceAction (DB-backed) implements reduce/compensate with explicit params
+type BalanceAction struct {
+	db    *sql.DB
+	crash *Crash
+	trace tracer
+}
+
+func NewBalanceAction(db *sql.DB, crash *Crash, trace bool) *BalanceAction {
+	return &BalanceAction{db: db, crash: crash, trace: tracer(trace)}
+}
+
+// Reduce(businessKey, userId, amount) -> (bool, error)
+func (b *BalanceAction) Reduce(businessKey string, userId string, amount int) (bool, error) {
+	b.crash.before(balanceService, "Reduce")
+	if amount <= 0 {
+		amount = 1
+	}
+	res, err := b.db.Exec("UPDATE e2e_balance SET amount = amount - ? WHERE user_id = ? AND amount >= ?", amount, userId, amount)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, fmt.Errorf("BALANCE_NOT_ENOUGH")
+	}
+	b.trace.printf("BalanceAction.Reduce: biz=%s, user=%s, amount=%d\n", businessKey, userId, amount)
+	return true, nil
+}
+
+func (b *BalanceAction) CompensateReduce(businessKey string, userId string, amount int) (bool, error) {
+	b.crash.before(balanceService, "CompensateReduce")
+	if amount <= 0 {
+		amount = 1
+	}
+	if _, err := b.db.Exec("UPDATE e2e_balance SET amount = amount + ? WHERE user_id = ?", amount, userId); err != nil {
+		return false, err
+	}
+	b.trace.printf("BalanceAction.CompensateReduce: biz=%s, user=%s, amount=%d\n", businessKey, userId, amount)
+	return true, nil
+}
@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go/pkg/client"
+	engcfg "seata.apache.org/seata-go/pkg/saga/statemachine/engine/config"
+	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/core"
+	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/invoker"
+)
+
+// StatelangGlob locates the state machines of the e2e sample, relative to
+// the repository root.
+const StatelangGlob = "saga/e2e/statelang/*.json"
+
+// SQLiteSchema is the Saga store schema applied to a SQLite store, relative
+// to the repository root.
+const SQLiteSchema = "saga/e2e/sql/sqlite_saga_schema.sql"
+
+// NewEngine initializes the seata-go client, builds the Saga engine from
+// engineConf with the state machines in StatelangGlob, and registers the
+// DB-backed actions, which print every call when trace is set. crash may be
+// nil.
+func NewEngine(seataConf, engineConf string, db *sql.DB, crash *Crash, trace bool) (*core.ProcessCtrlStateMachineEngine, error) {
+	client.InitPath(seataConf)
+	if err := checkSeataConnectivity(seataConf); err != nil {
+		return nil, fmt.Errorf("seata server connectivity check failed: %w", err)
+	}
+
+	eng, err := core.NewProcessCtrlStateMachineEngine()
+	if err != nil {
+		return nil, fmt.Errorf("create state machine engine failed: %w", err)
+	}
+	cfgIface := eng.GetStateMachineConfig()
+	cfg, ok := cfgIface.(*engcfg.DefaultStateMachineConfig)
+	if !ok {
+		return nil, fmt.Errorf("unexpected state machine config type: %T", cfgIface)
+	}
+	if err := cfg.LoadConfig(engineConf); err != nil {
+		return nil, fmt.Errorf("load engine config failed: %w", err)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		absPattern := filepath.Join(wd, StatelangGlob)
+		_ = cfg.RegisterStateMachineDef([]string{absPattern})
+	}
+	if err := cfg.Init(); err != nil {
+		return nil, fmt.Errorf("init engine config failed: %w", err)
+	}
+
+	// Register local services (DB-backed)
+	if lv := cfgIface.ServiceInvokerManager().ServiceInvoker("local"); lv != nil {
+		if lsi, ok := lv.(*invoker.LocalServiceInvoker); ok {
+			lsi.RegisterService(inventoryService, NewInventoryAction(db, crash, trace))
+			lsi.RegisterService(balanceService, NewBalanceAction(db, crash, trace))
+		}
+	}
+	return eng, nil
+}
+
+// OpenBusinessDB opens the database of the engine store, which also holds
+// the business tables, and returns it with its driver name. A SQLite store
+// has no container to initialize it, so SQLiteSchema is applied here.
+func OpenBusinessDB(engineConf string) (*sql.DB, string, error) {
+	cfg, err := sagastore.LoadEngineConf(engineConf)
+	if err != nil {
+		return nil, "", err
+	}
+	db, err := cfg.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.Driver() == sagastore.SQLite {
+		schema, err := os.ReadFile(SQLiteSchema)
+		if err == nil {
+			_, err = db.Exec(string(schema))
+		}
+		if err != nil {
+			db.Close()
+			return nil, "", fmt.Errorf("apply %s: %w", SQLiteSchema, err)
+		}
+	}
+	return db, cfg.Driver(), nil
+}
+
+// OperationTimeout is the engine's trans_operation_timeout: how long after
+// its last update the engine still treats a running instance as live and
+// refuses to operate on it.
+func OperationTimeout(engineConf string) (time.Duration, error) {
+	raw, err := os.ReadFile(engineConf)
+	if err != nil {
+		return 0, err
+	}
+	var cfg struct {
+		TransOperationTimeout int `yaml:"trans_operation_timeout"`
+	}
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return 0, err
+	}
+	return time.Duration(cfg.TransOperationTimeout) * time.Millisecond, nil
+}
+
+// SeataAddr returns the first TC address of service.grouplist in
+// seatago.yaml.
+func SeataAddr(seataConf string) (string, error) {
+	raw, err := os.ReadFile(seataConf)
+	if err != nil {
+		return "", err
+	}
+	type seataYaml struct {
+		Seata struct {
+			Service struct {
+				GroupList map[string]string `yaml:"grouplist"`
+			} `yaml:"service"`
+		} `yaml:"seata"`
+	}
+	var cfg seataYaml
+	if err := yaml.Unmarshal(raw, &cfg); err != nil {
+		return "", err
+	}
+	for _, addr := range cfg.Seata.Service.GroupList {
+		target := addr
+		// allow multiple via ","
+		if strings.Contains(addr, ",") {
+			parts := strings.Split(addr, ",")
+			target = strings.TrimSpace(parts[0])
+		}
+		if target != "" {
+			return target, nil
+		}
+	}
+	return "", fmt.Errorf("no seata service.grouplist address found in %s", seataConf)
+}
+
+// checkSeataConnectivity dials the TC address of seatago.yaml
+func checkSeataConnectivity(seataConf string) error {
+	target, err := SeataAddr(seataConf)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("tcp", target, 2_000_000_000)
+	if err != nil {
+		return fmt.Errorf("dial %s failed: %w", target, err)
+	}
+	_ = conn.Close()
+	return nil
+}
+
+// EnsureBusinessTables creates the business tables the scenarios seed and check
+func EnsureBusinessTables(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS e2e_inventory (
+  product_id VARCHAR(64) PRIMARY KEY,
+  stock INT NOT NULL
+)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS e2e_balance (
+  user_id VARCHAR(64) PRIMARY KEY,
+  amount INT NOT NULL
+)`)
+	return err
+}
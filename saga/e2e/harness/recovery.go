@@ -0,0 +1,88 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package harness
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/e2e/scenario"
+	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/core"
+)
+
+// Recover resumes xid through the engine: scenario.Forward re-runs the state
+// that did not finish and continues, scenario.Compensate undoes the committed
+// states, and scenario.SkipAndForward treats the unfinished state as done and
+// continues after it. The engine refuses to touch an instance it still
+// considers running until trans_operation_timeout has passed since its last
+// update, so that refusal is retried every interval until ctx ends. Any
+// other error, such as an unknown xid or an instance that already finished,
+// is returned at once.
+func Recover(ctx context.Context, eng *core.ProcessCtrlStateMachineEngine, op, xid string, interval time.Duration) error {
+	call, err := recoveryCall(eng, op)
+	if err != nil {
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		err := call(ctx, xid)
+		if err == nil {
+			return nil
+		}
+		if !stillRunning(err) {
+			return fmt.Errorf("%s %s: %w", op, xid, err)
+		}
+		fmt.Printf("RECOVER %s %s attempt %d refused: %v\n", op, xid, attempt, err)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s %s: %w (last error: %v)", op, xid, ctx.Err(), err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// stillRunning reports whether err is the engine refusing an operation on
+// an instance it still considers running, "StateMachineInstance [id:...] is
+// running, operation[...] denied". A refusal for any other status, e.g. an
+// instance that succeeded, also ends in "denied" but is final.
+func stillRunning(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "is running") && strings.Contains(msg, "denied")
+}
+
+func recoveryCall(eng *core.ProcessCtrlStateMachineEngine, op string) (func(ctx context.Context, xid string) error, error) {
+	switch op {
+	case scenario.Forward:
+		return func(ctx context.Context, xid string) error {
+			_, err := eng.Forward(ctx, xid, nil)
+			return err
+		}, nil
+	case scenario.Compensate:
+		return func(ctx context.Context, xid string) error {
+			_, err := eng.Compensate(ctx, xid, nil)
+			return err
+		}, nil
+	case scenario.SkipAndForward:
+		return func(ctx context.Context, xid string) error {
+			_, err := eng.SkipAndForward(ctx, xid, nil)
+			return err
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown recovery operation %q, want one of %s", op, strings.Join(scenario.RecoveryOps, ", "))
+}
@@ -0,0 +1,285 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// load runs many ReduceInventoryAndBalance sagas concurrently against a
+// small set of contended product and user rows, reports throughput,
+// latency percentiles and outcomes, and checks at the end that no stock or
+// balance was lost or created: what is left plus what the succeeded sagas
+// took must equal what was seeded.
+//
+//	go run ./saga/e2e/load -n 500 -concurrency 32 -compensate 0.3 -products 2 -users 2
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+
+	"seata.apache.org/seata-go-samples/saga/e2e/harness"
+	"seata.apache.org/seata-go-samples/saga/e2e/scenario"
+	"seata.apache.org/seata-go-samples/saga/invariant"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+	"seata.apache.org/seata-go-samples/util/faketc"
+)
+
+const stateMachine = "ReduceInventoryAndBalance"
+
+type options struct {
+	total       int
+	concurrency int
+	compensate  float64
+	products    int
+	users       int
+	stock       int
+	balance     int
+	count       int
+	amount      int
+	timeout     time.Duration
+	seed        int64
+}
+
+// job is one saga of the run. A compensate job asks for more than any
+// user was seeded with, so ReduceBalance always fails and
+// ReduceInventory is compensated.
+type job struct {
+	index       int
+	businessKey string
+	productID   string
+	userID      string
+	count       int
+	amount      int
+	compensate  bool
+}
+
+func main() {
+	var seataConf, engineConf, jsonPath string
+	var fakeTC, trace bool
+	var opts options
+	flag.StringVar(&seataConf, "seataConf", "saga/e2e/seatago.yaml", "path to seata-go client yaml")
+	flag.StringVar(&engineConf, "engineConf", "saga/e2e/config.yaml", "path to saga engine config")
+	flag.BoolVar(&fakeTC, "fakeTC", false, "serve the seatago.yaml TC address with the in-process fake TC instead of a Seata Server")
+	flag.IntVar(&opts.total, "n", 200, "number of sagas to run")
+	flag.IntVar(&opts.concurrency, "concurrency", 16, "sagas in flight at once")
+	flag.Float64Var(&opts.compensate, "compensate", 0.2, "fraction of sagas that are built to fail ReduceBalance and compensate")
+	flag.IntVar(&opts.products, "products", 2, "number of product rows the sagas contend on")
+	flag.IntVar(&opts.users, "users", 2, "number of user rows the sagas contend on")
+	flag.IntVar(&opts.stock, "stock", 100000, "stock seeded for every product")
+	flag.IntVar(&opts.balance, "balance", 1000000, "balance seeded for every user")
+	flag.IntVar(&opts.count, "count", 1, "items every saga reduces")
+	flag.IntVar(&opts.amount, "amount", 10, "amount every succeeding saga reduces")
+	flag.DurationVar(&opts.timeout, "timeout", 60*time.Second, "how long one saga may take to finish")
+	flag.Int64Var(&opts.seed, "seed", 0, "seed of the product, user and outcome choice (default: time based)")
+	flag.StringVar(&jsonPath, "json", "", "write the report as JSON to this path")
+	flag.BoolVar(&trace, "trace", false, "print every action call")
+	flag.Parse()
+	if opts.total <= 0 || opts.concurrency <= 0 || opts.products <= 0 || opts.users <= 0 || opts.compensate < 0 || opts.compensate > 1 {
+		fmt.Fprintln(os.Stderr, "-n, -concurrency, -products and -users must be positive and -compensate within [0, 1]")
+		os.Exit(2)
+	}
+	if opts.seed == 0 {
+		opts.seed = time.Now().UnixNano()
+	}
+	defs, err := statelang.LoadGlob(harness.StatelangGlob)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load state machine definitions failed: %v\n", err)
+		os.Exit(1)
+	}
+	def, err := statelang.Find(defs, stateMachine)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	db, driver, err := harness.OpenBusinessDB(engineConf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open business db failed: %v\n", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	if err := harness.EnsureBusinessTables(db); err != nil {
+		fmt.Fprintf(os.Stderr, "create business tables failed: %v\n", err)
+		os.Exit(1)
+	}
+	if fakeTC {
+		addr, err := harness.SeataAddr(seataConf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
+		}
+		tc, err := faketc.Start(faketc.Config{Addr: addr})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "start fake TC failed: %v\n", err)
+			os.Exit(1)
+		}
+		defer tc.Close()
+	}
+	eng, err := harness.NewEngine(seataConf, engineConf, db, nil, trace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+
+	products, users := rowIDs("load_p_", opts.products), rowIDs("load_u_", opts.users)
+	if err := scenario.SeedRows(db, driver, seedRows(products, users, opts)); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	jobs := plan(products, users, opts)
+	fmt.Printf("LOAD %d sagas, concurrency %d, %.0f%% compensate, %d products x %d stock, %d users x %d balance, seed %d\n",
+		opts.total, opts.concurrency, opts.compensate*100, opts.products, opts.stock, opts.users, opts.balance, opts.seed)
+
+	run := func(j job) outcome {
+		o := outcome{job: j}
+		started := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+		defer cancel()
+		params := map[string]any{
+			"businessKey": j.businessKey,
+			"productId":   j.productID,
+			"count":       j.count,
+			"userId":      j.userID,
+			"amount":      j.amount,
+		}
+		inst, err := eng.StartWithBusinessKey(ctx, stateMachine, "", j.businessKey, params)
+		if err != nil {
+			o.err = fmt.Sprintf("start: %v", err)
+			return o
+		}
+		o.xid = inst.ID()
+		machine, err := scenario.WaitFinished(ctx, db, o.xid, 50*time.Millisecond)
+		o.latency = time.Since(started)
+		if err != nil {
+			o.err = err.Error()
+			return o
+		}
+		o.status, o.compensationStatus = machine.Status.String, machine.CompensationStatus.String
+		states, err := sagastore.LoadStates(db, o.xid)
+		if err != nil {
+			o.err = fmt.Sprintf("query state rows: %v", err)
+			return o
+		}
+		o.violations = invariant.Check(def, machine, states)
+		return o
+	}
+
+	started := time.Now()
+	outcomes := make([]outcome, len(jobs))
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				outcomes[j.index] = run(j)
+			}
+		}()
+	}
+	for _, j := range jobs {
+		queue <- j
+	}
+	close(queue)
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	stock, err := sumColumn(db, "e2e_inventory", "stock", "product_id", products)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read final stock failed: %v\n", err)
+		os.Exit(1)
+	}
+	balance, err := sumColumn(db, "e2e_balance", "amount", "user_id", users)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read final balance failed: %v\n", err)
+		os.Exit(1)
+	}
+	r := summarize(outcomes, elapsed, opts, stock, balance)
+	r.print()
+	if jsonPath != "" {
+		if err := r.writeJSON(jsonPath); err != nil {
+			fmt.Fprintf(os.Stderr, "write JSON report failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if problems := r.problems(); len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "load run failed: %s\n", strings.Join(problems, "; "))
+		os.Exit(1)
+	}
+	fmt.Println("LOAD OK")
+}
+
+func rowIDs(prefix string, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return ids
+}
+
+func seedRows(products, users []string, opts options) []scenario.Row {
+	var rows []scenario.Row
+	for _, id := range products {
+		rows = append(rows, scenario.Row{Table: "e2e_inventory", Key: map[string]any{"product_id": id}, Values: map[string]any{"stock": opts.stock}})
+	}
+	for _, id := range users {
+		rows = append(rows, scenario.Row{Table: "e2e_balance", Key: map[string]any{"user_id": id}, Values: map[string]any{"amount": opts.balance}})
+	}
+	return rows
+}
+
+// plan draws the product, user and kind of every saga from opts.seed, so a
+// run can be repeated.
+func plan(products, users []string, opts options) []job {
+	rnd := rand.New(rand.NewSource(opts.seed))
+	run := time.Now().Format("20060102150405")
+	jobs := make([]job, opts.total)
+	for i := range jobs {
+		j := job{
+			index:       i,
+			businessKey: fmt.Sprintf("load-%s-%d", run, i),
+			productID:   products[rnd.Intn(len(products))],
+			userID:      users[rnd.Intn(len(users))],
+			count:       opts.count,
+			amount:      opts.amount,
+			compensate:  rnd.Float64() < opts.compensate,
+		}
+		if j.compensate {
+			j.amount = opts.balance + 1
+		}
+		jobs[i] = j
+	}
+	return jobs
+}
+
+// sumColumn adds up column over the rows keyed by ids.
+func sumColumn(q sagastore.Querier, table, column, key string, ids []string) (int, error) {
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	var sum int
+	err := q.QueryRow(fmt.Sprintf("SELECT COALESCE(SUM(%s), 0) FROM %s WHERE %s IN (%s)", column, table, key, placeholders), args...).Scan(&sum)
+	return sum, err
+}
@@ -0,0 +1,201 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// outcome is what became of one job.
+type outcome struct {
+	job                job
+	xid                string
+	status             string
+	compensationStatus string
+	latency            time.Duration
+	violations         []string
+	err                string
+}
+
+// report is the summary of a run. Stock and balance hold the conservation
+// check of the contended rows: the seeded total, what is left, what the
+// succeeded sagas took, and left+taken, which must equal the seeded total.
+type report struct {
+	Sagas               int          `json:"sagas"`
+	Concurrency         int          `json:"concurrency"`
+	Seed                int64        `json:"seed"`
+	ElapsedMillis       int64        `json:"elapsedMillis"`
+	Throughput          float64      `json:"sagasPerSecond"`
+	Succeeded           int          `json:"succeeded"`
+	Compensated         int          `json:"compensated"`
+	CompensationFailed  int          `json:"compensationFailed"`
+	Unexpected          int          `json:"unexpected"`
+	Errors              int          `json:"errors"`
+	InvariantViolations int          `json:"invariantViolations"`
+	Latency             latency      `json:"latencyMillis"`
+	Stock               conservation `json:"stock"`
+	Balance             conservation `json:"balance"`
+	Failures            []string     `json:"failures,omitempty"`
+	elapsed             time.Duration
+}
+
+type latency struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+type conservation struct {
+	Seeded int `json:"seeded"`
+	Left   int `json:"left"`
+	Taken  int `json:"taken"`
+}
+
+func (c conservation) holds() bool { return c.Left+c.Taken == c.Seeded }
+
+// maxListedFailures bounds the per-saga failures kept in the report.
+const maxListedFailures = 20
+
+// summarize classifies every outcome and sets up the conservation check
+// from the sums of the contended rows after the run.
+func summarize(outcomes []outcome, elapsed time.Duration, opts options, stock, balance int) report {
+	r := report{
+		Sagas:       len(outcomes),
+		Concurrency: opts.concurrency,
+		Seed:        opts.seed,
+		elapsed:     elapsed,
+		Stock:       conservation{Seeded: opts.products * opts.stock, Left: stock},
+		Balance:     conservation{Seeded: opts.users * opts.balance, Left: balance},
+	}
+	r.ElapsedMillis = elapsed.Milliseconds()
+	if elapsed > 0 {
+		r.Throughput = float64(len(outcomes)) / elapsed.Seconds()
+	}
+	fail := func(o outcome, msg string) {
+		if len(r.Failures) < maxListedFailures {
+			r.Failures = append(r.Failures, fmt.Sprintf("%s (%s): %s", o.job.businessKey, o.xid, msg))
+		}
+	}
+	var latencies []time.Duration
+	for _, o := range outcomes {
+		if o.err != "" {
+			r.Errors++
+			fail(o, o.err)
+			continue
+		}
+		latencies = append(latencies, o.latency)
+		if len(o.violations) > 0 {
+			r.InvariantViolations++
+			fail(o, o.violations[0])
+		}
+		switch {
+		case o.status == "SU":
+			r.Succeeded++
+			r.Stock.Taken += o.job.count
+			r.Balance.Taken += o.job.amount
+		case o.compensationStatus == "SU":
+			r.Compensated++
+		default:
+			r.CompensationFailed++
+			fail(o, fmt.Sprintf("status %s, compensation status %s", o.status, o.compensationStatus))
+			continue
+		}
+		if (o.status == "SU") == o.job.compensate {
+			// e.g. a success job compensated because the stock ran out
+			r.Unexpected++
+		}
+	}
+	r.Latency = percentiles(latencies)
+	return r
+}
+
+func percentiles(latencies []time.Duration) latency {
+	if len(latencies) == 0 {
+		return latency{}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	at := func(p float64) float64 {
+		i := int(p*float64(len(latencies))+0.5) - 1
+		if i < 0 {
+			i = 0
+		}
+		if i >= len(latencies) {
+			i = len(latencies) - 1
+		}
+		return millis(latencies[i])
+	}
+	return latency{P50: at(0.50), P90: at(0.90), P99: at(0.99), Max: millis(latencies[len(latencies)-1])}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// problems lists why the run failed; sagas that compensated instead of
+// succeeding are not a problem on their own.
+func (r report) problems() []string {
+	var problems []string
+	if r.Errors > 0 {
+		problems = append(problems, fmt.Sprintf("%d sagas did not start or finish", r.Errors))
+	}
+	if r.CompensationFailed > 0 {
+		problems = append(problems, fmt.Sprintf("%d sagas neither succeeded nor compensated", r.CompensationFailed))
+	}
+	if r.InvariantViolations > 0 {
+		problems = append(problems, fmt.Sprintf("%d sagas violate state machine invariants", r.InvariantViolations))
+	}
+	if !r.Stock.holds() {
+		problems = append(problems, fmt.Sprintf("stock not conserved: %d left + %d sold != %d seeded", r.Stock.Left, r.Stock.Taken, r.Stock.Seeded))
+	}
+	if !r.Balance.holds() {
+		problems = append(problems, fmt.Sprintf("balance not conserved: %d left + %d spent != %d seeded", r.Balance.Left, r.Balance.Taken, r.Balance.Seeded))
+	}
+	return problems
+}
+
+func (r report) print() {
+	fmt.Printf("sagas:        %d in %s (%.1f/s)\n", r.Sagas, r.elapsed.Round(time.Millisecond), r.Throughput)
+	fmt.Printf("succeeded:    %d\n", r.Succeeded)
+	fmt.Printf("compensated:  %d\n", r.Compensated)
+	if r.Unexpected > 0 {
+		fmt.Printf("unexpected:   %d (outcome differs from the planned kind)\n", r.Unexpected)
+	}
+	fmt.Printf("comp. failed: %d\n", r.CompensationFailed)
+	fmt.Printf("errors:       %d\n", r.Errors)
+	fmt.Printf("invariants:   %d violating\n", r.InvariantViolations)
+	fmt.Printf("latency ms:   p50 %.1f  p90 %.1f  p99 %.1f  max %.1f\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	fmt.Printf("stock:        %d left + %d sold = %d, seeded %d\n", r.Stock.Left, r.Stock.Taken, r.Stock.Left+r.Stock.Taken, r.Stock.Seeded)
+	fmt.Printf("balance:      %d left + %d spent = %d, seeded %d\n", r.Balance.Left, r.Balance.Taken, r.Balance.Left+r.Balance.Taken, r.Balance.Seeded)
+	for _, f := range r.Failures {
+		fmt.Printf("  - %s\n", f)
+	}
+}
+
+// writeJSON writes the report as indented JSON.
+func (r report) writeJSON(path string) error {
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
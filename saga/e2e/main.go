@@ -20,272 +20,301 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"net"
 	"os"
-	"path/filepath"
+	"os/exec"
 	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
-	"gopkg.in/yaml.v3"
+	_ "github.com/mattn/go-sqlite3"
 
-	"seata.apache.org/seata-go/pkg/client"
-	engcfg "seata.apache.org/seata-go/pkg/saga/statemachine/engine/config"
+	"seata.apache.org/seata-go-samples/saga/e2e/harness"
+	"seata.apache.org/seata-go-samples/saga/e2e/scenario"
+	"seata.apache.org/seata-go-samples/saga/invariant"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+	"seata.apache.org/seata-go-samples/util/faketc"
 	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/core"
-	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/invoker"
 )
 
-// InventoryAction (DB-backed) implements reduce/compensate with explicit params
-type InventoryAction struct{ db *sql.DB }
-
-func NewInventoryAction(db *sql.DB) *InventoryAction { return &InventoryAction{db: db} }
-
-// Reduce(businessKey, productId, count) -> (bool, error)
-func (a *InventoryAction) Reduce(businessKey string, productId string, count int) (bool, error) {
-	if count <= 0 {
-		count = 1
-	}
-	res, err := a.db.Exec("UPDATE e2e_inventory SET stock = stock - ? WHERE product_id = ? AND stock >= ?", count, productId, count)
-	if err != nil {
-		return false, err
-	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return false, fmt.Errorf("INVENTORY_NOT_ENOUGH")
-	}
-	fmt.Printf("InventoryAction.Reduce: biz=%s, product=%s, count=%d\n", businessKey, productId, count)
-	return true, nil
-}
-
-func (a *InventoryAction) CompensateReduce(businessKey string, productId string, count int) (bool, error) {
-	if count <= 0 {
-		count = 1
-	}
-	if _, err := a.db.Exec("UPDATE e2e_inventory SET stock = stock + ? WHERE product_id = ?", count, productId); err != nil {
-		return false, err
-	}
-	fmt.Printf("InventoryAction.CompensateReduce: biz=%s, product=%s, count=%d\n", businessKey, productId, count)
-	return true, nil
-}
-
-// BalanceAction (DB-backed) implements reduce/compensate with explicit params
-type BalanceAction struct{ db *sql.DB }
-
-func NewBalanceAction(db *sql.DB) *BalanceAction { return &BalanceAction{db: db} }
-
-// Reduce(businessKey, userId, amount) -> (bool, error)
-func (b *BalanceAction) Reduce(businessKey string, userId string, amount int) (bool, error) {
-	if amount <= 0 {
-		amount = 1
-	}
-	res, err := b.db.Exec("UPDATE e2e_balance SET amount = amount - ? WHERE user_id = ? AND amount >= ?", amount, userId, amount)
-	if err != nil {
-		return false, err
-	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return false, fmt.Errorf("BALANCE_NOT_ENOUGH")
-	}
-	fmt.Printf("BalanceAction.Reduce: biz=%s, user=%s, amount=%d\n", businessKey, userId, amount)
-	return true, nil
-}
-
-func (b *BalanceAction) CompensateReduce(businessKey string, userId string, amount int) (bool, error) {
-	if amount <= 0 {
-		amount = 1
-	}
-	if _, err := b.db.Exec("UPDATE e2e_balance SET amount = amount + ? WHERE user_id = ?", amount, userId); err != nil {
-		return false, err
-	}
-	fmt.Printf("BalanceAction.CompensateReduce: biz=%s, user=%s, amount=%d\n", businessKey, userId, amount)
-	return true, nil
+// runner holds what every scenario run needs.
+type runner struct {
+	eng              *core.ProcessCtrlStateMachineEngine
+	db               *sql.DB
+	driver           string
+	defs             []*statelang.StateMachine
+	timeout          time.Duration
+	operationTimeout time.Duration
+	// childArgs are the flags a crash scenario's child process is started
+	// with, besides -scenario and -crashOnly.
+	childArgs []string
 }
 
 func main() {
 	var seataConf string
 	var engineConf string
+	var scenarioDir string
+	var only string
+	var junitPath string
+	var jsonPath string
+	var timeout time.Duration
+	var crashOnly bool
+	var fakeTC bool
 	flag.StringVar(&seataConf, "seataConf", "saga/e2e/seatago.yaml", "path to seata-go client yaml")
 	flag.StringVar(&engineConf, "engineConf", "saga/e2e/config.yaml", "path to saga engine config")
+	flag.StringVar(&scenarioDir, "scenarios", "saga/e2e/scenarios", "directory with the YAML scenario files")
+	flag.StringVar(&only, "scenario", "", "run a single scenario by name (default: all)")
+	flag.StringVar(&junitPath, "junit", "", "write a JUnit XML report to this path")
+	flag.StringVar(&jsonPath, "json", "", "write a JSON report to this path")
+	flag.DurationVar(&timeout, "timeout", 30*time.Second, "how long a scenario may take to finish")
+	flag.BoolVar(&crashOnly, "crashOnly", false, "run the crash scenario named by -scenario up to its crash point and leave the instance stuck")
+	flag.BoolVar(&fakeTC, "fakeTC", false, "serve the seatago.yaml TC address with the in-process fake TC instead of a Seata Server")
 	flag.Parse()
 
-	client.InitPath(seataConf)
-	if err := checkSeataConnectivity(seataConf); err != nil {
-		fmt.Fprintf(os.Stderr, "Seata server connectivity check failed: %v\n", err)
-		os.Exit(1)
-	}
-
-	eng, err := core.NewProcessCtrlStateMachineEngine()
+	scenarios, err := scenario.Discover(scenarioDir)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "create state machine engine failed: %v\n", err)
+		fmt.Fprintf(os.Stderr, "load scenarios failed: %v\n", err)
 		os.Exit(1)
 	}
-	cfgIface := eng.GetStateMachineConfig()
-	if cfg, ok := cfgIface.(*engcfg.DefaultStateMachineConfig); ok {
-		if err := cfg.LoadConfig(engineConf); err != nil {
-			fmt.Fprintf(os.Stderr, "load engine config failed: %v\n", err)
-			os.Exit(1)
-		}
-		if wd, err := os.Getwd(); err == nil {
-			absPattern := filepath.Join(wd, "saga/e2e/statelang/*.json")
-			_ = cfg.RegisterStateMachineDef([]string{absPattern})
-		}
-		if err := cfg.Init(); err != nil {
-			fmt.Fprintf(os.Stderr, "init engine config failed: %v\n", err)
+	if only != "" {
+		sc, err := scenario.Find(scenarios, only)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
 		}
-	} else {
-		fmt.Fprintf(os.Stderr, "unexpected state machine config type: %T\n", cfgIface)
+		scenarios = []*scenario.Scenario{sc}
+	}
+	if crashOnly && (only == "" || scenarios[0].Crash == nil) {
+		fmt.Fprintln(os.Stderr, "-crashOnly needs -scenario naming a scenario with a crash block")
+		os.Exit(1)
+	}
+	defs, err := statelang.LoadGlob(harness.StatelangGlob)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "load state machine definitions failed: %v\n", err)
+		os.Exit(1)
+	}
+	operationTimeout, err := harness.OperationTimeout(engineConf)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "read engine config failed: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Open business DB and seed data
-	bizDB, err := openBusinessDB(engineConf)
+	// Open business DB and create the business tables; rows come from the scenarios
+	bizDB, driver, err := harness.OpenBusinessDB(engineConf)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "open business db failed: %v\n", err)
 		os.Exit(1)
 	}
-	if err := seedBusinessData(bizDB); err != nil {
-		fmt.Fprintf(os.Stderr, "seed business data failed: %v\n", err)
+	if err := harness.EnsureBusinessTables(bizDB); err != nil {
+		fmt.Fprintf(os.Stderr, "create business tables failed: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Register local services (DB-backed)
-	if lv := cfgIface.ServiceInvokerManager().ServiceInvoker("local"); lv != nil {
-		if lsi, ok := lv.(*invoker.LocalServiceInvoker); ok {
-			lsi.RegisterService("inventoryAction", NewInventoryAction(bizDB))
-			lsi.RegisterService("balanceAction", NewBalanceAction(bizDB))
+	if fakeTC && !crashOnly {
+		// crash children connect to the parent's fake TC
+		addr, err := harness.SeataAddr(seataConf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(1)
 		}
+		tc, err := faketc.Start(faketc.Config{Addr: addr})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "start fake TC failed: %v\n", err)
+			os.Exit(1)
+		}
+		defer tc.Close()
 	}
 
-	// Run three scenarios sequentially, driven by parameters (no orders table)
-	scenarios := []struct {
-		name   string
-		params map[string]any
-	}{
-		{"success", successParams()},
-		{"compensate-balance", compensateBalanceParams()},
-		{"compensate-inventory", compensateInventoryParams()},
-	}
-	for _, sc := range scenarios {
-		inst, err := eng.Start(context.Background(), "ReduceInventoryAndBalance", "", sc.params)
+	var crash *harness.Crash
+	if crashOnly {
+		sc := scenarios[0]
+		def, err := statelang.Find(defs, sc.StateMachine)
+		if err == nil {
+			crash, err = harness.CrashBefore(def, sc.Crash.Before)
+		}
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "start saga failed (%s): %v\n", sc.name, err)
+			fmt.Fprintf(os.Stderr, "scenario %s: %v\n", sc.Name, err)
 			os.Exit(1)
 		}
-		fmt.Println("======================================================")
-		fmt.Printf("SCENARIO %s XID=%s status=%s compStatus=%s\n", sc.name, inst.ID(), inst.Status(), inst.CompensationStatus())
-		fmt.Println("======================================================")
+	}
+	eng, err := harness.NewEngine(seataConf, engineConf, bizDB, crash, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	if crashOnly {
+		os.Exit(runUntilCrash(eng, bizDB, driver, scenarios[0], timeout))
+	}
 
+	r := &runner{
+		eng:              eng,
+		db:               bizDB,
+		driver:           driver,
+		defs:             defs,
+		timeout:          timeout,
+		operationTimeout: operationTimeout,
+		childArgs: []string{
+			"-seataConf=" + seataConf,
+			"-engineConf=" + engineConf,
+			"-scenarios=" + scenarioDir,
+			"-timeout=" + timeout.String(),
+		},
+	}
+	report := &scenario.Report{Suite: "saga-e2e", Started: time.Now()}
+	for _, sc := range scenarios {
+		result := r.run(sc)
+		report.Add(result)
+		if problems := result.Problems(); len(problems) > 0 {
+			fmt.Fprintf(os.Stderr, "validation failed (%s): %s\n", sc.Name, strings.Join(problems, "; "))
+		} else {
+			fmt.Printf("DB validation (%s) OK\n", sc.Name)
+		}
 		fmt.Println("")
-		fmt.Println("")
-		fmt.Println("")
-		time.Sleep(time.Second * 2)
 	}
-}
 
-type runtimeStoreConf struct {
-	StoreEnabled bool   `yaml:"store_enabled"`
-	StoreType    string `yaml:"store_type"`
-	StoreDSN     string `yaml:"store_dsn"`
-	TCEnabled    bool   `yaml:"tc_enabled"`
+	if junitPath != "" {
+		if err := report.WriteJUnit(junitPath); err != nil {
+			fmt.Fprintf(os.Stderr, "write JUnit report failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if jsonPath != "" {
+		if err := report.WriteJSON(jsonPath); err != nil {
+			fmt.Fprintf(os.Stderr, "write JSON report failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if failed := report.Failed(); failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d scenarios failed\n", failed, len(report.Results))
+		os.Exit(1)
+	}
+	fmt.Printf("All %d e2e scenarios passed\n", len(report.Results))
 }
 
-// checkSeataConnectivity parses grouplist from seatago.yaml and dials the first address
-func checkSeataConnectivity(seataConf string) error {
-	raw, err := os.ReadFile(seataConf)
+// run seeds, starts and validates one scenario. The machine row is polled
+// until the engine has finished with it before anything is checked; the
+// generic invariants are checked alongside the scenario's expectations.
+func (r *runner) run(sc *scenario.Scenario) (result scenario.Result) {
+	started := time.Now()
+	result = scenario.Result{Name: sc.Name, File: sc.File}
+	defer func() {
+		result.Duration = time.Since(started)
+	}()
+	def, err := statelang.Find(r.defs, sc.StateMachine)
 	if err != nil {
-		return err
+		result.Error = err.Error()
+		return result
 	}
-	type seataYaml struct {
-		Seata struct {
-			Service struct {
-				GroupList map[string]string `yaml:"grouplist"`
-			} `yaml:"service"`
-		} `yaml:"seata"`
-	}
-	var cfg seataYaml
-	if err := yaml.Unmarshal(raw, &cfg); err != nil {
-		return err
-	}
-	for _, addr := range cfg.Seata.Service.GroupList {
-		target := addr
-		// allow multiple via ","
-		if strings.Contains(addr, ",") {
-			parts := strings.Split(addr, ",")
-			target = strings.TrimSpace(parts[0])
+
+	timeout := r.timeout
+	if sc.Crash != nil {
+		// Recovery may have to wait for the engine to give up on the
+		// crashed process first.
+		timeout += r.operationTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var xid string
+	if sc.Crash != nil {
+		xid, err = r.crashAndRecover(ctx, sc)
+		if err != nil {
+			result.Error = err.Error()
+			return result
 		}
-		if target == "" {
-			continue
+	} else {
+		if err = scenario.SeedRows(r.db, r.driver, sc.Seed); err != nil {
+			result.Error = err.Error()
+			return result
 		}
-		conn, err := net.DialTimeout("tcp", target, 2_000_000_000)
+		inst, err := r.eng.Start(ctx, sc.StateMachine, "", sc.Params)
 		if err != nil {
-			return fmt.Errorf("dial %s failed: %w", target, err)
+			result.Error = fmt.Sprintf("start saga failed: %v", err)
+			return result
 		}
-		_ = conn.Close()
-		return nil
+		xid = inst.ID()
+		fmt.Println("======================================================")
+		fmt.Printf("SCENARIO %s XID=%s status=%s compStatus=%s\n", sc.Name, inst.ID(), inst.Status(), inst.CompensationStatus())
+		fmt.Println("======================================================")
 	}
-	return fmt.Errorf("no seata service.grouplist address found in %s", seataConf)
-}
+	result.XID = xid
 
-// openBusinessDB opens a DB connection using engine store_dsn from YAML.
-func openBusinessDB(engineConf string) (*sql.DB, error) {
-	raw, err := os.ReadFile(engineConf)
+	machine, err := scenario.WaitFinished(ctx, r.db, xid, 200*time.Millisecond)
 	if err != nil {
-		return nil, err
-	}
-	var r runtimeStoreConf
-	if err := yaml.Unmarshal(raw, &r); err != nil {
-		return nil, err
-	}
-	if !r.StoreEnabled || r.StoreType == "" || r.StoreDSN == "" {
-		return nil, fmt.Errorf("engine store not configured")
+		result.Error = err.Error()
+		return result
 	}
-	driver := r.StoreType
-	if driver == "sqlite" || driver == "sqlite3" {
-		driver = "sqlite3"
-	}
-	db, err := sql.Open(driver, r.StoreDSN)
+	result.Status = machine.Status.String
+	result.CompensationStatus = machine.CompensationStatus.String
+
+	failures, err := scenario.Verify(r.db, xid, sc.Expect)
 	if err != nil {
-		return nil, err
+		result.Error = err.Error()
+		return result
 	}
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, err
+	violations, err := invariant.CheckTree(r.db, r.defs, def, machine)
+	if err != nil {
+		result.Error = err.Error()
+		return result
 	}
-	return db, nil
+	result.Failures = append(failures, violations...)
+	return result
 }
 
-// seedBusinessData creates business tables and deterministic rows to drive three scenarios
-func seedBusinessData(db *sql.DB) error {
-	// tables
-	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS e2e_inventory (
-  product_id VARCHAR(64) PRIMARY KEY,
-  stock INT NOT NULL
-)`)
-	if err != nil {
-		return err
+// crashAndRecover runs sc in a child process that dies at the crash point,
+// finds the instance it left running by business key, and resumes it with
+// the scenario's recovery operation.
+func (r *runner) crashAndRecover(ctx context.Context, sc *scenario.Scenario) (string, error) {
+	args := append(append([]string{}, r.childArgs...), "-scenario="+sc.Name, "-crashOnly")
+	cmd := exec.CommandContext(ctx, os.Args[0], args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != harness.CrashExitCode {
+		return "", fmt.Errorf("crash run exited with %v, want status %d", err, harness.CrashExitCode)
 	}
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS e2e_balance (
-  user_id VARCHAR(64) PRIMARY KEY,
-  amount INT NOT NULL
-)`)
+
+	businessKey := sc.BusinessKey()
+	machines, err := sagastore.ListMachines(r.db, sagastore.Filter{
+		BusinessKey: businessKey,
+		MachineName: sc.StateMachine,
+		Running:     true,
+		Limit:       1,
+	})
 	if err != nil {
-		return err
+		return "", fmt.Errorf("query stuck instance: %w", err)
 	}
-	// upserts (MySQL syntax)
-	// inventories
-	if _, err := db.Exec(`INSERT INTO e2e_inventory(product_id, stock) VALUES
-        ('p_s', 100), ('p_b', 100), ('p_i', 100)
-      ON DUPLICATE KEY UPDATE stock=VALUES(stock)`); err != nil {
-		return err
+	if len(machines) == 0 || machines[0].BusinessKey.String != businessKey {
+		return "", fmt.Errorf("no running instance with business key %s after the crash", businessKey)
 	}
-	// balances
-	if _, err := db.Exec(`INSERT INTO e2e_balance(user_id, amount) VALUES
-        ('u_s', 1000), ('u_b', 50), ('u_i', 1000)
-      ON DUPLICATE KEY UPDATE amount=VALUES(amount)`); err != nil {
-		return err
-	}
-	return nil
+	xid := machines[0].ID
+	fmt.Println("======================================================")
+	fmt.Printf("SCENARIO %s XID=%s stuck after crash before %s, recovering with %s\n", sc.Name, xid, sc.Crash.Before, sc.Crash.Recovery)
+	fmt.Println("======================================================")
+
+	return xid, harness.Recover(ctx, r.eng, sc.Crash.Recovery, xid, 2*time.Second)
 }
 
-// no time helpers needed
+// runUntilCrash is the child side of a crash scenario: it seeds and starts
+// the scenario with the crash armed. Reaching the end means the crash did
+// not fire.
+func runUntilCrash(eng *core.ProcessCtrlStateMachineEngine, db *sql.DB, driver string, sc *scenario.Scenario, timeout time.Duration) int {
+	if err := scenario.SeedRows(db, driver, sc.Seed); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	fmt.Printf("SCENARIO %s businessKey=%s crashing before %s\n", sc.Name, sc.BusinessKey(), sc.Crash.Before)
+	inst, err := eng.StartWithBusinessKey(ctx, sc.StateMachine, "", sc.BusinessKey(), sc.Params)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start saga failed: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "scenario %s finished (XID=%s status=%s) without reaching the crash point %s\n",
+		sc.Name, inst.ID(), inst.Status(), sc.Crash.Before)
+	return 1
+}
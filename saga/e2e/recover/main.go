@@ -0,0 +1,192 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// recover finds Saga instances of the e2e sample that a crashed process
+// left behind and resumes them through the engine.
+//
+//	recover stuck [-age 1m]
+//	recover forward <xid>
+//	recover compensate <xid>
+//	recover skip-and-forward <xid>
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+
+	"seata.apache.org/seata-go-samples/saga/e2e/harness"
+	"seata.apache.org/seata-go-samples/saga/e2e/scenario"
+	"seata.apache.org/seata-go-samples/saga/invariant"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+	var err error
+	switch command {
+	case "stuck":
+		err = runStuck(args)
+	case scenario.Forward, scenario.Compensate, scenario.SkipAndForward:
+		err = runRecovery(command, args)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "recover %s: %v\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: recover stuck [flags]")
+	fmt.Fprintf(os.Stderr, "       recover %s <xid> [flags]\n", strings.Join(scenario.RecoveryOps, "|"))
+}
+
+func runStuck(args []string) error {
+	fs := flag.NewFlagSet("stuck", flag.ExitOnError)
+	engineConf := fs.String("engineConf", "saga/e2e/config.yaml", "path to saga engine config")
+	age := fs.Duration("age", 0, "only instances not updated for this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	db, _, err := harness.OpenBusinessDB(*engineConf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	machines, err := sagastore.ListStuck(db, time.Now().Add(-*age))
+	if err != nil {
+		return err
+	}
+	if len(machines) == 0 {
+		fmt.Println("No stuck instances.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "XID\tMACHINE\tBUSINESS KEY\tSTATUS\tCOMPENSATION\tRUNNING\tUPDATED")
+	for _, m := range machines {
+		updated := "-"
+		if m.GmtUpdated.Valid {
+			updated = m.GmtUpdated.Time.Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%t\t%s\n", m.ID, m.Name, orDash(m.BusinessKey.String),
+			orDash(m.Status.String), orDash(m.CompensationStatus.String), m.IsRunning, updated)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\nResume one with: go run ./saga/e2e/recover %s <xid>\n", strings.Join(scenario.RecoveryOps, "|"))
+	return nil
+}
+
+func runRecovery(op string, args []string) error {
+	fs := flag.NewFlagSet(op, flag.ExitOnError)
+	seataConf := fs.String("seataConf", "saga/e2e/seatago.yaml", "path to seata-go client yaml")
+	engineConf := fs.String("engineConf", "saga/e2e/config.yaml", "path to saga engine config")
+	timeout := fs.Duration("timeout", 0, "how long to keep retrying and waiting (default: trans_operation_timeout + 30s)")
+	var xid string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		xid, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if xid == "" {
+		xid = fs.Arg(0)
+	}
+	if xid == "" {
+		return fmt.Errorf("missing <xid>")
+	}
+	if *timeout == 0 {
+		operationTimeout, err := harness.OperationTimeout(*engineConf)
+		if err != nil {
+			return err
+		}
+		*timeout = operationTimeout + 30*time.Second
+	}
+
+	defs, err := statelang.LoadGlob(harness.StatelangGlob)
+	if err != nil {
+		return err
+	}
+	db, _, err := harness.OpenBusinessDB(*engineConf)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	before, err := sagastore.LoadMachine(db, xid)
+	if err != nil {
+		return fmt.Errorf("load %s: %w", xid, err)
+	}
+	def, err := statelang.Find(defs, before.Name)
+	if err != nil {
+		return err
+	}
+	eng, err := harness.NewEngine(*seataConf, *engineConf, db, nil, true)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	fmt.Printf("RECOVER %s %s (%s, status=%s compensationStatus=%s running=%t)\n", op, xid, def.Name,
+		orDash(before.Status.String), orDash(before.CompensationStatus.String), before.IsRunning)
+	if err := harness.Recover(ctx, eng, op, xid, 2*time.Second); err != nil {
+		return err
+	}
+	machine, err := scenario.WaitFinished(ctx, db, xid, 200*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	states, err := sagastore.LoadStates(db, xid)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("RECOVERED %s status=%s compensationStatus=%s\n", xid, orDash(machine.Status.String), orDash(machine.CompensationStatus.String))
+	fmt.Printf("States: %s\n", invariant.Summary(states))
+	violations, err := invariant.CheckTree(db, defs, def, machine)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("invariants violated: %s", strings.Join(violations, "; "))
+	}
+	fmt.Println("invariants=OK")
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -20,4 +20,4 @@ SEATA_CONF=${1:-saga/e2e/seatago.yaml}
 ENGINE_CONF=${2:-saga/e2e/config.yaml}
 
 echo "Running saga e2e with seataConf=$SEATA_CONF engineConf=$ENGINE_CONF"
-go run ./saga/e2e -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF"
+go run ./saga/e2e -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF" -scenario=success
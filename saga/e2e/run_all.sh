@@ -16,14 +16,17 @@
 
 set -euo pipefail
 
-# One-click e2e: optional docker-compose up + readiness wait, then run all scenarios.
+# One-click e2e: optional docker-compose up + readiness wait, then run and validate all scenarios.
 
 DIR=$(cd -- "$(dirname -- "${BASH_SOURCE[0]}")" &> /dev/null && pwd)
 REPO_ROOT="$DIR/../.."
 
 SEATA_CONF=${SEATA_CONF:-"$DIR/seatago.yaml"}
 ENGINE_CONF=${ENGINE_CONF:-"$DIR/config.yaml"}
+SCENARIO_DIR=${SCENARIO_DIR:-"$DIR/scenarios"}
+REPORT_DIR=${REPORT_DIR:-"$DIR/reports"}
 DO_UP=${DO_UP:-"false"}
+FAKE_TC=${FAKE_TC:-"false"}
 # Wait settings (seconds)
 WAIT_TIMEOUT=${WAIT_TIMEOUT:-60}
 WAIT_INTERVAL=${WAIT_INTERVAL:-2}
@@ -32,25 +35,31 @@ WAIT_READY_MARGIN=${WAIT_READY_MARGIN:-15}
 
 usage() {
   cat <<EOF
-Usage: $(basename "$0") [--up] [--seata <seatago.yaml>] [--engine <config.yaml>]
+Usage: $(basename "$0") [--up] [--fake-tc] [--seata <seatago.yaml>] [--engine <config.yaml>] [--scenarios <dir>] [--reports <dir>]
 
 Options:
-  --up                 Start docker-compose (MySQL + Seata Server) before running
+  --up                 Start docker-compose (MySQL + Seata Server) before running;
+                       only Seata Server when the engine config uses a SQLite store
+  --fake-tc            Serve the TC address in-process instead of using Seata Server;
+                       with a SQLite store no service is needed at all
   --seata <file>       Path to seatago.yaml (default: $SEATA_CONF)
   --engine <file>      Path to engine config (default: $ENGINE_CONF)
+  --scenarios <dir>    Directory with the YAML scenario files (default: $SCENARIO_DIR)
+  --reports <dir>      Where junit.xml and report.json are written (default: $REPORT_DIR)
 
-Runs three scenarios in order:
-  1) success
-  2) compensate-balance
-  3) compensate-inventory
+Runs every scenario file in the scenario directory in file name order and
+validates each one against its declared expectations.
 EOF
 }
 
 while [[ $# -gt 0 ]]; do
   case "$1" in
     --up) DO_UP="true"; shift ;;
+    --fake-tc) FAKE_TC="true"; shift ;;
     --seata) SEATA_CONF="$2"; shift 2 ;;
     --engine) ENGINE_CONF="$2"; shift 2 ;;
+    --scenarios) SCENARIO_DIR="$2"; shift 2 ;;
+    --reports) REPORT_DIR="$2"; shift 2 ;;
     -h|--help) usage; exit 0 ;;
     *) echo "Unknown arg: $1"; usage; exit 1 ;;
   esac
@@ -66,14 +75,27 @@ require go
 [[ -f "$SEATA_CONF" ]] || { echo "seatago.yaml not found: $SEATA_CONF"; exit 1; }
 [[ -f "$ENGINE_CONF" ]] || { echo "engine config not found: $ENGINE_CONF"; exit 1; }
 
+# A SQLite store is a local file the runner initializes, so MySQL is not needed
+STORE_TYPE=$(sed -nE 's/^store_type:[[:space:]]*"?([A-Za-z0-9]+)"?.*/\1/p' "$ENGINE_CONF" | head -n1)
+
 if [[ "$DO_UP" == "true" ]]; then
   require docker-compose || require docker
   echo "[+] Resetting docker-compose services (MySQL + Seata Server) ..."
   # Stop and remove old containers, networks and volumes to ensure a clean start
   docker-compose -f "$DIR/docker-compose.yml" down -v --remove-orphans || true
   docker-compose -f "$DIR/docker-compose.yml" rm -f -s -v || true
-  echo "[+] Starting docker-compose services (fresh) ..."
-  docker-compose -f "$DIR/docker-compose.yml" up -d --force-recreate
+  if [[ "$STORE_TYPE" == sqlite* && "$FAKE_TC" == "true" ]]; then
+    echo "[+] Nothing to start (SQLite store, fake TC)"
+  elif [[ "$STORE_TYPE" == sqlite* ]]; then
+    echo "[+] Starting Seata Server only (fresh, store_type=$STORE_TYPE) ..."
+    docker-compose -f "$DIR/docker-compose.yml" up -d --force-recreate --no-deps seata-server
+  elif [[ "$FAKE_TC" == "true" ]]; then
+    echo "[+] Starting MySQL only (fresh, fake TC) ..."
+    docker-compose -f "$DIR/docker-compose.yml" up -d --force-recreate mysql
+  else
+    echo "[+] Starting docker-compose services (fresh) ..."
+    docker-compose -f "$DIR/docker-compose.yml" up -d --force-recreate
+  fi
 fi
 
 wait_for_tcp() {
@@ -111,34 +133,31 @@ MYSQL_ADDR=$(sed -nE 's/.*store_dsn:[[:space:]]*"?[^\(]*tcp\(([^)]*)\).*/\1/p' "
 MYSQL_HOST=${MYSQL_ADDR%%:*}
 MYSQL_PORT=${MYSQL_ADDR##*:}
 
+RUN_FLAGS=()
+if [[ "$FAKE_TC" == "true" ]]; then
+  RUN_FLAGS+=("-fakeTC")
+fi
+
 if [[ "$DO_UP" == "true" ]]; then
   if [[ -n "${MYSQL_HOST:-}" && -n "${MYSQL_PORT:-}" ]]; then
     wait_for_tcp "$MYSQL_HOST" "$MYSQL_PORT" "MySQL" || exit 1
   fi
-  wait_for_tcp "$SEATA_HOST" "$SEATA_PORT" "Seata" || exit 1
-  echo "[+] Extra wait ${WAIT_READY_MARGIN}s for services to finish initialization ..."
-  sleep "$WAIT_READY_MARGIN"
-else
+  if [[ "$FAKE_TC" != "true" ]]; then
+    wait_for_tcp "$SEATA_HOST" "$SEATA_PORT" "Seata" || exit 1
+  fi
+  if [[ -n "${MYSQL_HOST:-}" || "$FAKE_TC" != "true" ]]; then
+    echo "[+] Extra wait ${WAIT_READY_MARGIN}s for services to finish initialization ..."
+    sleep "$WAIT_READY_MARGIN"
+  fi
+elif [[ "$FAKE_TC" != "true" ]]; then
   wait_for_tcp "$SEATA_HOST" "$SEATA_PORT" "Seata" || exit 1
 fi
 
-echo "[+] Running all scenarios via single process ..."
-OUT=$(go run ./saga/e2e -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF" | tee /dev/stderr)
-
-XID1=$(echo "$OUT" | awk -F '[ =,]+' '/SCENARIO success XID=/{print $4}' | tail -n1)
-[[ -n "$XID1" ]] || { echo "[-] could not extract XID for success"; exit 1; }
-echo "[+] Validating DB for success (XID=$XID1) ..."
-go run ./saga/e2e/dbcheck -engine "$ENGINE_CONF" -xid "$XID1" -scenario success
-
-XID2=$(echo "$OUT" | awk -F '[ =,]+' '/SCENARIO compensate-balance XID=/{print $4}' | tail -n1)
-[[ -n "$XID2" ]] || { echo "[-] could not extract XID for compensate-balance"; exit 1; }
-echo "[+] Validating DB for compensate-balance (XID=$XID2) ..."
-go run ./saga/e2e/dbcheck -engine "$ENGINE_CONF" -xid "$XID2" -scenario compensate-balance
-
-XID3=$(echo "$OUT" | awk -F '[ =,]+' '/SCENARIO compensate-inventory XID=/{print $4}' | tail -n1)
-[[ -n "$XID3" ]] || { echo "[-] could not extract XID for compensate-inventory"; exit 1; }
-echo "[+] Validating DB for compensate-inventory (XID=$XID3) ..."
-go run ./saga/e2e/dbcheck -engine "$ENGINE_CONF" -xid "$XID3" -scenario compensate-inventory
+echo "[+] Running and validating all scenarios in $SCENARIO_DIR via single process ..."
+mkdir -p "$REPORT_DIR"
+go run ./saga/e2e -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF" -scenarios="$SCENARIO_DIR" \
+  -junit="$REPORT_DIR/junit.xml" -json="$REPORT_DIR/report.json" ${RUN_FLAGS[@]+"${RUN_FLAGS[@]}"}
 
+echo "[+] Reports written to $REPORT_DIR"
 echo "[+] All e2e scenarios finished"
 exit 0
@@ -0,0 +1,66 @@
+#!/usr/bin/env bash
+# Licensed to the Apache Software Foundation (ASF) under one or more
+# contributor license agreements.  See the NOTICE file distributed with
+# this work for additional information regarding copyright ownership.
+# The ASF licenses this file to You under the Apache License, Version 2.0
+# (the "License"); you may not use this file except in compliance with
+# the License.  You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+set -euo pipefail
+
+# Crash a saga mid-flight and resume it by hand with the recover tool:
+#   1. run the crash scenario until the process dies before ReduceBalance
+#   2. list the stuck instance and resume it with forward/compensate/skip-and-forward
+#   3. validate the result with dbcheck
+# The runner does the same in-process for every crash scenario; this script
+# shows the manual steps an operator would take.
+
+DIR=$(cd -- "$(dirname -- "${BASH_SOURCE[0]}")" &> /dev/null && pwd)
+REPO_ROOT="$DIR/../.."
+
+SEATA_CONF=${1:-$DIR/seatago.yaml}
+ENGINE_CONF=${2:-$DIR/config.yaml}
+OP=${3:-forward}
+SCENARIO=${SCENARIO:-crash-forward}
+BUSINESS_KEY=${BUSINESS_KEY:-bk_crash_forward}
+CRASH_EXIT_CODE=3
+
+cd "$REPO_ROOT"
+BIN_DIR=$(mktemp -d)
+trap 'rm -rf "$BIN_DIR"' EXIT
+
+# Build the runner so its own exit status is visible; go run reports 1 for any failure.
+go build -o "$BIN_DIR/e2e" ./saga/e2e
+
+echo "[1/3] Running $SCENARIO until the injected crash ..."
+set +e
+"$BIN_DIR/e2e" -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF" -scenario="$SCENARIO" -crashOnly
+STATUS=$?
+set -e
+if [[ "$STATUS" -ne "$CRASH_EXIT_CODE" ]]; then
+  echo "[-] expected the process to crash with status $CRASH_EXIT_CODE, got $STATUS"
+  exit 1
+fi
+
+go run ./saga/e2e/recover stuck -engineConf="$ENGINE_CONF"
+XID=$(go run ./saga/sagactl list -engine "$ENGINE_CONF" -running -business-key "$BUSINESS_KEY" -limit 1 2>/dev/null | awk 'NR==2 {print $1}')
+[[ -n "$XID" ]] || { echo "[-] no running instance with business key $BUSINESS_KEY"; exit 1; }
+
+echo "[2/3] Resuming $XID with $OP (waits for trans_operation_timeout if the engine still considers it running) ..."
+go run ./saga/e2e/recover "$OP" "$XID" -seataConf="$SEATA_CONF" -engineConf="$ENGINE_CONF"
+
+echo "[3/3] Validating $XID ..."
+if [[ "$OP" == "forward" ]]; then
+  # The scenario's expectations describe forward recovery.
+  go run ./saga/e2e/dbcheck -engine "$ENGINE_CONF" -xid "$XID" -scenario "$SCENARIO"
+else
+  go run ./saga/e2e/dbcheck -engine "$ENGINE_CONF" -xid "$XID"
+fi
@@ -0,0 +1,273 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scenario
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+// SeedRows upserts the scenario's seed rows. driver selects the upsert
+// syntax: MySQL's ON DUPLICATE KEY UPDATE, or ON CONFLICT on the key columns
+// for sagastore.SQLite.
+func SeedRows(db *sql.DB, driver string, rows []Row) error {
+	for _, row := range rows {
+		values := make(map[string]any, len(row.Key)+len(row.Values))
+		for column, value := range row.Key {
+			values[column] = value
+		}
+		for column, value := range row.Values {
+			values[column] = value
+		}
+		columns := sortedColumns(values)
+		args := make([]any, 0, len(columns))
+		for _, column := range columns {
+			args = append(args, values[column])
+		}
+		query := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s) %s",
+			row.Table, strings.Join(columns, ", "), placeholders(len(columns)), upsertClause(driver, row))
+		if _, err := db.Exec(query, args...); err != nil {
+			return fmt.Errorf("seed %s: %w", row, err)
+		}
+	}
+	return nil
+}
+
+func upsertClause(driver string, row Row) string {
+	columns := sortedColumns(row.Values)
+	updates := make([]string, 0, len(columns))
+	if driver == sagastore.SQLite {
+		for _, column := range columns {
+			updates = append(updates, fmt.Sprintf("%s=excluded.%s", column, column))
+		}
+		return fmt.Sprintf("ON CONFLICT(%s) DO UPDATE SET %s", strings.Join(sortedColumns(row.Key), ", "), strings.Join(updates, ", "))
+	}
+	for _, column := range columns {
+		updates = append(updates, fmt.Sprintf("%s=VALUES(%s)", column, column))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(updates, ", ")
+}
+
+// WaitFinished polls the machine row of xid until the engine has stopped
+// running it, instead of sleeping for a fixed time between scenarios.
+func WaitFinished(ctx context.Context, db *sql.DB, xid string, interval time.Duration) (sagastore.Machine, error) {
+	for {
+		row, err := sagastore.LoadMachine(db, xid)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return row, err
+		}
+		if err == nil && !row.IsRunning && row.GmtEnd.Valid {
+			return row, nil
+		}
+		select {
+		case <-ctx.Done():
+			return row, fmt.Errorf("machine %s did not finish: %w", xid, ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Verify compares everything the scenario expects with the rows recorded for
+// xid and returns one message per mismatch.
+func Verify(db *sql.DB, xid string, expect Expect) ([]string, error) {
+	machine, err := sagastore.LoadMachine(db, xid)
+	if err != nil {
+		return nil, fmt.Errorf("query machine row: %w", err)
+	}
+	states, err := sagastore.LoadStates(db, xid)
+	if err != nil {
+		return nil, fmt.Errorf("query state rows: %w", err)
+	}
+	failures := VerifyMachine(machine, expect.Machine)
+	failures = append(failures, VerifyStates(states, expect.States)...)
+	if len(expect.SubMachines) > 0 {
+		subFailures, err := verifySubMachines(db, xid, states, expect.SubMachines)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, subFailures...)
+	}
+	tableFailures, err := VerifyTables(db, expect.Tables)
+	if err != nil {
+		return nil, err
+	}
+	return append(failures, tableFailures...), nil
+}
+
+// verifySubMachines finds the instance each expected SubStateMachine state
+// started and checks its machine and state rows. A retried state may have
+// started several; the latest counts.
+func verifySubMachines(db *sql.DB, xid string, states []sagastore.State, want []SubMachineExpect) ([]string, error) {
+	children, err := sagastore.LoadChildren(db, xid)
+	if err != nil {
+		return nil, fmt.Errorf("query sub-machine rows: %w", err)
+	}
+	stateNames := make(map[string]string, len(states))
+	for _, s := range states {
+		if !s.IsCompensation() {
+			stateNames[s.ID] = s.Name
+		}
+	}
+	var failures []string
+	for _, w := range want {
+		var child *sagastore.Machine
+		for i := range children {
+			if stateNames[strings.TrimPrefix(children[i].ParentID.String, xid+":")] == w.State {
+				child = &children[i]
+			}
+		}
+		if child == nil {
+			failures = append(failures, fmt.Sprintf("no sub-machine started by %s", w.State))
+			continue
+		}
+		childStates, err := sagastore.LoadStates(db, child.ID)
+		if err != nil {
+			return nil, fmt.Errorf("query state rows of %s: %w", child.ID, err)
+		}
+		for _, f := range append(VerifyMachine(*child, w.Machine), VerifyStates(childStates, w.States)...) {
+			failures = append(failures, fmt.Sprintf("sub-machine of %s: %s", w.State, f))
+		}
+	}
+	return failures, nil
+}
+
+// VerifyMachine checks the end state of the machine row.
+func VerifyMachine(row sagastore.Machine, want MachineExpect) []string {
+	var failures []string
+	if row.Status.String != want.Status {
+		failures = append(failures, fmt.Sprintf("status=%s want=%s", row.Status.String, want.Status))
+	}
+	if row.CompensationStatus.String != want.CompensationStatus {
+		got := "<NULL>"
+		if row.CompensationStatus.Valid {
+			got = row.CompensationStatus.String
+		}
+		failures = append(failures, fmt.Sprintf("compensation_status=%s want='%s'", got, want.CompensationStatus))
+	}
+	if row.IsRunning {
+		failures = append(failures, "is_running=1 want=0")
+	}
+	if !row.GmtEnd.Valid {
+		failures = append(failures, "gmt_end is NULL")
+	}
+	if want.NoException && row.Excep.Valid && len(row.Excep.String) > 0 {
+		failures = append(failures, "excep not empty")
+	}
+	return failures
+}
+
+// VerifyStates checks that every expected state row is present and that no
+// unlisted compensation ran. End states are not persisted as state rows, so
+// the machine row covers them.
+func VerifyStates(rows []sagastore.State, want []StateExpect) []string {
+	var failures []string
+	for _, w := range want {
+		found := false
+		for _, r := range rows {
+			if r.Name == w.Name && r.Status.String == w.Status && r.IsCompensation() == w.Compensation {
+				found = true
+				break
+			}
+		}
+		if !found {
+			kind := "forward"
+			if w.Compensation {
+				kind = "compensation"
+			}
+			failures = append(failures, fmt.Sprintf("missing %s %s %s state", w.Status, w.Name, kind))
+		}
+	}
+
+	var unexpected []string
+	for _, r := range rows {
+		if !r.IsCompensation() {
+			continue
+		}
+		listed := false
+		for _, w := range want {
+			if w.Compensation && w.Name == r.Name {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			unexpected = append(unexpected, r.Name)
+		}
+	}
+	if len(unexpected) > 0 {
+		sort.Strings(unexpected)
+		failures = append(failures, fmt.Sprintf("unexpected compensation states present: %s", strings.Join(unexpected, ",")))
+	}
+	return failures
+}
+
+// VerifyTables compares the expected business rows column by column, using
+// the textual form of both sides.
+func VerifyTables(db *sql.DB, want []Row) ([]string, error) {
+	var failures []string
+	for _, row := range want {
+		columns := sortedColumns(row.Values)
+		keys := sortedColumns(row.Key)
+		conditions := make([]string, 0, len(keys))
+		args := make([]any, 0, len(keys))
+		for _, key := range keys {
+			conditions = append(conditions, key+"=?")
+			args = append(args, row.Key[key])
+		}
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE %s", strings.Join(columns, ", "), row.Table, strings.Join(conditions, " AND "))
+
+		got := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range got {
+			dest[i] = &got[i]
+		}
+		err := db.QueryRow(query, args...).Scan(dest...)
+		if errors.Is(err, sql.ErrNoRows) {
+			failures = append(failures, fmt.Sprintf("%s: row not found", row))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", row, err)
+		}
+		for i, column := range columns {
+			want := fmt.Sprint(row.Values[column])
+			value := "<NULL>"
+			if got[i].Valid {
+				value = got[i].String
+			}
+			if row.Values[column] == nil && !got[i].Valid {
+				continue
+			}
+			if value != want {
+				failures = append(failures, fmt.Sprintf("%s: %s=%s want=%s", row, column, value, want))
+			}
+		}
+	}
+	return failures, nil
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
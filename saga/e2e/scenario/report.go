@@ -0,0 +1,156 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scenario
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of one scenario run.
+type Result struct {
+	Name               string        `json:"name"`
+	File               string        `json:"file"`
+	XID                string        `json:"xid,omitempty"`
+	Status             string        `json:"status,omitempty"`
+	CompensationStatus string        `json:"compensationStatus,omitempty"`
+	Passed             bool          `json:"passed"`
+	Failures           []string      `json:"failures,omitempty"`
+	Error              string        `json:"error,omitempty"`
+	Duration           time.Duration `json:"-"`
+	DurationMillis     int64         `json:"durationMillis"`
+}
+
+// Problems returns the setup error, if any, followed by the validation
+// failures.
+func (r Result) Problems() []string {
+	if r.Error != "" {
+		return append([]string{r.Error}, r.Failures...)
+	}
+	return r.Failures
+}
+
+// Report collects the results of one runner invocation.
+type Report struct {
+	Suite   string    `json:"suite"`
+	Started time.Time `json:"started"`
+	Results []Result  `json:"results"`
+}
+
+// Add records r and derives its pass state.
+func (r *Report) Add(result Result) {
+	result.Passed = len(result.Problems()) == 0
+	result.DurationMillis = result.Duration.Milliseconds()
+	r.Results = append(r.Results, result)
+}
+
+// Failed counts the scenarios that did not pass.
+func (r *Report) Failed() int {
+	failed := 0
+	for _, result := range r.Results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(path string) error {
+	raw, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+type junitSuites struct {
+	XMLName xml.Name     `xml:"testsuites"`
+	Suites  []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report in the JUnit XML format understood by most
+// CI systems. Setup errors are reported as errors, validation mismatches as
+// failures.
+func (r *Report) WriteJUnit(path string) error {
+	suite := junitSuite{
+		Name:      r.Suite,
+		Tests:     len(r.Results),
+		Timestamp: r.Started.Format(time.RFC3339),
+	}
+	var total time.Duration
+	for _, result := range r.Results {
+		total += result.Duration
+		c := junitCase{
+			Name:      result.Name,
+			Classname: r.Suite,
+			Time:      seconds(result.Duration),
+		}
+		if result.XID != "" {
+			c.SystemOut = fmt.Sprintf("xid=%s status=%s compensationStatus=%s", result.XID, result.Status, result.CompensationStatus)
+		}
+		switch {
+		case result.Error != "":
+			suite.Errors++
+			c.Error = &junitMessage{Message: result.Error, Body: result.Error}
+		case len(result.Failures) > 0:
+			suite.Failures++
+			c.Failure = &junitMessage{Message: result.Failures[0], Body: strings.Join(result.Failures, "\n")}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+	suite.Time = seconds(total)
+
+	raw, err := xml.MarshalIndent(junitSuites{Suites: []junitSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append([]byte(xml.Header), append(raw, '\n')...), 0o644)
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
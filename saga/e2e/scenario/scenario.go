@@ -0,0 +1,276 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scenario loads declarative saga e2e scenarios from YAML files and
+// validates the rows a run leaves behind. A scenario declares the business
+// rows to seed, the parameters the state machine is started with, and the
+// expected machine, state and business rows.
+package scenario
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is one YAML scenario file.
+type Scenario struct {
+	Name         string         `yaml:"name"`
+	Description  string         `yaml:"description"`
+	StateMachine string         `yaml:"stateMachine"`
+	Seed         []Row          `yaml:"seed"`
+	Params       map[string]any `yaml:"params"`
+	Crash        *Crash         `yaml:"crash"`
+	Expect       Expect         `yaml:"expect"`
+
+	// File is the path the scenario was loaded from.
+	File string `yaml:"-"`
+}
+
+// Crash makes the process die before the action of state Before runs,
+// leaving the instance stuck, and then resumes it with Recovery: forward,
+// compensate or skip-and-forward. The instance is started with
+// params.businessKey as its business key so that it can be found again.
+type Crash struct {
+	Before   string `yaml:"before"`
+	Recovery string `yaml:"recovery"`
+}
+
+// Recovery operations, named as in scenario files and on the command line
+// of the recover tool.
+const (
+	Forward        = "forward"
+	Compensate     = "compensate"
+	SkipAndForward = "skip-and-forward"
+)
+
+// RecoveryOps lists the supported recovery operations.
+var RecoveryOps = []string{Forward, Compensate, SkipAndForward}
+
+// Row addresses one business table row by its key columns. In seed it is
+// upserted with Values; in expect its Values are compared column by column.
+type Row struct {
+	Table  string         `yaml:"table"`
+	Key    map[string]any `yaml:"key"`
+	Values map[string]any `yaml:"values"`
+}
+
+// Expect is the result a scenario must leave behind.
+type Expect struct {
+	Machine     MachineExpect      `yaml:"machine"`
+	States      []StateExpect      `yaml:"states"`
+	SubMachines []SubMachineExpect `yaml:"subMachines"`
+	Tables      []Row              `yaml:"tables"`
+}
+
+// SubMachineExpect is the instance the SubStateMachine state State
+// started, checked like the top-level machine and states.
+type SubMachineExpect struct {
+	State   string        `yaml:"state"`
+	Machine MachineExpect `yaml:"machine"`
+	States  []StateExpect `yaml:"states"`
+}
+
+// MachineExpect is the expected seata_state_machine_inst row. An empty
+// CompensationStatus matches both NULL and an empty column.
+type MachineExpect struct {
+	Status             string `yaml:"status"`
+	CompensationStatus string `yaml:"compensationStatus"`
+	NoException        bool   `yaml:"noException"`
+}
+
+// StateExpect is one seata_state_inst row that must be present. Compensation
+// marks rows that carry state_id_compensated_for. Compensation rows a
+// scenario does not list are reported as unexpected.
+type StateExpect struct {
+	Name         string `yaml:"name"`
+	Status       string `yaml:"status"`
+	Compensation bool   `yaml:"compensation"`
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Load reads and validates one scenario file. The scenario name defaults
+// to the file name without its extension.
+func Load(path string) (*Scenario, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	s.File = path
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Discover loads every *.yaml and *.yml file in dir, ordered by file name.
+func Discover(dir string) ([]*Scenario, error) {
+	var paths []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no scenario files in %s", dir)
+	}
+
+	scenarios := make([]*Scenario, 0, len(paths))
+	names := make(map[string]string)
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[s.Name]; ok {
+			return nil, fmt.Errorf("scenario %q is declared in both %s and %s", s.Name, other, path)
+		}
+		names[s.Name] = path
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// BusinessKey returns params.businessKey, or "" when it is not a string.
+func (s *Scenario) BusinessKey() string {
+	key, _ := s.Params["businessKey"].(string)
+	return key
+}
+
+// Find returns the scenario called name.
+func Find(scenarios []*Scenario, name string) (*Scenario, error) {
+	for _, s := range scenarios {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown scenario %q", name)
+}
+
+func (s *Scenario) validate() error {
+	if s.StateMachine == "" {
+		return fmt.Errorf("stateMachine is required")
+	}
+	if s.Expect.Machine.Status == "" {
+		return fmt.Errorf("expect.machine.status is required")
+	}
+	if s.Crash != nil {
+		if err := s.Crash.validate(); err != nil {
+			return fmt.Errorf("crash: %w", err)
+		}
+		if s.BusinessKey() == "" {
+			return fmt.Errorf("crash scenarios need params.businessKey")
+		}
+	}
+	for i, state := range s.Expect.States {
+		if state.Name == "" || state.Status == "" {
+			return fmt.Errorf("expect.states[%d]: name and status are required", i)
+		}
+	}
+	for i, sub := range s.Expect.SubMachines {
+		if sub.State == "" || sub.Machine.Status == "" {
+			return fmt.Errorf("expect.subMachines[%d]: state and machine.status are required", i)
+		}
+		for j, state := range sub.States {
+			if state.Name == "" || state.Status == "" {
+				return fmt.Errorf("expect.subMachines[%d].states[%d]: name and status are required", i, j)
+			}
+		}
+	}
+	for i, row := range s.Seed {
+		if err := row.validate(); err != nil {
+			return fmt.Errorf("seed[%d]: %w", i, err)
+		}
+	}
+	for i, row := range s.Expect.Tables {
+		if err := row.validate(); err != nil {
+			return fmt.Errorf("expect.tables[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Crash) validate() error {
+	if c.Before == "" {
+		return fmt.Errorf("before is required")
+	}
+	for _, recovery := range RecoveryOps {
+		if c.Recovery == recovery {
+			return nil
+		}
+	}
+	return fmt.Errorf("recovery %q, want one of %s", c.Recovery, strings.Join(RecoveryOps, ", "))
+}
+
+// validate rejects anything but plain identifiers, since table and column
+// names end up in SQL text.
+func (r Row) validate() error {
+	if !identifier.MatchString(r.Table) {
+		return fmt.Errorf("invalid table name %q", r.Table)
+	}
+	if len(r.Key) == 0 {
+		return fmt.Errorf("%s: key is required", r.Table)
+	}
+	if len(r.Values) == 0 {
+		return fmt.Errorf("%s: values are required", r.Table)
+	}
+	for _, columns := range []map[string]any{r.Key, r.Values} {
+		for column := range columns {
+			if !identifier.MatchString(column) {
+				return fmt.Errorf("%s: invalid column name %q", r.Table, column)
+			}
+		}
+	}
+	return nil
+}
+
+// String identifies the row in messages, e.g. e2e_inventory[product_id=p_s].
+func (r Row) String() string {
+	parts := make([]string, 0, len(r.Key))
+	for _, column := range sortedColumns(r.Key) {
+		parts = append(parts, fmt.Sprintf("%s=%v", column, r.Key[column]))
+	}
+	return fmt.Sprintf("%s[%s]", r.Table, strings.Join(parts, ","))
+}
+
+func sortedColumns(values map[string]any) []string {
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	return columns
+}
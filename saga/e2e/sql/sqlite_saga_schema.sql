@@ -0,0 +1,77 @@
+-- Licensed to the Apache Software Foundation (ASF) under one or more
+-- contributor license agreements.  See the NOTICE file distributed with
+-- this work for additional information regarding copyright ownership.
+-- The ASF licenses this file to You under the Apache License, Version 2.0
+-- (the "License"); you may not use this file except in compliance with
+-- the License.  You may obtain a copy of the License at
+--
+--     http://www.apache.org/licenses/LICENSE-2.0
+--
+-- Unless required by applicable law or agreed to in writing, software
+-- distributed under the License is distributed on an "AS IS" BASIS,
+-- WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+-- See the License for the specific language governing permissions and
+-- limitations under the License.
+
+-- Saga SQLite schema, the counterpart of mysql_saga_schema.sql. The e2e
+-- runner applies it when store_type is sqlite. The engine writes gmt_updated
+-- itself, so nothing replaces MySQL's ON UPDATE CURRENT_TIMESTAMP.
+
+CREATE TABLE IF NOT EXISTS seata_state_machine_def (
+  id varchar(128) NOT NULL PRIMARY KEY,
+  tenant_id varchar(32) DEFAULT NULL,
+  app_name varchar(64) DEFAULT NULL,
+  name varchar(128) NOT NULL,
+  status varchar(16) DEFAULT NULL,
+  gmt_create datetime DEFAULT CURRENT_TIMESTAMP,
+  ver varchar(16) DEFAULT NULL,
+  type varchar(32) DEFAULT NULL,
+  content text,
+  recover_strategy varchar(32) DEFAULT NULL,
+  comment_ varchar(255) DEFAULT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_smdef_name_tenant ON seata_state_machine_def (name, tenant_id);
+
+CREATE TABLE IF NOT EXISTS seata_state_machine_inst (
+  id varchar(128) NOT NULL PRIMARY KEY,
+  machine_id varchar(128) NOT NULL,
+  tenant_id varchar(32) DEFAULT NULL,
+  parent_id varchar(256) DEFAULT NULL,
+  gmt_started datetime DEFAULT CURRENT_TIMESTAMP,
+  gmt_end datetime DEFAULT NULL,
+  status varchar(16) DEFAULT NULL,
+  compensation_status varchar(16) DEFAULT NULL,
+  is_running tinyint(1) DEFAULT 0,
+  gmt_updated datetime DEFAULT CURRENT_TIMESTAMP,
+  business_key varchar(128) DEFAULT NULL,
+  start_params text,
+  end_params text,
+  excep blob
+);
+CREATE INDEX IF NOT EXISTS idx_sminst_machine ON seata_state_machine_inst (machine_id);
+CREATE INDEX IF NOT EXISTS idx_sminst_parent ON seata_state_machine_inst (parent_id);
+CREATE INDEX IF NOT EXISTS idx_sminst_bizkey_tenant ON seata_state_machine_inst (business_key, tenant_id);
+
+CREATE TABLE IF NOT EXISTS seata_state_inst (
+  id varchar(128) NOT NULL,
+  machine_inst_id varchar(128) NOT NULL,
+  name varchar(128) NOT NULL,
+  type varchar(32) NOT NULL,
+  gmt_started datetime DEFAULT CURRENT_TIMESTAMP,
+  service_name varchar(255) DEFAULT NULL,
+  service_method varchar(255) DEFAULT NULL,
+  service_type varchar(32) DEFAULT NULL,
+  is_for_update tinyint(1) DEFAULT 0,
+  input_params text,
+  status varchar(16) DEFAULT NULL,
+  business_key varchar(128) DEFAULT NULL,
+  state_id_compensated_for varchar(128) DEFAULT NULL,
+  state_id_retried_for varchar(128) DEFAULT NULL,
+  output_params text,
+  excep blob,
+  gmt_end datetime DEFAULT NULL,
+  gmt_updated datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_stinst_machine ON seata_state_inst (machine_inst_id);
+CREATE INDEX IF NOT EXISTS idx_stinst_name ON seata_state_inst (name);
@@ -34,6 +34,8 @@ const (
 	DefaultFundsPort      = "18083"
 	DefaultSurveyorPort   = "18084"
 	DefaultTransferPort   = "18085"
+
+	DefaultOrchestratorPort = "18080"
 )
 
 type Settings struct {
@@ -48,6 +50,13 @@ type Settings struct {
 	FundsPort      string
 	SurveyorPort   string
 	TransferPort   string
+
+	OrchestratorPort string
+
+	// LocalServices names the claim services the orchestrator runs
+	// in-process through the Saga local invoker instead of calling them
+	// over HTTP: a comma-separated list of ServiceName values, or "all".
+	LocalServices string
 }
 
 func LoadSettings() Settings {
@@ -62,6 +71,9 @@ func LoadSettings() Settings {
 		FundsPort:      envOrDefault("FUNDS_SERVICE_PORT", DefaultFundsPort),
 		SurveyorPort:   envOrDefault("SURVEYOR_SERVICE_PORT", DefaultSurveyorPort),
 		TransferPort:   envOrDefault("TRANSFER_SERVICE_PORT", DefaultTransferPort),
+
+		OrchestratorPort: envOrDefault("ORCHESTRATOR_PORT", DefaultOrchestratorPort),
+		LocalServices:    os.Getenv("CLAIM_LOCAL_SERVICES"),
 	}
 }
 
@@ -0,0 +1,48 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import "sync"
+
+// FaultHook is called inside the local transaction of every action, after the
+// business write and before the claim_step_log entry. Returning an error rolls
+// the whole transaction back, which lets checks prove that an action either
+// commits with its audit trail or leaves nothing behind.
+type FaultHook func(stepName string, actionName string) error
+
+var (
+	faultHookMu sync.RWMutex
+	faultHook   FaultHook
+)
+
+// SetFaultHook installs hook for all subsequent actions; nil removes it.
+func SetFaultHook(hook FaultHook) {
+	faultHookMu.Lock()
+	defer faultHookMu.Unlock()
+	faultHook = hook
+}
+
+func injectFault(stepName string, actionName string) error {
+	faultHookMu.RLock()
+	hook := faultHook
+	faultHookMu.RUnlock()
+	if hook == nil {
+		return nil
+	}
+	return hook(stepName, actionName)
+}
@@ -0,0 +1,74 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"database/sql"
+	"fmt"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/ledger"
+)
+
+// CheckClaimLedger proves that the claim's money is fully accounted for
+// after whatever outcome the Saga reached: the ledger balances against the
+// requested reservation, its split matches the reservation and transfer
+// status, and every policy's running balance matches its entries.
+func CheckClaimLedger(db *sql.DB, claimID string) error {
+	requested := 0
+	fundsStatus := "MISSING"
+	err := db.QueryRow(`SELECT amount, status FROM claim_fund_reservation WHERE claim_id = ?`, claimID).Scan(&requested, &fundsStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	transferStatus := "MISSING"
+	err = db.QueryRow(`SELECT status FROM claim_transfer WHERE claim_id = ?`, claimID).Scan(&transferStatus)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err := ledger.CheckClaim(db, claimID, requested); err != nil {
+		return err
+	}
+	balance, err := ledger.ClaimBalance(db, claimID)
+	if err != nil {
+		return err
+	}
+
+	var problem string
+	switch fundsStatus {
+	case "RESERVED":
+		if balance.Reserved != requested {
+			problem = "an open reservation must still hold the requested amount"
+		}
+	case "CAPTURED":
+		if balance.Reserved != 0 || balance.Captured == 0 {
+			problem = "a captured reservation must be paid out and hold nothing back"
+		}
+	case "RELEASED":
+		if balance.Reserved != 0 || balance.Captured != 0 {
+			problem = "a released reservation must return everything and pay nothing"
+		}
+	}
+	if (transferStatus == "SUCCESS") != (fundsStatus == "CAPTURED") {
+		problem = "a successful transfer and a captured reservation must go together"
+	}
+	if problem != "" {
+		return fmt.Errorf("claim %s: funds.status=%s transfer.status=%s %s: %s", claimID, fundsStatus, transferStatus, balance, problem)
+	}
+	return ledger.CheckPolicies(db)
+}
@@ -0,0 +1,70 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package app
+
+import (
+	"database/sql"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+// MachineStatus is the persisted state of one Saga instance as recorded by
+// the engine in seata_state_machine_inst.
+type MachineStatus struct {
+	XID                string `json:"xid"`
+	BusinessKey        string `json:"businessKey"`
+	Status             string `json:"status"`
+	CompensationStatus string `json:"compensationStatus"`
+	IsRunning          bool   `json:"isRunning"`
+}
+
+// NewMachineStatus is the API view of an instance row read by sagastore.
+func NewMachineStatus(m sagastore.Machine) MachineStatus {
+	return MachineStatus{
+		XID:                m.ID,
+		BusinessKey:        m.BusinessKey.String,
+		Status:             m.Status.String,
+		CompensationStatus: m.CompensationStatus.String,
+		IsRunning:          m.IsRunning,
+	}
+}
+
+// FindBusinessKey returns the business key a claim was processed under,
+// based on the step log written by the services.
+func FindBusinessKey(db *sql.DB, claimID string) (string, error) {
+	var businessKey string
+	err := db.QueryRow(`SELECT business_key FROM claim_step_log WHERE claim_id = ? ORDER BY id LIMIT 1`, claimID).Scan(&businessKey)
+	return businessKey, err
+}
+
+// CompletionEvent is the body the orchestrator POSTs to a completion callback
+// once an asynchronously started claim has left the running state.
+type CompletionEvent struct {
+	ClaimID            string   `json:"claimId"`
+	BusinessKey        string   `json:"businessKey"`
+	XID                string   `json:"xid"`
+	Status             string   `json:"status"`
+	CompensationStatus string   `json:"compensationStatus"`
+	Snapshot           Snapshot `json:"snapshot"`
+}
+
+// Finished reports whether the engine has stopped driving the instance,
+// including any compensation triggered by a failed step.
+func (s MachineStatus) Finished() bool {
+	return !s.IsRunning && s.Status != "" && s.Status != "RU" && s.CompensationStatus != "RU"
+}
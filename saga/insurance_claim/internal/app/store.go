@@ -19,23 +19,79 @@ package app
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/ledger"
 )
 
 type Snapshot struct {
-	IdentityVerified   bool
-	AssessmentStatus   string
-	FundsStatus        string
-	FundsAmount        int
-	SurveyorStatus     string
-	TransferStatus     string
-	TransferLastError  string
-	OrderedActionTrail []string
+	IdentityVerified   bool           `json:"identityVerified"`
+	AssessmentStatus   string         `json:"assessmentStatus"`
+	FundsStatus        string         `json:"fundsStatus"`
+	FundsAmount        int            `json:"fundsAmount"`
+	FundsPolicyID      string         `json:"fundsPolicyId"`
+	FundsLedger        ledger.Balance `json:"fundsLedger"`
+	SurveyorStatus     string         `json:"surveyorStatus"`
+	TransferStatus     string         `json:"transferStatus"`
+	TransferLastError  string         `json:"transferLastError"`
+	TransferAttempts   int            `json:"transferAttempts"`
+	OrderedActionTrail []string       `json:"orderedActionTrail"`
+}
+
+const (
+	outcomeSucceeded     = "SUCCEEDED"
+	outcomeFailed        = "FAILED"
+	outcomeEmptyRollback = "EMPTY_ROLLBACK"
+	outcomeRejected      = "REJECTED"
+
+	compensateAction = "compensate"
+)
+
+// ErrForwardRejected is returned when a forward action arrives after the
+// compensation of its step has already run. The late call is recorded as a
+// rejected no-op so that it cannot resurrect compensated business state.
+var ErrForwardRejected = errors.New("FORWARD_REJECTED_AFTER_COMPENSATION")
+
+// OutcomeError is a business failure that belongs to the recorded outcome of
+// an action. It is stored with the action record and returned again to every
+// replayed call, unlike infrastructure errors which leave no record behind.
+type OutcomeError struct {
+	Message string
+}
+
+func (e *OutcomeError) Error() string {
+	return e.Message
+}
+
+// RetryableError is a transient failure of a forward action. The attempt and
+// its step log entry are committed, but no action record is written, so the
+// engine's forward retry runs the action again instead of replaying the error.
+type RetryableError struct {
+	Message string
+}
+
+func (e *RetryableError) Error() string {
+	return e.Message
 }
 
+// Bank transfer failures. The first two are transient and retried by the
+// Saga; the last two are terminal and trigger compensation.
+const (
+	TransferBankUnavailable = "BANK_UNAVAILABLE"
+	TransferBankTimeout     = "BANK_TIMEOUT"
+	TransferAccountInvalid  = "ACCOUNT_INVALID"
+	TransferFailed          = "BANK_TRANSFER_FAILED"
+	TransferNotReserved     = "FUNDS_NOT_RESERVED"
+)
+
+// DefaultPolicyID is charged for reservations that do not name a policy,
+// such as calls from state language files written before the ledger existed.
+const DefaultPolicyID = "policy-5001"
+
 func OpenDB() (*sql.DB, error) {
 	settings := LoadSettings()
 	db, err := sql.Open("mysql", settings.MySQLDSN())
@@ -68,6 +124,7 @@ func EnsureBusinessSchema(db *sql.DB) error {
 		`CREATE TABLE IF NOT EXISTS claim_fund_reservation (
 			claim_id VARCHAR(64) PRIMARY KEY,
 			business_key VARCHAR(64) NOT NULL,
+			policy_id VARCHAR(64) NOT NULL DEFAULT '',
 			amount INT NOT NULL,
 			status VARCHAR(32) NOT NULL,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
@@ -86,6 +143,7 @@ func EnsureBusinessSchema(db *sql.DB) error {
 			amount INT NOT NULL,
 			status VARCHAR(32) NOT NULL,
 			last_error VARCHAR(255) NOT NULL DEFAULT '',
+			attempts INT NOT NULL DEFAULT 0,
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
 		`CREATE TABLE IF NOT EXISTS claim_step_log (
@@ -95,17 +153,81 @@ func EnsureBusinessSchema(db *sql.DB) error {
 			step_name VARCHAR(64) NOT NULL,
 			action_name VARCHAR(64) NOT NULL,
 			note VARCHAR(255) NOT NULL DEFAULT '',
-			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			KEY idx_claim_step_log_claim (claim_id),
+			KEY idx_claim_step_log_biz (business_key)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS claim_action_record (
+			business_key VARCHAR(64) NOT NULL,
+			step_name VARCHAR(64) NOT NULL,
+			action_name VARCHAR(64) NOT NULL,
+			claim_id VARCHAR(64) NOT NULL,
+			outcome VARCHAR(16) NOT NULL,
+			message VARCHAR(255) NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (business_key, step_name, action_name),
+			KEY idx_claim_action_record_claim (claim_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+		`CREATE TABLE IF NOT EXISTS claim_step_fence (
+			business_key VARCHAR(64) NOT NULL,
+			step_name VARCHAR(64) NOT NULL,
+			claim_id VARCHAR(64) NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (business_key, step_name),
+			KEY idx_claim_step_fence_claim (claim_id)
 		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
 	}
+	statements = append(statements, ledger.Schema...)
 	for _, statement := range statements {
 		if _, err := db.Exec(statement); err != nil {
 			return err
 		}
 	}
+	if err := ensureColumn(db, "claim_fund_reservation", "policy_id", "VARCHAR(64) NOT NULL DEFAULT '' AFTER business_key"); err != nil {
+		return err
+	}
+	if err := ensureColumn(db, "claim_transfer", "attempts", "INT NOT NULL DEFAULT 0 AFTER last_error"); err != nil {
+		return err
+	}
+	indexes := []struct{ table, name, columns string }{
+		{"claim_step_log", "idx_claim_step_log_claim", "claim_id"},
+		{"claim_step_log", "idx_claim_step_log_biz", "business_key"},
+		{"claim_action_record", "idx_claim_action_record_claim", "claim_id"},
+	}
+	for _, index := range indexes {
+		if err := ensureIndex(db, index.table, index.name, index.columns); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// ensureColumn adds a column that was introduced after the table was first
+// created, so existing sample databases keep working without a manual migration.
+func ensureColumn(db *sql.DB, table string, column string, definition string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`,
+		table, column).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// ensureIndex adds an index that tables created by an earlier version of
+// EnsureBusinessSchema lack, so they match sql/mysql_claim_saga_schema.sql.
+func ensureIndex(db *sql.DB, table string, name string, columns string) error {
+	var count int
+	err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`,
+		table, name).Scan(&count)
+	if err != nil || count > 0 {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD KEY %s (%s)", table, name, columns))
+	return err
+}
+
 func EnsureSagaStoreSchema(db *sql.DB) error {
 	statements := []string{
 		`ALTER TABLE seata_state_machine_def
@@ -128,8 +250,13 @@ func EnsureSagaStoreSchema(db *sql.DB) error {
 }
 
 func ResetClaimData(db *sql.DB, businessKey string, claimID string) error {
+	if err := ledger.DeleteClaim(db, claimID); err != nil {
+		return err
+	}
 	statements := []string{
 		"DELETE FROM claim_step_log WHERE business_key = ? OR claim_id = ?",
+		"DELETE FROM claim_action_record WHERE business_key = ? OR claim_id = ?",
+		"DELETE FROM claim_step_fence WHERE business_key = ? OR claim_id = ?",
 		"DELETE FROM claim_transfer WHERE claim_id = ?",
 		"DELETE FROM claim_surveyor_notice WHERE claim_id = ?",
 		"DELETE FROM claim_fund_reservation WHERE claim_id = ?",
@@ -138,7 +265,7 @@ func ResetClaimData(db *sql.DB, businessKey string, claimID string) error {
 	}
 	for index, statement := range statements {
 		var err error
-		if index == 0 {
+		if index < 3 {
 			_, err = db.Exec(statement, businessKey, claimID)
 		} else {
 			_, err = db.Exec(statement, claimID)
@@ -151,94 +278,240 @@ func ResetClaimData(db *sql.DB, businessKey string, claimID string) error {
 }
 
 func RecordIdentityVerified(db *sql.DB, businessKey string, claimID string, claimantID string) error {
-	query := `INSERT INTO claim_identity(claim_id, business_key, claimant_id, verified)
-		VALUES(?, ?, ?, 1)
-		ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), claimant_id = VALUES(claimant_id), verified = 1`
-	if _, err := db.Exec(query, claimID, businessKey, claimantID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "identity", "verify", "claimant verified")
+	return runOnce(db, businessKey, claimID, "identity", "verify", func(tx *sql.Tx) (string, error) {
+		query := `INSERT INTO claim_identity(claim_id, business_key, claimant_id, verified)
+			VALUES(?, ?, ?, 1)
+			ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), claimant_id = VALUES(claimant_id), verified = 1`
+		if _, err := tx.Exec(query, claimID, businessKey, claimantID); err != nil {
+			return "", err
+		}
+		return "claimant verified", nil
+	})
 }
 
 func UnverifyIdentity(db *sql.DB, businessKey string, claimID string) error {
-	if _, err := db.Exec(`UPDATE claim_identity SET verified = 0 WHERE claim_id = ?`, claimID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "identity", "compensate", "claimant verification rolled back")
+	return runOnce(db, businessKey, claimID, "identity", "compensate", func(tx *sql.Tx) (string, error) {
+		if _, err := tx.Exec(`UPDATE claim_identity SET verified = 0 WHERE claim_id = ?`, claimID); err != nil {
+			return "", err
+		}
+		return "claimant verification rolled back", nil
+	})
 }
 
 func CreateAssessment(db *sql.DB, businessKey string, claimID string, assessmentID string) error {
-	query := `INSERT INTO claim_assessment(claim_id, business_key, assessment_id, status)
-		VALUES(?, ?, ?, 'CREATED')
-		ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), assessment_id = VALUES(assessment_id), status = 'CREATED'`
-	if _, err := db.Exec(query, claimID, businessKey, assessmentID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "assessment", "create", "damage assessment created")
+	return runOnce(db, businessKey, claimID, "assessment", "create", func(tx *sql.Tx) (string, error) {
+		query := `INSERT INTO claim_assessment(claim_id, business_key, assessment_id, status)
+			VALUES(?, ?, ?, 'CREATED')
+			ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), assessment_id = VALUES(assessment_id), status = 'CREATED'`
+		if _, err := tx.Exec(query, claimID, businessKey, assessmentID); err != nil {
+			return "", err
+		}
+		return "damage assessment created", nil
+	})
 }
 
 func DeleteAssessment(db *sql.DB, businessKey string, claimID string) error {
-	if _, err := db.Exec(`DELETE FROM claim_assessment WHERE claim_id = ?`, claimID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "assessment", "compensate", "damage assessment deleted")
+	return runOnce(db, businessKey, claimID, "assessment", "compensate", func(tx *sql.Tx) (string, error) {
+		if _, err := tx.Exec(`DELETE FROM claim_assessment WHERE claim_id = ?`, claimID); err != nil {
+			return "", err
+		}
+		return "damage assessment deleted", nil
+	})
 }
 
-func ReserveFunds(db *sql.DB, businessKey string, claimID string, amount int) error {
-	query := `INSERT INTO claim_fund_reservation(claim_id, business_key, amount, status)
-		VALUES(?, ?, ?, 'RESERVED')
-		ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), amount = VALUES(amount), status = 'RESERVED'`
-	if _, err := db.Exec(query, claimID, businessKey, amount); err != nil {
-		return err
+// ReserveFunds moves amount from the policy's available funds into the
+// claim's reservation.
+func ReserveFunds(db *sql.DB, businessKey string, claimID string, policyID string, amount int) error {
+	if policyID == "" {
+		policyID = DefaultPolicyID
 	}
-	return appendStepLog(db, businessKey, claimID, "funds", "reserve", fmt.Sprintf("reserved payout amount=%d", amount))
+	return runOnce(db, businessKey, claimID, "funds", "reserve", func(tx *sql.Tx) (string, error) {
+		query := `INSERT INTO claim_fund_reservation(claim_id, business_key, policy_id, amount, status)
+			VALUES(?, ?, ?, ?, 'RESERVED')
+			ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), policy_id = VALUES(policy_id), amount = VALUES(amount), status = 'RESERVED'`
+		if _, err := tx.Exec(query, claimID, businessKey, policyID, amount); err != nil {
+			return "", err
+		}
+		entry := ledger.Entry{PolicyID: policyID, ClaimID: claimID, BusinessKey: businessKey, Type: ledger.EntryReserve, Amount: amount}
+		if err := ledger.Post(tx, entry); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("reserved payout policy=%s amount=%d", policyID, amount), nil
+	})
 }
 
+// ReleaseFunds returns whatever is still reserved for the claim. A
+// reservation the bank transfer has already captured is left as it is.
+//
+// ExecuteBankTransfer has no compensation of its own, so a transfer whose
+// retries ran out is still RETRYING when the claim is compensated. Releasing
+// the reservation ends any chance of paying it, so the transfer is closed as
+// FAILED here, keeping its last error and attempt count.
 func ReleaseFunds(db *sql.DB, businessKey string, claimID string) error {
-	if _, err := db.Exec(`UPDATE claim_fund_reservation SET status = 'RELEASED' WHERE claim_id = ?`, claimID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "funds", "compensate", "reserved payout released")
+	return runOnce(db, businessKey, claimID, "funds", "compensate", func(tx *sql.Tx) (string, error) {
+		closed, err := tx.Exec(`UPDATE claim_transfer SET status = 'FAILED' WHERE claim_id = ? AND status = 'RETRYING'`, claimID)
+		if err != nil {
+			return "", err
+		}
+		transferNote := ""
+		if n, err := closed.RowsAffected(); err != nil {
+			return "", err
+		} else if n > 0 {
+			transferNote = ", retrying transfer closed as FAILED"
+		}
+
+		var policyID string
+		var status string
+		if err := tx.QueryRow(`SELECT policy_id, status FROM claim_fund_reservation WHERE claim_id = ? FOR UPDATE`, claimID).Scan(&policyID, &status); err != nil {
+			return "", err
+		}
+		if status == "CAPTURED" {
+			return "reserved payout already captured, nothing to release" + transferNote, nil
+		}
+		balance, err := ledger.ClaimBalance(tx, claimID)
+		if err != nil {
+			return "", err
+		}
+		if balance.Reserved > 0 {
+			entry := ledger.Entry{PolicyID: policyID, ClaimID: claimID, BusinessKey: businessKey, Type: ledger.EntryRelease, Amount: balance.Reserved}
+			if err := ledger.Post(tx, entry); err != nil {
+				return "", err
+			}
+		}
+		if _, err := tx.Exec(`UPDATE claim_fund_reservation SET status = 'RELEASED' WHERE claim_id = ?`, claimID); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("reserved payout released amount=%d%s", balance.Reserved, transferNote), nil
+	})
 }
 
 func NotifySurveyor(db *sql.DB, businessKey string, claimID string, surveyorID string) error {
-	query := `INSERT INTO claim_surveyor_notice(claim_id, business_key, surveyor_id, status)
-		VALUES(?, ?, ?, 'NOTIFIED')
-		ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), surveyor_id = VALUES(surveyor_id), status = 'NOTIFIED'`
-	if _, err := db.Exec(query, claimID, businessKey, surveyorID); err != nil {
-		return err
-	}
-	return appendStepLog(db, businessKey, claimID, "surveyor", "notify", "assigned surveyor notified")
+	return runOnce(db, businessKey, claimID, "surveyor", "notify", func(tx *sql.Tx) (string, error) {
+		query := `INSERT INTO claim_surveyor_notice(claim_id, business_key, surveyor_id, status)
+			VALUES(?, ?, ?, 'NOTIFIED')
+			ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), surveyor_id = VALUES(surveyor_id), status = 'NOTIFIED'`
+		if _, err := tx.Exec(query, claimID, businessKey, surveyorID); err != nil {
+			return "", err
+		}
+		return "assigned surveyor notified", nil
+	})
 }
 
 func CancelSurveyorNotification(db *sql.DB, businessKey string, claimID string) error {
-	if _, err := db.Exec(`UPDATE claim_surveyor_notice SET status = 'CANCELED' WHERE claim_id = ?`, claimID); err != nil {
+	return runOnce(db, businessKey, claimID, "surveyor", "compensate", func(tx *sql.Tx) (string, error) {
+		if _, err := tx.Exec(`UPDATE claim_surveyor_notice SET status = 'CANCELED' WHERE claim_id = ?`, claimID); err != nil {
+			return "", err
+		}
+		return "surveyor notification canceled", nil
+	})
+}
+
+// ExecuteTransfer pays the claim out. transferFaults is a comma-separated
+// list of simulated bank responses, one per attempt: "503" and "timeout" are
+// transient, "invalid" rejects the account, and an empty entry or an attempt
+// past the end of the list reaches the bank normally.
+func ExecuteTransfer(db *sql.DB, businessKey string, claimID string, bankAccount string, amount int, failTransfer bool, transferFaults string) error {
+	return runOnce(db, businessKey, claimID, "transfer", "execute", func(tx *sql.Tx) (string, error) {
+		var attempts int
+		err := tx.QueryRow(`SELECT attempts FROM claim_transfer WHERE claim_id = ? FOR UPDATE`, claimID).Scan(&attempts)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		attempt := attempts + 1
+
+		var policyID string
+		var reserved ledger.Balance
+		err = tx.QueryRow(`SELECT policy_id FROM claim_fund_reservation WHERE claim_id = ? AND status = 'RESERVED' FOR UPDATE`, claimID).Scan(&policyID)
+		if err != nil && err != sql.ErrNoRows {
+			return "", err
+		}
+		if err == nil {
+			if reserved, err = ledger.ClaimBalance(tx, claimID); err != nil {
+				return "", err
+			}
+		}
+
+		status := "SUCCESS"
+		var outcomeErr error
+		switch fault := transferFault(transferFaults, attempt); {
+		case reserved.Reserved < amount:
+			status = "FAILED"
+			outcomeErr = &OutcomeError{Message: TransferNotReserved}
+		case fault == "503":
+			status = "RETRYING"
+			outcomeErr = &RetryableError{Message: TransferBankUnavailable}
+		case fault == "timeout":
+			status = "RETRYING"
+			outcomeErr = &RetryableError{Message: TransferBankTimeout}
+		case fault == "invalid" || !validBankAccount(bankAccount):
+			status = "FAILED"
+			outcomeErr = &OutcomeError{Message: TransferAccountInvalid}
+		case failTransfer:
+			status = "FAILED"
+			outcomeErr = &OutcomeError{Message: TransferFailed}
+		}
+		lastError := ""
+		if outcomeErr != nil {
+			lastError = outcomeErr.Error()
+		}
+
+		query := `INSERT INTO claim_transfer(claim_id, business_key, bank_account, amount, status, last_error, attempts)
+			VALUES(?, ?, ?, ?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), bank_account = VALUES(bank_account), amount = VALUES(amount), status = VALUES(status), last_error = VALUES(last_error), attempts = VALUES(attempts)`
+		if _, err := tx.Exec(query, claimID, businessKey, bankAccount, amount, status, lastError, attempt); err != nil {
+			return "", err
+		}
+		if outcomeErr == nil {
+			if err := captureReservation(tx, businessKey, claimID, policyID, amount, reserved.Reserved); err != nil {
+				return "", err
+			}
+		}
+		note := fmt.Sprintf("bank transfer amount=%d attempt=%d status=%s", amount, attempt, status)
+		if lastError != "" {
+			note += " error=" + lastError
+		}
+		return note, outcomeErr
+	})
+}
+
+// captureReservation books the paid amount against the reservation and
+// releases any remainder when the claim settled for less than was reserved.
+func captureReservation(tx *sql.Tx, businessKey string, claimID string, policyID string, amount int, reserved int) error {
+	entry := ledger.Entry{PolicyID: policyID, ClaimID: claimID, BusinessKey: businessKey, Type: ledger.EntryCapture, Amount: amount}
+	if err := ledger.Post(tx, entry); err != nil {
 		return err
 	}
-	return appendStepLog(db, businessKey, claimID, "surveyor", "compensate", "surveyor notification canceled")
+	if remainder := reserved - amount; remainder > 0 {
+		entry = ledger.Entry{PolicyID: policyID, ClaimID: claimID, BusinessKey: businessKey, Type: ledger.EntryPartialRelease, Amount: remainder}
+		if err := ledger.Post(tx, entry); err != nil {
+			return err
+		}
+	}
+	_, err := tx.Exec(`UPDATE claim_fund_reservation SET status = 'CAPTURED' WHERE claim_id = ?`, claimID)
+	return err
 }
 
-func ExecuteTransfer(db *sql.DB, businessKey string, claimID string, bankAccount string, amount int, failTransfer bool) error {
-	status := "SUCCESS"
-	lastError := ""
-	if failTransfer {
-		status = "FAILED"
-		lastError = "BANK_TRANSFER_FAILED"
+func transferFault(transferFaults string, attempt int) string {
+	if transferFaults == "" {
+		return ""
 	}
-	query := `INSERT INTO claim_transfer(claim_id, business_key, bank_account, amount, status, last_error)
-		VALUES(?, ?, ?, ?, ?, ?)
-		ON DUPLICATE KEY UPDATE business_key = VALUES(business_key), bank_account = VALUES(bank_account), amount = VALUES(amount), status = VALUES(status), last_error = VALUES(last_error)`
-	if _, err := db.Exec(query, claimID, businessKey, bankAccount, amount, status, lastError); err != nil {
-		return err
+	faults := strings.Split(transferFaults, ",")
+	if attempt > len(faults) {
+		return ""
 	}
-	note := fmt.Sprintf("bank transfer amount=%d status=%s", amount, status)
-	if err := appendStepLog(db, businessKey, claimID, "transfer", "execute", note); err != nil {
-		return err
+	return strings.TrimSpace(faults[attempt-1])
+}
+
+func validBankAccount(bankAccount string) bool {
+	if len(bankAccount) < 12 || len(bankAccount) > 19 {
+		return false
 	}
-	if failTransfer {
-		return fmt.Errorf("BANK_TRANSFER_FAILED")
+	for _, r := range bankAccount {
+		if r < '0' || r > '9' {
+			return false
+		}
 	}
-	return nil
+	return true
 }
 
 func LoadSnapshot(db *sql.DB, claimID string) (Snapshot, error) {
@@ -256,13 +529,18 @@ func LoadSnapshot(db *sql.DB, claimID string) (Snapshot, error) {
 	if err := db.QueryRow(`SELECT status FROM claim_assessment WHERE claim_id = ?`, claimID).Scan(&snapshot.AssessmentStatus); err != nil && err != sql.ErrNoRows {
 		return snapshot, err
 	}
-	if err := db.QueryRow(`SELECT status, amount FROM claim_fund_reservation WHERE claim_id = ?`, claimID).Scan(&snapshot.FundsStatus, &snapshot.FundsAmount); err != nil && err != sql.ErrNoRows {
+	if err := db.QueryRow(`SELECT status, amount, policy_id FROM claim_fund_reservation WHERE claim_id = ?`, claimID).Scan(&snapshot.FundsStatus, &snapshot.FundsAmount, &snapshot.FundsPolicyID); err != nil && err != sql.ErrNoRows {
+		return snapshot, err
+	}
+	fundsLedger, err := ledger.ClaimBalance(db, claimID)
+	if err != nil {
 		return snapshot, err
 	}
+	snapshot.FundsLedger = fundsLedger
 	if err := db.QueryRow(`SELECT status FROM claim_surveyor_notice WHERE claim_id = ?`, claimID).Scan(&snapshot.SurveyorStatus); err != nil && err != sql.ErrNoRows {
 		return snapshot, err
 	}
-	if err := db.QueryRow(`SELECT status, last_error FROM claim_transfer WHERE claim_id = ?`, claimID).Scan(&snapshot.TransferStatus, &snapshot.TransferLastError); err != nil && err != sql.ErrNoRows {
+	if err := db.QueryRow(`SELECT status, last_error, attempts FROM claim_transfer WHERE claim_id = ?`, claimID).Scan(&snapshot.TransferStatus, &snapshot.TransferLastError, &snapshot.TransferAttempts); err != nil && err != sql.ErrNoRows {
 		return snapshot, err
 	}
 
@@ -291,9 +569,10 @@ func FormatSnapshot(snapshot Snapshot) string {
 	lines := []string{
 		fmt.Sprintf("identity.verified=%t", snapshot.IdentityVerified),
 		fmt.Sprintf("assessment.status=%s", snapshot.AssessmentStatus),
-		fmt.Sprintf("funds.status=%s amount=%d", snapshot.FundsStatus, snapshot.FundsAmount),
+		fmt.Sprintf("funds.status=%s amount=%d policy=%s", snapshot.FundsStatus, snapshot.FundsAmount, snapshot.FundsPolicyID),
+		fmt.Sprintf("funds.ledger %s", snapshot.FundsLedger),
 		fmt.Sprintf("surveyor.status=%s", snapshot.SurveyorStatus),
-		fmt.Sprintf("transfer.status=%s lastError=%s", snapshot.TransferStatus, snapshot.TransferLastError),
+		fmt.Sprintf("transfer.status=%s lastError=%s attempts=%d", snapshot.TransferStatus, snapshot.TransferLastError, snapshot.TransferAttempts),
 	}
 	if len(snapshot.OrderedActionTrail) == 0 {
 		lines = append(lines, "actionTrail=<empty>")
@@ -303,8 +582,162 @@ func FormatSnapshot(snapshot Snapshot) string {
 	return strings.Join(lines, "\n")
 }
 
-func appendStepLog(db *sql.DB, businessKey string, claimID string, stepName string, actionName string, note string) error {
-	_, err := db.Exec(`INSERT INTO claim_step_log(business_key, claim_id, step_name, action_name, note) VALUES(?, ?, ?, ?, ?)`,
+func appendStepLog(tx *sql.Tx, businessKey string, claimID string, stepName string, actionName string, note string) error {
+	_, err := tx.Exec(`INSERT INTO claim_step_log(business_key, claim_id, step_name, action_name, note) VALUES(?, ?, ?, ?, ?)`,
 		businessKey, claimID, stepName, actionName, note)
 	return err
 }
+
+// actionFunc performs the business write of one action inside tx and returns
+// the note for its claim_step_log entry. An *OutcomeError still commits: the
+// failure is part of the action outcome.
+type actionFunc func(tx *sql.Tx) (string, error)
+
+// runOnce executes action at most once per (businessKey, stepName, actionName).
+// A retried call finds the recorded outcome in claim_action_record and gets
+// the same result back without touching any business table again.
+//
+// Compensations and forward actions of the same step also guard each other,
+// like the TCC fence does: a compensation whose forward action never committed
+// is recorded as an empty rollback, and a forward action arriving after its
+// compensation is recorded as rejected. Both decisions are taken while holding
+// the claim_step_fence row of the step, so a concurrent forward action and
+// compensation of one step run one after the other whatever the isolation
+// level.
+//
+// A RetryableError commits the attempt and its step log entry without an
+// action record, leaving the action open for the next forward retry.
+//
+// The business write, its claim_step_log entry and the action record commit in
+// one local transaction, so a crash in between leaves none of them behind.
+func runOnce(db *sql.DB, businessKey string, claimID string, stepName string, actionName string, action actionFunc) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err := lockStep(tx, businessKey, claimID, stepName); err != nil {
+		return err
+	}
+
+	var outcome string
+	var message string
+	err = tx.QueryRow(`SELECT outcome, message FROM claim_action_record WHERE business_key = ? AND step_name = ? AND action_name = ? FOR UPDATE`,
+		businessKey, stepName, actionName).Scan(&outcome, &message)
+	if err == nil {
+		return replayOutcome(outcome, message)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var note string
+	var actionErr error
+	outcome = outcomeSucceeded
+	message = ""
+	if actionName == compensateAction {
+		var committedForward bool
+		committedForward, err = forwardCommitted(tx, businessKey, stepName)
+		if err != nil {
+			return err
+		}
+		if !committedForward {
+			outcome = outcomeEmptyRollback
+			note = "empty rollback, forward action never committed"
+		}
+	} else {
+		var compensated bool
+		compensated, err = actionRecorded(tx, businessKey, stepName, compensateAction)
+		if err != nil {
+			return err
+		}
+		if compensated {
+			outcome = outcomeRejected
+			message = ErrForwardRejected.Error()
+			note = "late forward call rejected after compensation"
+			actionErr = ErrForwardRejected
+		}
+	}
+
+	retryable := false
+	if outcome == outcomeSucceeded {
+		note, actionErr = action(tx)
+		if actionErr != nil {
+			var outcomeErr *OutcomeError
+			var retryErr *RetryableError
+			switch {
+			case errors.As(actionErr, &outcomeErr):
+				outcome = outcomeFailed
+				message = outcomeErr.Message
+			case errors.As(actionErr, &retryErr):
+				retryable = true
+			default:
+				return actionErr
+			}
+		}
+	}
+	if err := injectFault(stepName, actionName); err != nil {
+		return err
+	}
+	if err := appendStepLog(tx, businessKey, claimID, stepName, actionName, note); err != nil {
+		return err
+	}
+	if !retryable {
+		if err := recordOutcome(tx, businessKey, claimID, stepName, actionName, outcome, message); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed = true
+	return actionErr
+}
+
+// lockStep creates the claim_step_fence row of the step on first use and
+// locks it until tx ends, the way fence.WithFence keys every phase of a
+// branch on its one tcc_fence_log record. ON DUPLICATE KEY UPDATE takes the
+// exclusive lock directly when the row exists; INSERT IGNORE followed by
+// SELECT ... FOR UPDATE would take a shared lock first, and two callers
+// upgrading it would deadlock.
+func lockStep(tx *sql.Tx, businessKey string, claimID string, stepName string) error {
+	_, err := tx.Exec(`INSERT INTO claim_step_fence(business_key, step_name, claim_id) VALUES(?, ?, ?) ON DUPLICATE KEY UPDATE claim_id = claim_id`,
+		businessKey, stepName, claimID)
+	return err
+}
+
+func forwardCommitted(tx *sql.Tx, businessKey string, stepName string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM claim_action_record WHERE business_key = ? AND step_name = ? AND action_name <> ? AND outcome = ?`,
+		businessKey, stepName, compensateAction, outcomeSucceeded).Scan(&count)
+	return count > 0, err
+}
+
+func actionRecorded(tx *sql.Tx, businessKey string, stepName string, actionName string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM claim_action_record WHERE business_key = ? AND step_name = ? AND action_name = ?`,
+		businessKey, stepName, actionName).Scan(&count)
+	return count > 0, err
+}
+
+func recordOutcome(tx *sql.Tx, businessKey string, claimID string, stepName string, actionName string, outcome string, message string) error {
+	_, err := tx.Exec(`INSERT INTO claim_action_record(business_key, step_name, action_name, claim_id, outcome, message) VALUES(?, ?, ?, ?, ?, ?)`,
+		businessKey, stepName, actionName, claimID, outcome, message)
+	return err
+}
+
+func replayOutcome(outcome string, message string) error {
+	switch outcome {
+	case outcomeFailed:
+		return &OutcomeError{Message: message}
+	case outcomeRejected:
+		return ErrForwardRejected
+	}
+	return nil
+}
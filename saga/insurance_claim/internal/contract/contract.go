@@ -0,0 +1,254 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package contract defines the named request and response bodies of the
+// insurance claim services and maps action errors to structured HTTP errors.
+package contract
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+)
+
+const (
+	CodeForwardRejected = "FORWARD_REJECTED_AFTER_COMPENSATION"
+	CodeInternal        = "INTERNAL_ERROR"
+)
+
+type VerifyIdentityRequest struct {
+	BusinessKey string `json:"businessKey"`
+	ClaimID     string `json:"claimId"`
+	ClaimantID  string `json:"claimantId"`
+}
+
+func (VerifyIdentityRequest) Fields() []string {
+	return []string{"businessKey", "claimId", "claimantId"}
+}
+
+func (r VerifyIdentityRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	p.require("claimantId", r.ClaimantID)
+	return p.err()
+}
+
+type VerifyIdentityResponse struct {
+	ClaimID    string `json:"claimId"`
+	ClaimantID string `json:"claimantId"`
+	Status     string `json:"status"`
+}
+
+type CreateDamageAssessmentRequest struct {
+	BusinessKey  string `json:"businessKey"`
+	ClaimID      string `json:"claimId"`
+	AssessmentID string `json:"assessmentId"`
+}
+
+func (CreateDamageAssessmentRequest) Fields() []string {
+	return []string{"businessKey", "claimId", "assessmentId"}
+}
+
+func (r CreateDamageAssessmentRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	p.require("assessmentId", r.AssessmentID)
+	return p.err()
+}
+
+type CreateDamageAssessmentResponse struct {
+	ClaimID      string `json:"claimId"`
+	AssessmentID string `json:"assessmentId"`
+	Status       string `json:"status"`
+}
+
+// ReservePayoutFundsRequest charges the reservation to PolicyID, or to
+// app.DefaultPolicyID when it is empty.
+type ReservePayoutFundsRequest struct {
+	BusinessKey  string `json:"businessKey"`
+	ClaimID      string `json:"claimId"`
+	PayoutAmount int    `json:"payoutAmount"`
+	PolicyID     string `json:"policyId"`
+}
+
+func (ReservePayoutFundsRequest) Fields() []string {
+	return []string{"businessKey", "claimId", "payoutAmount", "policyId"}
+}
+
+func (r ReservePayoutFundsRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	p.positive("payoutAmount", r.PayoutAmount)
+	return p.err()
+}
+
+type ReservePayoutFundsResponse struct {
+	ClaimID      string `json:"claimId"`
+	PayoutAmount int    `json:"payoutAmount"`
+	Status       string `json:"status"`
+}
+
+type NotifyAssignedSurveyorRequest struct {
+	BusinessKey string `json:"businessKey"`
+	ClaimID     string `json:"claimId"`
+	SurveyorID  string `json:"surveyorId"`
+}
+
+func (NotifyAssignedSurveyorRequest) Fields() []string {
+	return []string{"businessKey", "claimId", "surveyorId"}
+}
+
+func (r NotifyAssignedSurveyorRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	p.require("surveyorId", r.SurveyorID)
+	return p.err()
+}
+
+type NotifyAssignedSurveyorResponse struct {
+	ClaimID    string `json:"claimId"`
+	SurveyorID string `json:"surveyorId"`
+	Status     string `json:"status"`
+}
+
+// ExecuteBankTransferRequest pays SettledAmount out of the reservation, or
+// the full PayoutAmount when the claim was not settled for less.
+type ExecuteBankTransferRequest struct {
+	BusinessKey    string `json:"businessKey"`
+	ClaimID        string `json:"claimId"`
+	BankAccount    string `json:"bankAccount"`
+	PayoutAmount   int    `json:"payoutAmount"`
+	FailTransfer   bool   `json:"failTransfer"`
+	TransferFaults string `json:"transferFaults"`
+	SettledAmount  int    `json:"settledAmount"`
+}
+
+func (ExecuteBankTransferRequest) Fields() []string {
+	return []string{"businessKey", "claimId", "bankAccount", "payoutAmount", "failTransfer", "transferFaults", "settledAmount"}
+}
+
+func (r ExecuteBankTransferRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	p.require("bankAccount", r.BankAccount)
+	p.positive("payoutAmount", r.PayoutAmount)
+	if r.SettledAmount < 0 || r.SettledAmount > r.PayoutAmount {
+		p = append(p, "settledAmount must be between 0 and payoutAmount")
+	}
+	return p.err()
+}
+
+// Amount is what the bank transfer pays out.
+func (r ExecuteBankTransferRequest) Amount() int {
+	if r.SettledAmount > 0 {
+		return r.SettledAmount
+	}
+	return r.PayoutAmount
+}
+
+type ExecuteBankTransferResponse struct {
+	ClaimID    string `json:"claimId"`
+	PaidAmount int    `json:"paidAmount"`
+	Status     string `json:"status"`
+}
+
+// CompensationRequest is the body of all four compensating operations,
+// which only need to know which claim to undo.
+type CompensationRequest struct {
+	BusinessKey string `json:"businessKey"`
+	ClaimID     string `json:"claimId"`
+}
+
+func (CompensationRequest) Fields() []string {
+	return []string{"businessKey", "claimId"}
+}
+
+func (r CompensationRequest) Validate() error {
+	var p problems
+	p.require("businessKey", r.BusinessKey)
+	p.require("claimId", r.ClaimID)
+	return p.err()
+}
+
+type CompensationResponse struct {
+	ClaimID string `json:"claimId"`
+	Status  string `json:"status"`
+}
+
+// WriteError answers a failed call with a structured error body. Transient
+// failures are marked retryable so that callers know a forward retry is
+// worth it; recorded business failures and rejections are final.
+func WriteError(w http.ResponseWriter, err error) {
+	statusCode, body := ErrorResponse(err)
+	httpjson.WriteError(w, statusCode, body)
+}
+
+// ErrorResponse returns the status code and body WriteError answers err with.
+func ErrorResponse(err error) (int, *httpjson.Error) {
+	var requestErr *httpjson.Error
+	var retryErr *app.RetryableError
+	var outcomeErr *app.OutcomeError
+	switch {
+	case errors.As(err, &requestErr):
+		return http.StatusBadRequest, requestErr
+	case errors.Is(err, app.ErrForwardRejected):
+		return http.StatusConflict, &httpjson.Error{Code: CodeForwardRejected, Message: "the step has already been compensated"}
+	case errors.As(err, &retryErr):
+		statusCode := http.StatusServiceUnavailable
+		if retryErr.Message == app.TransferBankTimeout {
+			statusCode = http.StatusGatewayTimeout
+		}
+		return statusCode, &httpjson.Error{Code: retryErr.Message, Message: "the bank did not complete the transfer", Retryable: true}
+	case errors.As(err, &outcomeErr):
+		statusCode := http.StatusInternalServerError
+		if outcomeErr.Message == app.TransferAccountInvalid {
+			statusCode = http.StatusUnprocessableEntity
+		}
+		return statusCode, &httpjson.Error{Code: outcomeErr.Message, Message: "the action failed"}
+	default:
+		return http.StatusInternalServerError, &httpjson.Error{Code: CodeInternal, Message: err.Error(), Retryable: true}
+	}
+}
+
+type problems []string
+
+func (p *problems) require(field string, value string) {
+	if strings.TrimSpace(value) == "" {
+		*p = append(*p, field+" is required")
+	}
+}
+
+func (p *problems) positive(field string, value int) {
+	if value <= 0 {
+		*p = append(*p, field+" must be positive")
+	}
+}
+
+func (p problems) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(p, "; "))
+}
@@ -0,0 +1,327 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package expect encodes what InsuranceClaimSaga must leave behind when it
+// fails at a given step: the business snapshot with its ordered action
+// trail, the seata_state_machine_inst row and the seata_state_inst rows.
+package expect
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/ledger"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+// Failure points, named after the step whose forward action fails. None is
+// the successful run.
+const (
+	None       = ""
+	Identity   = "identity"
+	Assessment = "assessment"
+	Funds      = "funds"
+	Surveyor   = "surveyor"
+	Transfer   = "transfer"
+)
+
+// Steps lists the failure points in forward order.
+var Steps = []string{Identity, Assessment, Funds, Surveyor, Transfer}
+
+var forwardStates = map[string]string{
+	Identity:   "VerifyIdentity",
+	Assessment: "CreateDamageAssessment",
+	Funds:      "ReservePayoutFunds",
+	Surveyor:   "NotifyAssignedSurveyor",
+	Transfer:   "ExecuteBankTransfer",
+}
+
+var compensationStates = map[string]string{
+	Identity:   "UnverifyClaim",
+	Assessment: "DeleteDamageAssessment",
+	Funds:      "ReleasePayoutFunds",
+	Surveyor:   "CancelSurveyorNotification",
+}
+
+// Claim holds the inputs of a run that show up in its results.
+type Claim struct {
+	PolicyID      string
+	PayoutAmount  int
+	SettledAmount int
+}
+
+func (c Claim) paidAmount() int {
+	if c.SettledAmount > 0 {
+		return c.SettledAmount
+	}
+	return c.PayoutAmount
+}
+
+// State is one expected seata_state_inst row. CompensationFor names the
+// forward state a compensation state ran for and is empty for forward states.
+type State struct {
+	Name            string
+	Status          string
+	CompensationFor string
+}
+
+// Expectation is the complete result of a run that fails at FailAt.
+type Expectation struct {
+	FailAt             string
+	Status             string
+	CompensationStatus string
+	States             []State
+	Snapshot           app.Snapshot
+}
+
+// For builds the expectation for a run failing at failAt. The forward
+// action of the failing step is expected to write nothing, as with an
+// injected "step.forward=error" fault, except for the bank transfer, which
+// is expected to fail through failTransfer and record the failed attempt.
+func For(failAt string, claim Claim) (Expectation, error) {
+	failed := len(Steps)
+	if failAt != None {
+		failed = indexOf(failAt)
+		if failed < 0 {
+			return Expectation{}, fmt.Errorf("unknown failure point %q, want one of %s", failAt, strings.Join(Steps, ", "))
+		}
+	}
+	if claim.PolicyID == "" {
+		claim.PolicyID = app.DefaultPolicyID
+	}
+
+	e := Expectation{
+		FailAt: failAt,
+		Snapshot: app.Snapshot{
+			AssessmentStatus: "MISSING",
+			FundsStatus:      "MISSING",
+			SurveyorStatus:   "MISSING",
+			TransferStatus:   "MISSING",
+		},
+	}
+	for _, step := range Steps[:failed] {
+		e.States = append(e.States, State{Name: forwardStates[step], Status: "SU"})
+		forward(&e.Snapshot, step, claim)
+	}
+	if failAt == None {
+		e.Status = "SU"
+		return e, nil
+	}
+
+	e.Status = "FA"
+	e.States = append(e.States, State{Name: forwardStates[failAt], Status: "FA"})
+	if failAt == Transfer {
+		failTransfer(&e.Snapshot, claim)
+	}
+	for i := failed - 1; i >= 0; i-- {
+		step := Steps[i]
+		e.States = append(e.States, State{Name: compensationStates[step], Status: "SU", CompensationFor: forwardStates[step]})
+		compensate(&e.Snapshot, step, claim)
+	}
+	// A failure in the first step leaves nothing to compensate, and the
+	// engine records no compensation status at all.
+	if failed > 0 {
+		e.CompensationStatus = "SU"
+	}
+	return e, nil
+}
+
+func indexOf(step string) int {
+	for i, s := range Steps {
+		if s == step {
+			return i
+		}
+	}
+	return -1
+}
+
+func forward(s *app.Snapshot, step string, claim Claim) {
+	switch step {
+	case Identity:
+		s.IdentityVerified = true
+		trail(s, "identity:verify", "claimant verified")
+	case Assessment:
+		s.AssessmentStatus = "CREATED"
+		trail(s, "assessment:create", "damage assessment created")
+	case Funds:
+		s.FundsStatus = "RESERVED"
+		s.FundsAmount = claim.PayoutAmount
+		s.FundsPolicyID = claim.PolicyID
+		s.FundsLedger = ledger.Balance{Requested: claim.PayoutAmount, Reserved: claim.PayoutAmount}
+		trail(s, "funds:reserve", fmt.Sprintf("reserved payout policy=%s amount=%d", claim.PolicyID, claim.PayoutAmount))
+	case Surveyor:
+		s.SurveyorStatus = "NOTIFIED"
+		trail(s, "surveyor:notify", "assigned surveyor notified")
+	case Transfer:
+		paid := claim.paidAmount()
+		s.FundsStatus = "CAPTURED"
+		s.FundsLedger = ledger.Balance{Requested: claim.PayoutAmount, Captured: paid, Released: claim.PayoutAmount - paid}
+		s.TransferStatus = "SUCCESS"
+		s.TransferAttempts = 1
+		trail(s, "transfer:execute", fmt.Sprintf("bank transfer amount=%d attempt=1 status=SUCCESS", paid))
+	}
+}
+
+func failTransfer(s *app.Snapshot, claim Claim) {
+	s.TransferStatus = "FAILED"
+	s.TransferLastError = app.TransferFailed
+	s.TransferAttempts = 1
+	trail(s, "transfer:execute", fmt.Sprintf("bank transfer amount=%d attempt=1 status=FAILED error=%s", claim.paidAmount(), app.TransferFailed))
+}
+
+func compensate(s *app.Snapshot, step string, claim Claim) {
+	switch step {
+	case Identity:
+		s.IdentityVerified = false
+		trail(s, "identity:compensate", "claimant verification rolled back")
+	case Assessment:
+		s.AssessmentStatus = "MISSING"
+		trail(s, "assessment:compensate", "damage assessment deleted")
+	case Funds:
+		s.FundsStatus = "RELEASED"
+		s.FundsLedger = ledger.Balance{Requested: claim.PayoutAmount, Released: claim.PayoutAmount}
+		trail(s, "funds:compensate", fmt.Sprintf("reserved payout released amount=%d", claim.PayoutAmount))
+	case Surveyor:
+		s.SurveyorStatus = "CANCELED"
+		trail(s, "surveyor:compensate", "surveyor notification canceled")
+	}
+}
+
+func trail(s *app.Snapshot, action string, note string) {
+	s.OrderedActionTrail = append(s.OrderedActionTrail, fmt.Sprintf("%s(%s)", action, note))
+}
+
+// Verify compares the recorded result of the Saga instance xid and its
+// claim against e and reports every difference it finds.
+func Verify(db *sql.DB, xid string, claimID string, e Expectation) error {
+	var problems []string
+
+	machine, err := sagastore.LoadMachine(db, xid)
+	if err != nil {
+		return fmt.Errorf("load state machine instance %s: %w", xid, err)
+	}
+	if machine.Status.String != e.Status || machine.CompensationStatus.String != e.CompensationStatus || machine.IsRunning {
+		problems = append(problems, fmt.Sprintf("machine status=%s compensationStatus=%s running=%t, want %s/%s not running",
+			machine.Status.String, machine.CompensationStatus.String, machine.IsRunning, e.Status, e.CompensationStatus))
+	}
+
+	states, err := sagastore.LoadStates(db, xid)
+	if err != nil {
+		return fmt.Errorf("load state instances of %s: %w", xid, err)
+	}
+	problems = append(problems, compareStates(states, e.States)...)
+
+	snapshot, err := app.LoadSnapshot(db, claimID)
+	if err != nil {
+		return fmt.Errorf("load snapshot of %s: %w", claimID, err)
+	}
+	problems = append(problems, compareSnapshots(snapshot, e.Snapshot)...)
+	return e.mismatch(problems)
+}
+
+// VerifySnapshot compares only the business snapshot of claimID against e,
+// for runs that drive the services without the Saga engine.
+func VerifySnapshot(db *sql.DB, claimID string, e Expectation) error {
+	snapshot, err := app.LoadSnapshot(db, claimID)
+	if err != nil {
+		return fmt.Errorf("load snapshot of %s: %w", claimID, err)
+	}
+	return e.mismatch(compareSnapshots(snapshot, e.Snapshot))
+}
+
+func (e Expectation) mismatch(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	name := "success"
+	if e.FailAt != None {
+		name = "failAt=" + e.FailAt
+	}
+	return fmt.Errorf("%s: %s", name, strings.Join(problems, "; "))
+}
+
+// compareStates checks the service task rows in execution order. Each
+// compensation row must point at the row of the forward state it undoes.
+func compareStates(got []sagastore.State, want []State) []string {
+	var tasks []sagastore.State
+	for _, state := range got {
+		if state.Type == "ServiceTask" {
+			tasks = append(tasks, state)
+		}
+	}
+	if len(tasks) != len(want) {
+		return []string{fmt.Sprintf("states %s, want %s", formatStates(tasks), formatWant(want))}
+	}
+
+	forwardIDs := make(map[string]string)
+	var problems []string
+	for i, w := range want {
+		g := tasks[i]
+		if g.Name != w.Name || g.Status.String != w.Status {
+			problems = append(problems, fmt.Sprintf("state #%d is %s/%s, want %s/%s", i+1, g.Name, g.Status.String, w.Name, w.Status))
+			continue
+		}
+		if w.CompensationFor == "" {
+			if g.IsCompensation() {
+				problems = append(problems, fmt.Sprintf("state %s is a compensation, want a forward state", g.Name))
+			}
+			forwardIDs[g.Name] = g.ID
+			continue
+		}
+		if !g.IsCompensation() || g.CompensatedFor.String != forwardIDs[w.CompensationFor] {
+			problems = append(problems, fmt.Sprintf("state %s compensates %q, want the %s state %q",
+				g.Name, g.CompensatedFor.String, w.CompensationFor, forwardIDs[w.CompensationFor]))
+		}
+	}
+	return problems
+}
+
+func formatStates(states []sagastore.State) string {
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		parts = append(parts, state.Name+"/"+state.Status.String)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+func formatWant(states []State) string {
+	parts := make([]string, 0, len(states))
+	for _, state := range states {
+		parts = append(parts, state.Name+"/"+state.Status)
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// compareSnapshots reports the FormatSnapshot lines that differ, which
+// covers every snapshot field including the action trail.
+func compareSnapshots(got app.Snapshot, want app.Snapshot) []string {
+	gotLines := strings.Split(app.FormatSnapshot(got), "\n")
+	wantLines := strings.Split(app.FormatSnapshot(want), "\n")
+	var problems []string
+	for i := range wantLines {
+		if i >= len(gotLines) || gotLines[i] != wantLines[i] {
+			gotLine := "<none>"
+			if i < len(gotLines) {
+				gotLine = gotLines[i]
+			}
+			problems = append(problems, fmt.Sprintf("got %s, want %s", gotLine, wantLines[i]))
+		}
+	}
+	return problems
+}
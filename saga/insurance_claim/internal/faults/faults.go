@@ -0,0 +1,355 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package faults injects failures into the insurance claim services so that
+// every forward and compensation branch of InsuranceClaimSaga can be driven
+// on purpose. Rules are loaded from CLAIM_FAULTS and can be replaced at
+// runtime through the /faults admin endpoint of each service.
+package faults
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+)
+
+const (
+	Forward    = "forward"
+	Compensate = "compensate"
+)
+
+const (
+	// ModeError fails the call before the action runs, so nothing is written.
+	ModeError = "error"
+	// ModeLatency delays the call and then runs the action normally.
+	ModeLatency = "latency"
+	// ModeTimeout holds the call for the configured duration and answers
+	// 504 without running the action, like a gateway giving up on a hung
+	// backend.
+	ModeTimeout = "timeout"
+	// ModeAfterCommit runs and commits the action, then reports a failure,
+	// so the caller retries or compensates an action that did take effect.
+	ModeAfterCommit = "afterCommit"
+)
+
+const (
+	defaultLatency = 2 * time.Second
+	defaultTimeout = 30 * time.Second
+)
+
+// Rule injects one kind of failure into a step's forward or compensation
+// action. Times limits how often the rule fires; zero means on every call.
+type Rule struct {
+	Step     string
+	Action   string
+	Mode     string
+	Duration time.Duration
+	Times    int
+}
+
+func (r Rule) validate() error {
+	if r.Step == "" {
+		return fmt.Errorf("fault rule has no step")
+	}
+	if r.Action != Forward && r.Action != Compensate {
+		return fmt.Errorf("fault rule %s: action must be %s or %s, got %q", r.Step, Forward, Compensate, r.Action)
+	}
+	switch r.Mode {
+	case ModeError, ModeLatency, ModeTimeout, ModeAfterCommit:
+	default:
+		return fmt.Errorf("fault rule %s.%s: unknown mode %q", r.Step, r.Action, r.Mode)
+	}
+	if r.Times < 0 {
+		return fmt.Errorf("fault rule %s.%s: times must not be negative", r.Step, r.Action)
+	}
+	return nil
+}
+
+func (r Rule) String() string {
+	spec := fmt.Sprintf("%s.%s=%s", r.Step, r.Action, r.Mode)
+	if r.Duration > 0 {
+		spec += ":" + r.Duration.String()
+	}
+	if r.Times > 0 {
+		spec += "*" + strconv.Itoa(r.Times)
+	}
+	return spec
+}
+
+// ParseRules parses a semicolon-separated list of step.action=mode[:duration][*times]
+// entries, for example
+//
+//	funds.compensate=error;transfer.forward=latency:3s;surveyor.forward=afterCommit*1
+func ParseRules(spec string) ([]Rule, error) {
+	var rules []Rule
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		target, mode, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("fault rule %q: expect step.action=mode", entry)
+		}
+		step, action, ok := strings.Cut(target, ".")
+		if !ok {
+			return nil, fmt.Errorf("fault rule %q: expect step.action=mode", entry)
+		}
+
+		rule := Rule{Step: step, Action: action}
+		if mode, times, ok := strings.Cut(mode, "*"); ok {
+			n, err := strconv.Atoi(times)
+			if err != nil {
+				return nil, fmt.Errorf("fault rule %q: %w", entry, err)
+			}
+			rule.Times = n
+			rule.Mode = mode
+		} else {
+			rule.Mode = mode
+		}
+		if mode, duration, ok := strings.Cut(rule.Mode, ":"); ok {
+			d, err := time.ParseDuration(duration)
+			if err != nil {
+				return nil, fmt.Errorf("fault rule %q: %w", entry, err)
+			}
+			rule.Duration = d
+			rule.Mode = mode
+		}
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Injector holds the active rules of one service process.
+type Injector struct {
+	mu    sync.Mutex
+	rules []Rule
+	fired []int
+}
+
+// FromEnv builds an injector from the CLAIM_FAULTS environment variable.
+func FromEnv() (*Injector, error) {
+	rules, err := ParseRules(os.Getenv("CLAIM_FAULTS"))
+	if err != nil {
+		return nil, err
+	}
+	injector := &Injector{}
+	injector.Set(rules)
+	return injector, nil
+}
+
+// Set replaces all rules and resets their fire counts.
+func (i *Injector) Set(rules []Rule) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = append([]Rule(nil), rules...)
+	i.fired = make([]int, len(rules))
+}
+
+func (i *Injector) Rules() []Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return append([]Rule(nil), i.rules...)
+}
+
+// String renders the active rules in the CLAIM_FAULTS format.
+func (i *Injector) String() string {
+	rules := i.Rules()
+	specs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		specs = append(specs, rule.String())
+	}
+	return strings.Join(specs, ";")
+}
+
+// next returns the first rule for step and action that still has calls left
+// and counts the call against it.
+func (i *Injector) next(step string, action string) (Rule, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for index, rule := range i.rules {
+		if rule.Step != step || rule.Action != action {
+			continue
+		}
+		if rule.Times > 0 && i.fired[index] >= rule.Times {
+			continue
+		}
+		i.fired[index]++
+		return rule, true
+	}
+	return Rule{}, false
+}
+
+// Wrap applies the matching rule, if any, around the handler of one action.
+// The handler answers into a buffer, so that an after-commit fault can
+// replace a successful answer that was already written.
+func (i *Injector) Wrap(step string, action string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		recorder := &bufferedResponse{header: make(http.Header), statusCode: http.StatusOK}
+		err := i.Apply(step, action, func() error {
+			handler(recorder, r)
+			if recorder.statusCode < 200 || recorder.statusCode > 299 {
+				return errNotCommitted
+			}
+			return nil
+		})
+		var fault *Fault
+		if errors.As(err, &fault) {
+			httpjson.WriteError(w, fault.StatusCode, fault.Body)
+			return
+		}
+		recorder.copyTo(w)
+	}
+}
+
+// errNotCommitted tells Apply that the wrapped handler answered with an
+// error, which Wrap passes on as it is.
+var errNotCommitted = errors.New("handler did not commit")
+
+// Fault is the failure Apply reports in place of an HTTP answer, with the
+// status code Wrap writes for it.
+type Fault struct {
+	StatusCode int
+	Body       *httpjson.Error
+}
+
+func (f *Fault) Error() string {
+	return f.Body.Error()
+}
+
+// Apply applies the matching rule, if any, around run and returns a *Fault
+// in place of the injected error. Actions that run in-process call it
+// directly; Wrap turns the *Fault into the HTTP answer.
+func (i *Injector) Apply(step string, action string, run func() error) error {
+	rule, ok := i.next(step, action)
+	if !ok {
+		return run()
+	}
+
+	switch rule.Mode {
+	case ModeError:
+		return &Fault{StatusCode: http.StatusInternalServerError, Body: &httpjson.Error{Code: "INJECTED_FAULT", Message: rule.String()}}
+	case ModeLatency:
+		time.Sleep(durationOr(rule.Duration, defaultLatency))
+		return run()
+	case ModeTimeout:
+		time.Sleep(durationOr(rule.Duration, defaultTimeout))
+		return &Fault{StatusCode: http.StatusGatewayTimeout, Body: &httpjson.Error{Code: "INJECTED_TIMEOUT", Message: rule.String(), Retryable: true}}
+	default:
+		if err := run(); err != nil {
+			return err
+		}
+		return &Fault{StatusCode: http.StatusInternalServerError, Body: &httpjson.Error{Code: "INJECTED_FAULT_AFTER_COMMIT", Message: rule.String(), Retryable: true}}
+	}
+}
+
+// Register mounts the admin endpoint. GET prints the active rules, PUT
+// replaces them with a body in the CLAIM_FAULTS format, and DELETE clears
+// them.
+func (i *Injector) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/faults", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			httpjson.WriteText(w, http.StatusOK, i.String())
+		case http.MethodPut, http.MethodPost:
+			defer r.Body.Close()
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				httpjson.WriteText(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			rules, err := ParseRules(string(body))
+			if err != nil {
+				httpjson.WriteText(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			i.Set(rules)
+			httpjson.WriteText(w, http.StatusOK, i.String())
+		case http.MethodDelete:
+			i.Set(nil)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			httpjson.WriteText(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	})
+}
+
+// Put replaces the fault rules of the service at baseURL through its /faults
+// endpoint. An empty spec clears them.
+func Put(baseURL string, spec string) error {
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(baseURL, "/")+"/faults", strings.NewReader(spec))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("PUT %s returned %s: %s", req.URL, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func durationOr(d time.Duration, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// bufferedResponse holds the real response back until the after-commit fault
+// has decided whether to replace it.
+type bufferedResponse struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	b.statusCode = statusCode
+}
+
+func (b *bufferedResponse) copyTo(w http.ResponseWriter) {
+	for key, values := range b.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(b.statusCode)
+	_, _ = w.Write(b.body.Bytes())
+}
@@ -18,46 +18,102 @@
 package httpjson
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 )
 
-func ReadArgs(r *http.Request, expected int) ([]json.RawMessage, error) {
+const CodeInvalidRequest = "INVALID_REQUEST"
+
+// Request is implemented by the named request of every service operation.
+type Request interface {
+	// Fields lists the JSON field names in the order of the positional
+	// argument array used by older state language files.
+	Fields() []string
+	Validate() error
+}
+
+// Error is the structured body of every failed service call.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Retryable bool   `json:"retryable"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// ReadRequest decodes the body into req and validates it. The body may be a
+// named JSON object, an array holding that object (how the Saga http invoker
+// sends a single map Input), or the legacy positional argument array, whose
+// entries are matched to req.Fields() in order. Trailing positional fields
+// may be omitted. Any problem is reported as an INVALID_REQUEST *Error.
+func ReadRequest(r *http.Request, req Request) error {
 	defer r.Body.Close()
 
-	var args []json.RawMessage
-	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
-		return nil, err
-	}
-	if len(args) != expected {
-		return nil, fmt.Errorf("expect %d args, got %d", expected, len(args))
+	raw, err := io.ReadAll(r.Body)
+	if err != nil {
+		return invalidRequest(err)
 	}
-	return args, nil
+	return DecodeRequest(raw, req)
 }
 
-func StringArg(args []json.RawMessage, index int) (string, error) {
-	var value string
-	if err := json.Unmarshal(args[index], &value); err != nil {
-		return "", err
+// DecodeRequest is ReadRequest for a body that is already in memory, such as
+// the Input of a state run by the Saga local invoker.
+func DecodeRequest(raw []byte, req Request) error {
+	if err := decodeRequest(raw, req); err != nil {
+		return invalidRequest(err)
 	}
-	return value, nil
+	if err := req.Validate(); err != nil {
+		return invalidRequest(err)
+	}
+	return nil
 }
 
-func IntArg(args []json.RawMessage, index int) (int, error) {
-	var value int
-	if err := json.Unmarshal(args[index], &value); err != nil {
-		return 0, err
+func decodeRequest(raw []byte, req Request) error {
+	body := bytes.TrimSpace(raw)
+	if len(body) > 0 && body[0] == '[' {
+		var args []json.RawMessage
+		if err := json.Unmarshal(body, &args); err != nil {
+			return err
+		}
+		if len(args) == 1 && isObject(args[0]) {
+			body = args[0]
+		} else {
+			named, err := nameArgs(args, req.Fields())
+			if err != nil {
+				return err
+			}
+			body = named
+		}
 	}
-	return value, nil
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(req)
 }
 
-func BoolArg(args []json.RawMessage, index int) (bool, error) {
-	var value bool
-	if err := json.Unmarshal(args[index], &value); err != nil {
-		return false, err
+func nameArgs(args []json.RawMessage, fields []string) ([]byte, error) {
+	if len(args) > len(fields) {
+		return nil, fmt.Errorf("expect at most %d args, got %d", len(fields), len(args))
 	}
-	return value, nil
+	named := make(map[string]json.RawMessage, len(args))
+	for index, arg := range args {
+		named[fields[index]] = arg
+	}
+	return json.Marshal(named)
+}
+
+func isObject(raw json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(raw)
+	return len(trimmed) > 0 && trimmed[0] == '{'
+}
+
+func invalidRequest(err error) *Error {
+	return &Error{Code: CodeInvalidRequest, Message: err.Error()}
 }
 
 func WriteText(w http.ResponseWriter, statusCode int, body string) {
@@ -65,3 +121,13 @@ func WriteText(w http.ResponseWriter, statusCode int, body string) {
 	w.WriteHeader(statusCode)
 	_, _ = w.Write([]byte(body))
 }
+
+func WriteJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func WriteError(w http.ResponseWriter, statusCode int, err *Error) {
+	WriteJSON(w, statusCode, err)
+}
@@ -0,0 +1,320 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package ledger keeps the payout money of every claim in a double-entry
+// ledger. Each entry moves an amount from one account to another, so the
+// balances of a claim always sum to zero: whatever left the policy's
+// available account is still reserved, has been captured by the bank
+// transfer, or has been released back.
+package ledger
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	EntryReserve        = "RESERVE"
+	EntryRelease        = "RELEASE"
+	EntryPartialRelease = "PARTIAL_RELEASE"
+	EntryCapture        = "CAPTURE"
+)
+
+const (
+	AccountAvailable = "available"
+	AccountReserved  = "reserved"
+	AccountCaptured  = "captured"
+	AccountReleased  = "released"
+)
+
+// Schema creates the ledger tables. claim_fund_ledger is append-only;
+// claim_policy_balance holds the running balances of every policy and is
+// updated in the same transaction as each entry.
+var Schema = []string{
+	`CREATE TABLE IF NOT EXISTS claim_fund_ledger (
+		id BIGINT PRIMARY KEY AUTO_INCREMENT,
+		policy_id VARCHAR(64) NOT NULL,
+		claim_id VARCHAR(64) NOT NULL,
+		business_key VARCHAR(64) NOT NULL,
+		entry_type VARCHAR(32) NOT NULL,
+		debit_account VARCHAR(32) NOT NULL,
+		credit_account VARCHAR(32) NOT NULL,
+		amount INT NOT NULL,
+		policy_reserved INT NOT NULL,
+		policy_captured INT NOT NULL,
+		policy_released INT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		KEY idx_claim_fund_ledger_claim (claim_id),
+		KEY idx_claim_fund_ledger_policy (policy_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+	`CREATE TABLE IF NOT EXISTS claim_policy_balance (
+		policy_id VARCHAR(64) PRIMARY KEY,
+		requested INT NOT NULL DEFAULT 0,
+		reserved INT NOT NULL DEFAULT 0,
+		captured INT NOT NULL DEFAULT 0,
+		released INT NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+}
+
+// Querier is satisfied by both *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Entry moves Amount between the two accounts implied by Type.
+type Entry struct {
+	PolicyID    string
+	ClaimID     string
+	BusinessKey string
+	Type        string
+	Amount      int
+}
+
+// Balance is the net position of a claim or a policy. Requested is what has
+// been moved out of the available account.
+type Balance struct {
+	Requested int `json:"requested"`
+	Reserved  int `json:"reserved"`
+	Captured  int `json:"captured"`
+	Released  int `json:"released"`
+}
+
+func (b Balance) String() string {
+	return fmt.Sprintf("requested=%d reserved=%d captured=%d released=%d", b.Requested, b.Reserved, b.Captured, b.Released)
+}
+
+// accounts returns the debit (increased) and credit (decreased) account of
+// an entry type.
+func accounts(entryType string) (string, string, error) {
+	switch entryType {
+	case EntryReserve:
+		return AccountReserved, AccountAvailable, nil
+	case EntryCapture:
+		return AccountCaptured, AccountReserved, nil
+	case EntryRelease, EntryPartialRelease:
+		return AccountReleased, AccountReserved, nil
+	}
+	return "", "", fmt.Errorf("unknown ledger entry type %q", entryType)
+}
+
+func (b *Balance) move(debit string, credit string, amount int) {
+	b.add(debit, amount)
+	b.add(credit, -amount)
+}
+
+func (b *Balance) add(account string, amount int) {
+	switch account {
+	case AccountAvailable:
+		b.Requested -= amount
+	case AccountReserved:
+		b.Reserved += amount
+	case AccountCaptured:
+		b.Captured += amount
+	case AccountReleased:
+		b.Released += amount
+	}
+}
+
+// Post appends entry and updates the policy's running balances. It must run
+// in the same transaction as the business write it accounts for.
+func Post(tx *sql.Tx, entry Entry) error {
+	if entry.Amount <= 0 {
+		return fmt.Errorf("ledger entry %s for claim %s: amount must be positive, got %d", entry.Type, entry.ClaimID, entry.Amount)
+	}
+	debit, credit, err := accounts(entry.Type)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT IGNORE INTO claim_policy_balance(policy_id) VALUES(?)`, entry.PolicyID); err != nil {
+		return err
+	}
+	var policy Balance
+	err = tx.QueryRow(`SELECT requested, reserved, captured, released FROM claim_policy_balance WHERE policy_id = ? FOR UPDATE`, entry.PolicyID).
+		Scan(&policy.Requested, &policy.Reserved, &policy.Captured, &policy.Released)
+	if err != nil {
+		return err
+	}
+	policy.move(debit, credit, entry.Amount)
+	if policy.Reserved < 0 {
+		return fmt.Errorf("ledger entry %s for claim %s would overdraw the reserved balance of policy %s", entry.Type, entry.ClaimID, entry.PolicyID)
+	}
+
+	if _, err := tx.Exec(`UPDATE claim_policy_balance SET requested = ?, reserved = ?, captured = ?, released = ? WHERE policy_id = ?`,
+		policy.Requested, policy.Reserved, policy.Captured, policy.Released, entry.PolicyID); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO claim_fund_ledger(policy_id, claim_id, business_key, entry_type, debit_account, credit_account, amount, policy_reserved, policy_captured, policy_released)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		entry.PolicyID, entry.ClaimID, entry.BusinessKey, entry.Type, debit, credit, entry.Amount, policy.Reserved, policy.Captured, policy.Released)
+	return err
+}
+
+// ClaimBalance sums the ledger entries of one claim.
+func ClaimBalance(q Querier, claimID string) (Balance, error) {
+	return sumEntries(q, `SELECT debit_account, credit_account, SUM(amount) FROM claim_fund_ledger WHERE claim_id = ? GROUP BY debit_account, credit_account`, claimID)
+}
+
+// DeleteClaim removes the entries of a claim and takes them back out of
+// the policy balance, so that sample data can be reset without leaving the
+// policy out of step with its ledger.
+func DeleteClaim(db *sql.DB, claimID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var policyID string
+	err = tx.QueryRow(`SELECT policy_id FROM claim_fund_ledger WHERE claim_id = ? LIMIT 1`, claimID).Scan(&policyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	claim, err := ClaimBalance(tx, claimID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE claim_policy_balance SET requested = requested - ?, reserved = reserved - ?, captured = captured - ?, released = released - ? WHERE policy_id = ?`,
+		claim.Requested, claim.Reserved, claim.Captured, claim.Released, policyID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM claim_fund_ledger WHERE claim_id = ?`, claimID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckClaim verifies the invariants of one claim against the amount the
+// funds service was asked to reserve: every entry is well formed, no
+// account except available goes negative, and reserved plus captured plus
+// released equals requested.
+func CheckClaim(q Querier, claimID string, requested int) error {
+	rows, err := q.Query(`SELECT id, entry_type, debit_account, credit_account, amount FROM claim_fund_ledger WHERE claim_id = ? ORDER BY id`, claimID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	var running Balance
+	for rows.Next() {
+		var id int64
+		var entryType, debit, credit string
+		var amount int
+		if err := rows.Scan(&id, &entryType, &debit, &credit, &amount); err != nil {
+			return err
+		}
+		wantDebit, wantCredit, err := accounts(entryType)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("entry %d: %v", id, err))
+			continue
+		}
+		if debit != wantDebit || credit != wantCredit {
+			problems = append(problems, fmt.Sprintf("entry %d: %s moves %s -> %s, want %s -> %s", id, entryType, credit, debit, wantCredit, wantDebit))
+		}
+		if amount <= 0 {
+			problems = append(problems, fmt.Sprintf("entry %d: amount %d is not positive", id, amount))
+		}
+		running.move(debit, credit, amount)
+		if running.Reserved < 0 || running.Captured < 0 || running.Released < 0 {
+			problems = append(problems, fmt.Sprintf("entry %d: balance went negative (%s)", id, running))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if running.Requested != requested {
+		problems = append(problems, fmt.Sprintf("ledger requested %d, reservation requested %d", running.Requested, requested))
+	}
+	if sum := running.Reserved + running.Captured + running.Released; sum != requested {
+		problems = append(problems, fmt.Sprintf("reserved+captured+released=%d, want requested=%d", sum, requested))
+	}
+	return violation(fmt.Sprintf("claim %s", claimID), problems)
+}
+
+// CheckPolicies verifies that the running balance of every policy equals
+// the sum of its ledger entries.
+func CheckPolicies(q Querier) error {
+	rows, err := q.Query(`SELECT policy_id, requested, reserved, captured, released FROM claim_policy_balance ORDER BY policy_id`)
+	if err != nil {
+		return err
+	}
+	var policies []string
+	stored := make(map[string]Balance)
+	for rows.Next() {
+		var policyID string
+		var b Balance
+		if err := rows.Scan(&policyID, &b.Requested, &b.Reserved, &b.Captured, &b.Released); err != nil {
+			rows.Close()
+			return err
+		}
+		policies = append(policies, policyID)
+		stored[policyID] = b
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	var problems []string
+	for _, policyID := range policies {
+		summed, err := sumEntries(q, `SELECT debit_account, credit_account, SUM(amount) FROM claim_fund_ledger WHERE policy_id = ? GROUP BY debit_account, credit_account`, policyID)
+		if err != nil {
+			return err
+		}
+		if summed != stored[policyID] {
+			problems = append(problems, fmt.Sprintf("policy %s: running balance %s, entries sum to %s", policyID, stored[policyID], summed))
+		}
+	}
+	return violation("policy balances", problems)
+}
+
+func sumEntries(q Querier, query string, arg string) (Balance, error) {
+	var b Balance
+	rows, err := q.Query(query, arg)
+	if err != nil {
+		return b, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var debit, credit string
+		var amount int
+		if err := rows.Scan(&debit, &credit, &amount); err != nil {
+			return b, err
+		}
+		b.move(debit, credit, amount)
+	}
+	return b, rows.Err()
+}
+
+func violation(subject string, problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", subject, strings.Join(problems, "; "))
+}
@@ -0,0 +1,253 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package local runs the insurance claim operations in-process, as services
+// of the Saga local invoker. Each service takes the same named request and
+// returns the same response map as its HTTP counterpart, honours the same
+// fault rules, and fails with an error shaped like the one the http invoker
+// reports, so the Catch and Retry rules of InsuranceClaimSaga match in both
+// modes.
+package local
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/contract"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/operation"
+)
+
+// ServiceName values of InsuranceClaimSaga, one per claim service.
+const (
+	IdentityService   = "identityService"
+	AssessmentService = "assessmentService"
+	FundsService      = "fundsService"
+	SurveyorService   = "surveyorService"
+	TransferService   = "transferService"
+)
+
+// All selects every service in Select.
+const All = "all"
+
+// steps maps each service to the step name its fault rules use.
+var steps = map[string]string{
+	IdentityService:   "identity",
+	AssessmentService: "assessment",
+	FundsService:      "funds",
+	SurveyorService:   "surveyor",
+	TransferService:   "transfer",
+}
+
+// ServiceFor returns the service that runs step, or "" for an unknown step.
+func ServiceFor(step string) string {
+	for service, s := range steps {
+		if s == step {
+			return service
+		}
+	}
+	return ""
+}
+
+// Select parses a comma-separated list of service names, or All, into the
+// set of services to run in-process. An empty spec selects none.
+func Select(spec string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "":
+		case name == All:
+			for service := range steps {
+				selected[service] = true
+			}
+		case steps[name] != "":
+			selected[name] = true
+		default:
+			known := make([]string, 0, len(steps))
+			for service := range steps {
+				known = append(known, service)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown local service %q, expect %s or one of %s", name, All, strings.Join(known, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// New returns the services named in selected, keyed by service name, ready
+// to be registered on the local invoker. Every action runs against db and
+// consults injector for fault rules.
+func New(db *sql.DB, injector *faults.Injector, selected map[string]bool) map[string]any {
+	all := map[string]any{
+		IdentityService:   &Identity{db: db, faults: injector},
+		AssessmentService: &Assessment{db: db, faults: injector},
+		FundsService:      &Funds{db: db, faults: injector},
+		SurveyorService:   &Surveyor{db: db, faults: injector},
+		TransferService:   &Transfer{db: db, faults: injector},
+	}
+	services := make(map[string]any, len(selected))
+	for name := range selected {
+		services[name] = all[name]
+	}
+	return services
+}
+
+// Error is a failed call, carrying the status code and body the HTTP service
+// would have answered with. Its message follows the http invoker, so a Catch
+// on "HTTP error" and a Retry on an error code match it unchanged.
+type Error struct {
+	StatusCode int
+	Body       *httpjson.Error
+}
+
+func (e *Error) Error() string {
+	body, _ := json.Marshal(e.Body)
+	return fmt.Sprintf("HTTP error: %d - %s", e.StatusCode, body)
+}
+
+type Identity struct {
+	db     *sql.DB
+	faults *faults.Injector
+}
+
+func (s *Identity) VerifyIdentity(input map[string]any) (map[string]any, error) {
+	var req contract.VerifyIdentityRequest
+	return call(s.faults, "identity", faults.Forward, input, &req, func() (any, error) {
+		return operation.VerifyIdentity(s.db, req)
+	})
+}
+
+func (s *Identity) UnverifyClaim(input map[string]any) (map[string]any, error) {
+	var req contract.CompensationRequest
+	return call(s.faults, "identity", faults.Compensate, input, &req, func() (any, error) {
+		return operation.UnverifyClaim(s.db, req)
+	})
+}
+
+type Assessment struct {
+	db     *sql.DB
+	faults *faults.Injector
+}
+
+func (s *Assessment) CreateDamageAssessment(input map[string]any) (map[string]any, error) {
+	var req contract.CreateDamageAssessmentRequest
+	return call(s.faults, "assessment", faults.Forward, input, &req, func() (any, error) {
+		return operation.CreateDamageAssessment(s.db, req)
+	})
+}
+
+func (s *Assessment) DeleteDamageAssessment(input map[string]any) (map[string]any, error) {
+	var req contract.CompensationRequest
+	return call(s.faults, "assessment", faults.Compensate, input, &req, func() (any, error) {
+		return operation.DeleteDamageAssessment(s.db, req)
+	})
+}
+
+type Funds struct {
+	db     *sql.DB
+	faults *faults.Injector
+}
+
+func (s *Funds) ReservePayoutFunds(input map[string]any) (map[string]any, error) {
+	var req contract.ReservePayoutFundsRequest
+	return call(s.faults, "funds", faults.Forward, input, &req, func() (any, error) {
+		return operation.ReservePayoutFunds(s.db, req)
+	})
+}
+
+func (s *Funds) ReleasePayoutFunds(input map[string]any) (map[string]any, error) {
+	var req contract.CompensationRequest
+	return call(s.faults, "funds", faults.Compensate, input, &req, func() (any, error) {
+		return operation.ReleasePayoutFunds(s.db, req)
+	})
+}
+
+type Surveyor struct {
+	db     *sql.DB
+	faults *faults.Injector
+}
+
+func (s *Surveyor) NotifyAssignedSurveyor(input map[string]any) (map[string]any, error) {
+	var req contract.NotifyAssignedSurveyorRequest
+	return call(s.faults, "surveyor", faults.Forward, input, &req, func() (any, error) {
+		return operation.NotifyAssignedSurveyor(s.db, req)
+	})
+}
+
+func (s *Surveyor) CancelSurveyorNotification(input map[string]any) (map[string]any, error) {
+	var req contract.CompensationRequest
+	return call(s.faults, "surveyor", faults.Compensate, input, &req, func() (any, error) {
+		return operation.CancelSurveyorNotification(s.db, req)
+	})
+}
+
+type Transfer struct {
+	db     *sql.DB
+	faults *faults.Injector
+}
+
+func (s *Transfer) ExecuteBankTransfer(input map[string]any) (map[string]any, error) {
+	var req contract.ExecuteBankTransferRequest
+	return call(s.faults, "transfer", faults.Forward, input, &req, func() (any, error) {
+		return operation.ExecuteBankTransfer(s.db, req)
+	})
+}
+
+// call decodes input into req the way the HTTP services read their body,
+// runs action under the fault rules of step and action, and converts the
+// response to the map the Output expressions read.
+func call(injector *faults.Injector, step string, action string, input map[string]any, req httpjson.Request, run func() (any, error)) (map[string]any, error) {
+	var resp any
+	err := injector.Apply(step, action, func() error {
+		raw, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		if err := httpjson.DecodeRequest(raw, req); err != nil {
+			return err
+		}
+		resp, err = run()
+		return err
+	})
+	if err != nil {
+		return nil, toError(err)
+	}
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return nil, toError(err)
+	}
+	var out map[string]any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, toError(err)
+	}
+	return out, nil
+}
+
+func toError(err error) *Error {
+	var fault *faults.Fault
+	if errors.As(err, &fault) {
+		return &Error{StatusCode: fault.StatusCode, Body: fault.Body}
+	}
+	statusCode, body := contract.ErrorResponse(err)
+	return &Error{StatusCode: statusCode, Body: body}
+}
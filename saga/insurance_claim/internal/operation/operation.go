@@ -0,0 +1,126 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package operation implements each insurance claim operation once: run the
+// action, log it and build the response. The HTTP services and the
+// in-process services of package local both call it.
+package operation
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/contract"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+)
+
+func VerifyIdentity(db *sql.DB, req contract.VerifyIdentityRequest) (contract.VerifyIdentityResponse, error) {
+	if err := app.RecordIdentityVerified(db, req.BusinessKey, req.ClaimID, req.ClaimantID); err != nil {
+		return contract.VerifyIdentityResponse{}, err
+	}
+	log.Printf("operation=VerifyIdentity businessKey=%s claimId=%s claimantId=%s status=SUCCESS", req.BusinessKey, req.ClaimID, req.ClaimantID)
+	return contract.VerifyIdentityResponse{ClaimID: req.ClaimID, ClaimantID: req.ClaimantID, Status: "IDENTITY_VERIFIED"}, nil
+}
+
+func UnverifyClaim(db *sql.DB, req contract.CompensationRequest) (contract.CompensationResponse, error) {
+	if err := app.UnverifyIdentity(db, req.BusinessKey, req.ClaimID); err != nil {
+		return contract.CompensationResponse{}, err
+	}
+	log.Printf("operation=UnverifyClaim businessKey=%s claimId=%s status=SUCCESS", req.BusinessKey, req.ClaimID)
+	return contract.CompensationResponse{ClaimID: req.ClaimID, Status: "IDENTITY_UNVERIFIED"}, nil
+}
+
+func CreateDamageAssessment(db *sql.DB, req contract.CreateDamageAssessmentRequest) (contract.CreateDamageAssessmentResponse, error) {
+	if err := app.CreateAssessment(db, req.BusinessKey, req.ClaimID, req.AssessmentID); err != nil {
+		return contract.CreateDamageAssessmentResponse{}, err
+	}
+	log.Printf("operation=CreateDamageAssessment businessKey=%s claimId=%s assessmentId=%s status=SUCCESS", req.BusinessKey, req.ClaimID, req.AssessmentID)
+	return contract.CreateDamageAssessmentResponse{ClaimID: req.ClaimID, AssessmentID: req.AssessmentID, Status: "ASSESSMENT_CREATED"}, nil
+}
+
+func DeleteDamageAssessment(db *sql.DB, req contract.CompensationRequest) (contract.CompensationResponse, error) {
+	if err := app.DeleteAssessment(db, req.BusinessKey, req.ClaimID); err != nil {
+		return contract.CompensationResponse{}, err
+	}
+	log.Printf("operation=DeleteDamageAssessment businessKey=%s claimId=%s status=SUCCESS", req.BusinessKey, req.ClaimID)
+	return contract.CompensationResponse{ClaimID: req.ClaimID, Status: "ASSESSMENT_DELETED"}, nil
+}
+
+func ReservePayoutFunds(db *sql.DB, req contract.ReservePayoutFundsRequest) (contract.ReservePayoutFundsResponse, error) {
+	if err := app.ReserveFunds(db, req.BusinessKey, req.ClaimID, req.PolicyID, req.PayoutAmount); err != nil {
+		return contract.ReservePayoutFundsResponse{}, err
+	}
+	log.Printf("operation=ReservePayoutFunds businessKey=%s claimId=%s amount=%d status=SUCCESS", req.BusinessKey, req.ClaimID, req.PayoutAmount)
+	return contract.ReservePayoutFundsResponse{ClaimID: req.ClaimID, PayoutAmount: req.PayoutAmount, Status: "FUNDS_RESERVED"}, nil
+}
+
+func ReleasePayoutFunds(db *sql.DB, req contract.CompensationRequest) (contract.CompensationResponse, error) {
+	if err := app.ReleaseFunds(db, req.BusinessKey, req.ClaimID); err != nil {
+		return contract.CompensationResponse{}, err
+	}
+	log.Printf("operation=ReleasePayoutFunds businessKey=%s claimId=%s status=SUCCESS", req.BusinessKey, req.ClaimID)
+	return contract.CompensationResponse{ClaimID: req.ClaimID, Status: "FUNDS_RELEASED"}, nil
+}
+
+func NotifyAssignedSurveyor(db *sql.DB, req contract.NotifyAssignedSurveyorRequest) (contract.NotifyAssignedSurveyorResponse, error) {
+	if err := app.NotifySurveyor(db, req.BusinessKey, req.ClaimID, req.SurveyorID); err != nil {
+		return contract.NotifyAssignedSurveyorResponse{}, err
+	}
+	log.Printf("operation=NotifyAssignedSurveyor businessKey=%s claimId=%s surveyorId=%s status=SUCCESS", req.BusinessKey, req.ClaimID, req.SurveyorID)
+	return contract.NotifyAssignedSurveyorResponse{ClaimID: req.ClaimID, SurveyorID: req.SurveyorID, Status: "SURVEYOR_NOTIFIED"}, nil
+}
+
+func CancelSurveyorNotification(db *sql.DB, req contract.CompensationRequest) (contract.CompensationResponse, error) {
+	if err := app.CancelSurveyorNotification(db, req.BusinessKey, req.ClaimID); err != nil {
+		return contract.CompensationResponse{}, err
+	}
+	log.Printf("operation=CancelSurveyorNotification businessKey=%s claimId=%s status=SUCCESS", req.BusinessKey, req.ClaimID)
+	return contract.CompensationResponse{ClaimID: req.ClaimID, Status: "SURVEYOR_NOTIFICATION_CANCELED"}, nil
+}
+
+func ExecuteBankTransfer(db *sql.DB, req contract.ExecuteBankTransferRequest) (contract.ExecuteBankTransferResponse, error) {
+	if err := app.ExecuteTransfer(db, req.BusinessKey, req.ClaimID, req.BankAccount, req.Amount(), req.FailTransfer, req.TransferFaults); err != nil {
+		log.Printf("operation=ExecuteBankTransfer businessKey=%s claimId=%s bankAccount=%s amount=%d status=FAILED error=%s", req.BusinessKey, req.ClaimID, req.BankAccount, req.Amount(), err)
+		return contract.ExecuteBankTransferResponse{}, err
+	}
+	log.Printf("operation=ExecuteBankTransfer businessKey=%s claimId=%s bankAccount=%s amount=%d status=SUCCESS", req.BusinessKey, req.ClaimID, req.BankAccount, req.Amount())
+	return contract.ExecuteBankTransferResponse{ClaimID: req.ClaimID, PaidAmount: req.Amount(), Status: "BANK_TRANSFER_SUCCESS"}, nil
+}
+
+// Handler serves op over HTTP: it reads the named request body, runs op
+// against db and answers with its response, or with the structured error
+// contract.WriteError maps the failure to.
+func Handler[Req any, PReq interface {
+	*Req
+	httpjson.Request
+}, Resp any](db *sql.DB, op func(*sql.DB, Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		if err := httpjson.ReadRequest(r, PReq(&req)); err != nil {
+			contract.WriteError(w, err)
+			return
+		}
+		resp, err := op(db, req)
+		if err != nil {
+			contract.WriteError(w, err)
+			return
+		}
+		httpjson.WriteJSON(w, http.StatusOK, resp)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/contract"
 )
 
 func main() {
@@ -69,19 +70,29 @@ func main() {
 	}
 
 	steps := []struct {
-		name string
-		url  string
-		args []any
+		name    string
+		url     string
+		request any
 	}{
-		{"VerifyIdentity", settings.IdentityBaseURL() + "VerifyIdentity", []any{businessKey, claimID, claimantID}},
-		{"CreateDamageAssessment", settings.AssessmentBaseURL() + "CreateDamageAssessment", []any{businessKey, claimID, assessmentID}},
-		{"ReservePayoutFunds", settings.FundsBaseURL() + "ReservePayoutFunds", []any{businessKey, claimID, payoutAmount}},
-		{"NotifyAssignedSurveyor", settings.SurveyorBaseURL() + "NotifyAssignedSurveyor", []any{businessKey, claimID, surveyorID}},
-		{"ExecuteBankTransfer", settings.TransferBaseURL() + "ExecuteBankTransfer", []any{businessKey, claimID, bankAccount, payoutAmount, failTransfer}},
+		{"VerifyIdentity", settings.IdentityBaseURL() + "VerifyIdentity", contract.VerifyIdentityRequest{
+			BusinessKey: businessKey, ClaimID: claimID, ClaimantID: claimantID,
+		}},
+		{"CreateDamageAssessment", settings.AssessmentBaseURL() + "CreateDamageAssessment", contract.CreateDamageAssessmentRequest{
+			BusinessKey: businessKey, ClaimID: claimID, AssessmentID: assessmentID,
+		}},
+		{"ReservePayoutFunds", settings.FundsBaseURL() + "ReservePayoutFunds", contract.ReservePayoutFundsRequest{
+			BusinessKey: businessKey, ClaimID: claimID, PayoutAmount: payoutAmount,
+		}},
+		{"NotifyAssignedSurveyor", settings.SurveyorBaseURL() + "NotifyAssignedSurveyor", contract.NotifyAssignedSurveyorRequest{
+			BusinessKey: businessKey, ClaimID: claimID, SurveyorID: surveyorID,
+		}},
+		{"ExecuteBankTransfer", settings.TransferBaseURL() + "ExecuteBankTransfer", contract.ExecuteBankTransferRequest{
+			BusinessKey: businessKey, ClaimID: claimID, BankAccount: bankAccount, PayoutAmount: payoutAmount, FailTransfer: failTransfer,
+		}},
 	}
 
 	for _, step := range steps {
-		if err := invoke(step.url, step.args); err != nil {
+		if err := invoke(step.url, step.request); err != nil {
 			fmt.Printf("mode=legacy businessKey=%s failedStep=%s err=%v\n", businessKey, step.name, err)
 			snapshot, snapErr := app.LoadSnapshot(db, claimID)
 			if snapErr != nil {
@@ -103,8 +114,8 @@ func main() {
 	fmt.Println(app.FormatSnapshot(snapshot))
 }
 
-func invoke(url string, args []any) error {
-	body, err := json.Marshal(args)
+func invoke(url string, request any) error {
+	body, err := json.Marshal(request)
 	if err != nil {
 		return err
 	}
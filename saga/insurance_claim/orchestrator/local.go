@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	engcfg "seata.apache.org/seata-go/pkg/saga/statemachine/engine/config"
+	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/invoker"
+)
+
+// registerLocalServices registers the in-process claim services on the
+// local invoker, under the ServiceName the definitions use.
+func registerLocalServices(cfgIface any, services map[string]any) error {
+	if len(services) == 0 {
+		return nil
+	}
+	cfg := cfgIface.(*engcfg.DefaultStateMachineConfig)
+	localInvoker, ok := cfg.ServiceInvokerManager().ServiceInvoker("local").(*invoker.LocalServiceInvoker)
+	if !ok {
+		return fmt.Errorf("local invoker is not initialized")
+	}
+	for name, service := range services {
+		localInvoker.RegisterService(name, service)
+	}
+	return nil
+}
+
+// localizeDefinitions copies the definitions matching pattern into a new
+// temporary directory and switches every ServiceTask whose ServiceName is in
+// services to the local invoker. The HTTP services route by state name, so
+// the state name becomes the ServiceMethod, which is also the method name of
+// the local service. Everything else, including Catch and Retry, is kept.
+func localizeDefinitions(pattern string, services map[string]any) (string, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no state machine definitions match %s", pattern)
+	}
+
+	dir, err := os.MkdirTemp("", "insurance-claim-statelang-*")
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return "", err
+		}
+		localized, err := localizeDefinition(raw, services)
+		if err != nil {
+			_ = os.RemoveAll(dir)
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(path)), localized, 0o644); err != nil {
+			_ = os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func localizeDefinition(raw []byte, services map[string]any) ([]byte, error) {
+	var def map[string]any
+	if err := json.Unmarshal(raw, &def); err != nil {
+		return nil, err
+	}
+	states, _ := def["States"].(map[string]any)
+	for name, value := range states {
+		state, ok := value.(map[string]any)
+		if !ok {
+			continue
+		}
+		serviceName, _ := state["ServiceName"].(string)
+		if _, ok := services[serviceName]; !ok {
+			continue
+		}
+		state["ServiceType"] = "local"
+		state["ServiceMethod"] = name
+	}
+	return json.MarshalIndent(def, "", "  ")
+}
@@ -19,15 +19,25 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"flag"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/expect"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/local"
+	"seata.apache.org/seata-go-samples/saga/invariant"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
 	"seata.apache.org/seata-go/pkg/client"
 	engcfg "seata.apache.org/seata-go/pkg/saga/statemachine/engine/config"
 	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/core"
@@ -35,21 +45,37 @@ import (
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run is main without os.Exit, so that the deferred cleanup of the engine
+// and its localized definitions runs on every exit path.
+func run() int {
 	var (
-		seataConf    string
-		engineConf   string
-		businessKey  string
-		claimID      string
-		claimantID   string
-		assessmentID string
-		surveyorID   string
-		bankAccount  string
-		payoutAmount int
-		failTransfer bool
+		seataConf      string
+		engineConf     string
+		serve          bool
+		callbackURL    string
+		pollInterval   time.Duration
+		businessKey    string
+		claimID        string
+		claimantID     string
+		assessmentID   string
+		surveyorID     string
+		bankAccount    string
+		payoutAmount   int
+		failTransfer   bool
+		transferFaults string
+		policyID       string
+		settledAmount  int
+		failAt         string
 	)
 
 	flag.StringVar(&seataConf, "seataConf", "seatago.yaml", "path to the seata-go client config")
 	flag.StringVar(&engineConf, "engineConf", "config.yaml", "path to the Saga engine config")
+	flag.BoolVar(&serve, "serve", false, "run as a long-running HTTP server instead of starting a single claim")
+	flag.StringVar(&callbackURL, "callbackUrl", "", "URL that receives a POST when an async claim finishes (server mode)")
+	flag.DurationVar(&pollInterval, "pollInterval", 500*time.Millisecond, "how often async claims are polled for completion (server mode)")
 	flag.StringVar(&businessKey, "businessKey", "insurance-claim-saga-demo", "business key")
 	flag.StringVar(&claimID, "claimId", "claim-1001", "insurance claim ID")
 	flag.StringVar(&claimantID, "claimantId", "claimant-9001", "claimant ID")
@@ -58,99 +84,255 @@ func main() {
 	flag.StringVar(&bankAccount, "bankAccount", "6222020202020202", "bank account")
 	flag.IntVar(&payoutAmount, "payoutAmount", 1500, "payout amount")
 	flag.BoolVar(&failTransfer, "failTransfer", false, "simulate a bank transfer failure")
+	flag.StringVar(&policyID, "policyId", app.DefaultPolicyID, "policy charged for the payout")
+	flag.IntVar(&settledAmount, "settledAmount", 0, "amount actually paid out; the rest of the reservation is released (default: payoutAmount)")
+	flag.StringVar(&transferFaults, "transferFaults", "", "comma-separated bank responses per transfer attempt: 503, timeout or invalid")
+	flag.StringVar(&failAt, "failAt", "", "fail the forward action of one step: identity, assessment, funds, surveyor or transfer")
 	flag.Parse()
 
+	if failTransfer && failAt == "" {
+		failAt = expect.Transfer
+	}
+	if failAt == expect.Transfer {
+		failTransfer = true
+	}
+
 	seataConf, err := resolveSamplePath(seataConf)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to locate the seata-go client config: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 	engineConf, err = resolveSamplePath(engineConf)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to locate the Saga engine config: %v\n", err)
-		os.Exit(1)
+		return 1
 	}
 
-	client.InitPath(seataConf)
-
-	engine, err := newStateMachineEngine()
+	settings := app.LoadSettings()
+	selected, err := local.Select(settings.LocalServices)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to create the state machine engine: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "invalid CLAIM_LOCAL_SERVICES: %v\n", err)
+		return 1
 	}
 
-	cfgIface := engine.GetStateMachineConfig()
-	cfg, ok := cfgIface.(*engcfg.DefaultStateMachineConfig)
-	if !ok {
-		fmt.Fprintf(os.Stderr, "unexpected state machine config type: %T\n", cfgIface)
-		os.Exit(1)
+	db, err := openClaimDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
 	}
+	defer db.Close()
 
-	settings := app.LoadSettings()
-	runtimeEngineConf, cleanup, err := prepareRuntimeEngineConfig(engineConf, settings)
+	// Services run in-process share one set of fault rules, which -failAt
+	// sets directly instead of through the /faults endpoint.
+	localFaults := &faults.Injector{}
+	engine, cleanup, err := startEngine(seataConf, engineConf, settings, local.New(db, localFaults, selected))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to prepare the runtime engine config: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
 	}
 	defer cleanup()
 
-	if err := cfg.LoadConfig(runtimeEngineConf); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load the engine config: %v\n", err)
-		os.Exit(1)
+	if serve {
+		addr := fmt.Sprintf(":%s", settings.OrchestratorPort)
+		log.Printf("insurance claim orchestrator listening on %s\n", addr)
+		server := newClaimServer(engine, db, trackerConfig{
+			callbackURL:  callbackURL,
+			pollInterval: pollInterval,
+		})
+		log.Println(http.ListenAndServe(addr, server.routes()))
+		return 1
 	}
-	if err := cfg.Init(); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to initialize the engine config: %v\n", err)
-		os.Exit(1)
+
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to reset the sample data: %v\n", err)
+		return 1
 	}
 
-	registerHTTPClients(cfgIface, settings)
+	expected, err := expect.For(failAt, expect.Claim{PolicyID: policyID, PayoutAmount: payoutAmount, SettledAmount: settledAmount})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	// The bank transfer fails through failTransfer; every other step gets a
+	// one-shot fault rule on its service for the duration of the run.
+	injectFaults := func(string) error { return nil }
+	if failAt != expect.None && failAt != expect.Transfer {
+		injectFaults = func(spec string) error {
+			return putFaults(settings, selected, localFaults, failAt, spec)
+		}
+		if err := injectFaults(failAt + "." + faults.Forward + "=" + faults.ModeError + "*1"); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to inject the %s failure: %v\n", failAt, err)
+			return 1
+		}
+	}
 
-	db, err := app.OpenDB()
+	params := claimParams(startClaimRequest{
+		BusinessKey:    businessKey,
+		ClaimID:        claimID,
+		ClaimantID:     claimantID,
+		AssessmentID:   assessmentID,
+		SurveyorID:     surveyorID,
+		BankAccount:    bankAccount,
+		PayoutAmount:   payoutAmount,
+		FailTransfer:   failTransfer,
+		TransferFaults: transferFaults,
+		PolicyID:       policyID,
+		SettledAmount:  settledAmount,
+	})
+
+	instance, err := engine.StartWithBusinessKey(context.Background(), stateMachineName, "", businessKey, params)
+	if err := injectFaults(""); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to clear the %s fault rules: %v\n", failAt, err)
+	}
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to open the database: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "failed to start the Saga: %v\n", err)
+		return 1
 	}
-	defer db.Close()
 
-	if err := app.EnsureBusinessSchema(db); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to initialize the business schema: %v\n", err)
-		os.Exit(1)
+	snapshot, err := app.LoadSnapshot(db, claimID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load the insurance claim snapshot: %v\n", err)
+		return 1
 	}
-	if err := app.EnsureSagaStoreSchema(db); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to ensure the Saga store schema: %v\n", err)
-		os.Exit(1)
+
+	fmt.Printf("mode=saga businessKey=%s xid=%s status=%s compensationStatus=%s transferAttempts=%d\n",
+		businessKey, instance.ID(), instance.Status(), instance.CompensationStatus(), snapshot.TransferAttempts)
+	fmt.Println(app.FormatSnapshot(snapshot))
+
+	if err := app.CheckClaimLedger(db, claimID); err != nil {
+		fmt.Printf("ledger=VIOLATED %v\n", err)
+		return 1
 	}
-	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to reset the sample data: %v\n", err)
-		os.Exit(1)
+	fmt.Println("ledger=OK")
+
+	if violations, err := checkInvariants(db, engineConf, instance.ID()); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to check the state machine invariants: %v\n", err)
+		return 1
+	} else if len(violations) > 0 {
+		fmt.Printf("invariants=VIOLATED %s\n", strings.Join(violations, "; "))
+		return 1
 	}
+	fmt.Println("invariants=OK")
 
-	params := map[string]any{
-		"businessKey":  businessKey,
-		"claimId":      claimID,
-		"claimantId":   claimantID,
-		"assessmentId": assessmentID,
-		"surveyorId":   surveyorID,
-		"bankAccount":  bankAccount,
-		"payoutAmount": payoutAmount,
-		"failTransfer": failTransfer,
+	if transferFaults != "" {
+		fmt.Println("expectations=SKIPPED the outcome depends on -transferFaults")
+		return 0
+	}
+	if err := expect.Verify(db, instance.ID(), claimID, expected); err != nil {
+		fmt.Printf("expectations=MISMATCH %v\n", err)
+		return 1
 	}
+	fmt.Println("expectations=OK")
+	return 0
+}
 
-	instance, err := engine.StartWithBusinessKey(context.Background(), "InsuranceClaimSaga", "", businessKey, params)
+// checkInvariants checks the generic state machine invariants for xid
+// against the definition the engine loaded.
+func checkInvariants(db *sql.DB, engineConf, xid string) ([]string, error) {
+	defs, err := statelang.LoadGlob(filepath.Join(filepath.Dir(engineConf), "statelang", "*.json"))
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to start the Saga: %v\n", err)
-		os.Exit(1)
+		return nil, err
+	}
+	def, err := statelang.Find(defs, stateMachineName)
+	if err != nil {
+		return nil, err
 	}
+	machine, err := sagastore.LoadMachine(db, xid)
+	if err != nil {
+		return nil, err
+	}
+	states, err := sagastore.LoadStates(db, xid)
+	if err != nil {
+		return nil, err
+	}
+	return invariant.Check(def, machine, states), nil
+}
 
-	snapshot, err := app.LoadSnapshot(db, claimID)
+// serviceBaseURL returns the base URL of the service that runs step.
+func serviceBaseURL(settings app.Settings, step string) string {
+	switch step {
+	case expect.Identity:
+		return settings.IdentityBaseURL()
+	case expect.Assessment:
+		return settings.AssessmentBaseURL()
+	case expect.Funds:
+		return settings.FundsBaseURL()
+	case expect.Surveyor:
+		return settings.SurveyorBaseURL()
+	}
+	return settings.TransferBaseURL()
+}
+
+// putFaults replaces the fault rules of the service that runs step: in
+// process when that service is local, otherwise through its /faults endpoint.
+func putFaults(settings app.Settings, selected map[string]bool, localFaults *faults.Injector, step string, spec string) error {
+	if selected[local.ServiceFor(step)] {
+		rules, err := faults.ParseRules(spec)
+		if err != nil {
+			return err
+		}
+		localFaults.Set(rules)
+		return nil
+	}
+	return faults.Put(serviceBaseURL(settings, step), spec)
+}
+
+// startEngine initializes the seata-go client and a Saga engine wired to the
+// five claim services: localServices, keyed by service name, through the
+// local invoker and the rest over HTTP. The returned cleanup removes the
+// runtime engine config and definitions.
+func startEngine(seataConf string, engineConf string, settings app.Settings, localServices map[string]any) (*core.ProcessCtrlStateMachineEngine, func(), error) {
+	client.InitPath(seataConf)
+
+	engine, err := newStateMachineEngine()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load the insurance claim snapshot: %v\n", err)
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("failed to create the state machine engine: %w", err)
 	}
 
-	fmt.Printf("mode=saga businessKey=%s xid=%s status=%s compensationStatus=%s\n",
-		businessKey, instance.ID(), instance.Status(), instance.CompensationStatus())
-	fmt.Println(app.FormatSnapshot(snapshot))
+	cfgIface := engine.GetStateMachineConfig()
+	cfg, ok := cfgIface.(*engcfg.DefaultStateMachineConfig)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected state machine config type: %T", cfgIface)
+	}
+
+	runtimeEngineConf, cleanup, err := prepareRuntimeEngineConfig(engineConf, settings, localServices)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare the runtime engine config: %w", err)
+	}
+
+	if err := cfg.LoadConfig(runtimeEngineConf); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to load the engine config: %w", err)
+	}
+	if err := cfg.Init(); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("failed to initialize the engine config: %w", err)
+	}
+
+	registerHTTPClients(cfgIface, settings)
+	if err := registerLocalServices(cfgIface, localServices); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return engine, cleanup, nil
+}
+
+// openClaimDB opens the sample database and makes sure both the business
+// tables and the Saga store columns are in the expected shape.
+func openClaimDB() (*sql.DB, error) {
+	db, err := app.OpenDB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the database: %w", err)
+	}
+	if err := app.EnsureBusinessSchema(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize the business schema: %w", err)
+	}
+	if err := app.EnsureSagaStoreSchema(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to ensure the Saga store schema: %w", err)
+	}
+	return db, nil
 }
 
 func registerHTTPClients(cfgIface any, settings app.Settings) {
@@ -210,7 +392,10 @@ func fileMustExist(path string) error {
 	return nil
 }
 
-func prepareRuntimeEngineConfig(engineConf string, settings app.Settings) (string, func(), error) {
+// prepareRuntimeEngineConfig writes the engine config the orchestrator
+// loads. When some services run locally, the definitions are loaded from
+// copies switched to the local invoker for those services.
+func prepareRuntimeEngineConfig(engineConf string, settings app.Settings, localServices map[string]any) (string, func(), error) {
 	raw, err := os.ReadFile(engineConf)
 	if err != nil {
 		return "", nil, err
@@ -220,11 +405,27 @@ func prepareRuntimeEngineConfig(engineConf string, settings app.Settings) (strin
 	if err := yaml.Unmarshal(raw, &cfg); err != nil {
 		return "", nil, err
 	}
+	resources := filepath.Join(filepath.Dir(engineConf), "statelang", "*.json")
+	localizedDir := ""
+	if len(localServices) > 0 {
+		localizedDir, err = localizeDefinitions(resources, localServices)
+		if err != nil {
+			return "", nil, err
+		}
+		resources = filepath.Join(localizedDir, "*.json")
+	}
 	cfg["store_dsn"] = settings.MySQLDSN()
-	cfg["state_machine_resources"] = []string{filepath.Join(filepath.Dir(engineConf), "statelang", "*.json")}
+	cfg["enable_async"] = true
+	cfg["state_machine_resources"] = []string{resources}
 
+	cleanup := func() {
+		if localizedDir != "" {
+			_ = os.RemoveAll(localizedDir)
+		}
+	}
 	file, err := os.CreateTemp("", "insurance-claim-saga-*.yaml")
 	if err != nil {
+		cleanup()
 		return "", nil, err
 	}
 	defer file.Close()
@@ -234,15 +435,19 @@ func prepareRuntimeEngineConfig(engineConf string, settings app.Settings) (strin
 	if err := encoder.Encode(cfg); err != nil {
 		_ = os.Remove(file.Name())
 		_ = encoder.Close()
+		cleanup()
 		return "", nil, err
 	}
 	if err := encoder.Close(); err != nil {
 		_ = os.Remove(file.Name())
+		cleanup()
 		return "", nil, err
 	}
 
-	cleanup := func() {
+	removeDefinitions := cleanup
+	cleanup = func() {
 		_ = os.Remove(file.Name())
+		removeDefinitions()
 	}
 	return file.Name(), cleanup, nil
 }
@@ -0,0 +1,205 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+const (
+	// trackTimeout bounds how long an async claim is polled before the
+	// tracker gives up; the Saga itself keeps running in the engine.
+	trackTimeout     = time.Hour
+	callbackAttempts = 3
+)
+
+type trackerConfig struct {
+	callbackURL  string
+	pollInterval time.Duration
+}
+
+// claimProgress is what the orchestrator knows about an async claim beyond
+// the Saga store: whether the tracker has seen it finish and whether the
+// completion callback has been delivered.
+type claimProgress struct {
+	Mode              string `json:"mode"`
+	Completed         bool   `json:"completed"`
+	CallbackURL       string `json:"callbackUrl,omitempty"`
+	CallbackAttempts  int    `json:"callbackAttempts"`
+	CallbackDelivered bool   `json:"callbackDelivered"`
+	CallbackError     string `json:"callbackError,omitempty"`
+}
+
+type acceptedClaim struct {
+	ClaimID     string `json:"claimId"`
+	BusinessKey string `json:"businessKey"`
+	XID         string `json:"xid"`
+	Status      string `json:"status"`
+}
+
+// startAsync hands the claim to the engine without waiting for the transfer
+// and answers 202 with the XID. Completion is picked up by track.
+func (s *claimServer) startAsync(w http.ResponseWriter, req startClaimRequest) {
+	instance, err := s.engine.StartWithBusinessKeyAsync(context.Background(), stateMachineName, "", req.BusinessKey, claimParams(req), nil)
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, fmt.Sprintf("failed to start the Saga: %v", err))
+		return
+	}
+
+	callbackURL := req.CallbackURL
+	if callbackURL == "" {
+		callbackURL = s.tracker.callbackURL
+	}
+	ref := claimRef{
+		businessKey: req.BusinessKey,
+		xid:         instance.ID(),
+		progress:    &claimProgress{Mode: "async", CallbackURL: callbackURL},
+	}
+	s.remember(req.ClaimID, ref)
+	log.Printf("operation=StartClaimAsync businessKey=%s claimId=%s xid=%s", req.BusinessKey, req.ClaimID, instance.ID())
+
+	go s.track(req.ClaimID, ref)
+
+	httpjson.WriteJSON(w, http.StatusAccepted, acceptedClaim{
+		ClaimID:     req.ClaimID,
+		BusinessKey: req.BusinessKey,
+		XID:         instance.ID(),
+		Status:      string(instance.Status()),
+	})
+}
+
+// track polls the Saga store until the instance has finished, then delivers
+// the completion callback if one is configured for the claim.
+func (s *claimServer) track(claimID string, ref claimRef) {
+	ticker := time.NewTicker(s.tracker.pollInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(trackTimeout)
+
+	var machine app.MachineStatus
+	for {
+		<-ticker.C
+		row, err := sagastore.LoadMachine(s.db, ref.xid)
+		if err != nil {
+			log.Printf("operation=TrackClaim claimId=%s xid=%s error=%v", claimID, ref.xid, err)
+		} else if status := app.NewMachineStatus(row); status.Finished() {
+			machine = status
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("operation=TrackClaim claimId=%s xid=%s error=gave up after %s", claimID, ref.xid, trackTimeout)
+			return
+		}
+	}
+
+	s.updateProgress(claimID, func(p *claimProgress) { p.Completed = true })
+	log.Printf("operation=TrackClaim claimId=%s xid=%s status=%s compensationStatus=%s", claimID, ref.xid, machine.Status, machine.CompensationStatus)
+
+	if ref.progress.CallbackURL == "" {
+		return
+	}
+	snapshot, err := app.LoadSnapshot(s.db, claimID)
+	if err != nil {
+		s.updateProgress(claimID, func(p *claimProgress) { p.CallbackError = err.Error() })
+		return
+	}
+	s.deliver(claimID, ref.progress.CallbackURL, app.CompletionEvent{
+		ClaimID:            claimID,
+		BusinessKey:        ref.businessKey,
+		XID:                ref.xid,
+		Status:             machine.Status,
+		CompensationStatus: machine.CompensationStatus,
+		Snapshot:           snapshot,
+	})
+}
+
+// deliver POSTs the completion event, retrying with a doubling delay when the
+// receiver is unreachable or answers with a non-2xx status.
+func (s *claimServer) deliver(claimID string, callbackURL string, event app.CompletionEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		s.updateProgress(claimID, func(p *claimProgress) { p.CallbackError = err.Error() })
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	delay := time.Second
+	for attempt := 1; attempt <= callbackAttempts; attempt++ {
+		err = postCallback(client, callbackURL, body)
+		attempts := attempt
+		s.updateProgress(claimID, func(p *claimProgress) {
+			p.CallbackAttempts = attempts
+			p.CallbackDelivered = err == nil
+			p.CallbackError = ""
+			if err != nil {
+				p.CallbackError = err.Error()
+			}
+		})
+		if err == nil {
+			log.Printf("operation=ClaimCallback claimId=%s url=%s attempt=%d status=SUCCESS", claimID, callbackURL, attempt)
+			return
+		}
+		log.Printf("operation=ClaimCallback claimId=%s url=%s attempt=%d error=%v", claimID, callbackURL, attempt, err)
+		if attempt < callbackAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+}
+
+func postCallback(client *http.Client, callbackURL string, body []byte) error {
+	resp, err := client.Post(callbackURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *claimServer) updateProgress(claimID string, update func(p *claimProgress)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ref, ok := s.claims[claimID]; ok && ref.progress != nil {
+		update(ref.progress)
+	}
+}
+
+// progressOf returns a copy of the claim's progress, or nil for claims that
+// were started synchronously or by an earlier run of the server.
+func (s *claimServer) progressOf(claimID string) *claimProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref, ok := s.claims[claimID]
+	if !ok || ref.progress == nil {
+		return nil
+	}
+	progress := *ref.progress
+	return &progress
+}
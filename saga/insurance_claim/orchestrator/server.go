@@ -0,0 +1,329 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go/pkg/saga/statemachine/engine/core"
+)
+
+const stateMachineName = "InsuranceClaimSaga"
+
+// startClaimRequest is the body of POST /claims. Every field except claimId
+// falls back to the same defaults as the command-line flags. Async claims
+// return as soon as the engine has assigned an XID; callbackUrl overrides
+// the server-wide completion callback for that claim.
+type startClaimRequest struct {
+	BusinessKey  string `json:"businessKey"`
+	ClaimID      string `json:"claimId"`
+	ClaimantID   string `json:"claimantId"`
+	AssessmentID string `json:"assessmentId"`
+	SurveyorID   string `json:"surveyorId"`
+	BankAccount  string `json:"bankAccount"`
+	PayoutAmount int    `json:"payoutAmount"`
+	FailTransfer bool   `json:"failTransfer"`
+	PolicyID     string `json:"policyId"`
+	// SettledAmount pays out less than was reserved; the rest is released.
+	SettledAmount int `json:"settledAmount"`
+	// TransferFaults simulates one bank response per transfer attempt, e.g.
+	// "503,timeout" makes the first two attempts fail transiently.
+	TransferFaults string `json:"transferFaults"`
+
+	Async       bool   `json:"async"`
+	CallbackURL string `json:"callbackUrl"`
+}
+
+type claimResponse struct {
+	ClaimID     string            `json:"claimId"`
+	BusinessKey string            `json:"businessKey"`
+	Machine     app.MachineStatus `json:"machine"`
+	Snapshot    app.Snapshot      `json:"snapshot"`
+	Progress    *claimProgress    `json:"progress,omitempty"`
+	// LedgerCheck is "OK" or the ledger invariant the claim violates.
+	LedgerCheck string `json:"ledgerCheck"`
+}
+
+// claimRef remembers which Saga instance handled a claim so that lookups do
+// not depend on the services having written a step log yet.
+type claimRef struct {
+	businessKey string
+	xid         string
+	progress    *claimProgress
+}
+
+type claimServer struct {
+	engine  *core.ProcessCtrlStateMachineEngine
+	db      *sql.DB
+	tracker trackerConfig
+
+	mu     sync.Mutex
+	claims map[string]claimRef
+	// starting holds the claims whose POST /claims is between the
+	// duplicate check and remember, so that a second request for the same
+	// claim is refused instead of starting another Saga.
+	starting map[string]bool
+}
+
+func newClaimServer(engine *core.ProcessCtrlStateMachineEngine, db *sql.DB, tracker trackerConfig) *claimServer {
+	return &claimServer{
+		engine:   engine,
+		db:       db,
+		tracker:  tracker,
+		claims:   make(map[string]claimRef),
+		starting: make(map[string]bool),
+	}
+}
+
+func claimParams(req startClaimRequest) map[string]any {
+	return map[string]any{
+		"businessKey":    req.BusinessKey,
+		"claimId":        req.ClaimID,
+		"claimantId":     req.ClaimantID,
+		"assessmentId":   req.AssessmentID,
+		"surveyorId":     req.SurveyorID,
+		"bankAccount":    req.BankAccount,
+		"payoutAmount":   req.PayoutAmount,
+		"failTransfer":   req.FailTransfer,
+		"transferFaults": req.TransferFaults,
+		"policyId":       req.PolicyID,
+		"settledAmount":  req.SettledAmount,
+	}
+}
+
+func (s *claimServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
+		httpjson.WriteText(w, http.StatusOK, "OK")
+	})
+	mux.HandleFunc("/claims", s.handleStart)
+	mux.HandleFunc("/claims/", s.handleClaim)
+	return mux
+}
+
+func (s *claimServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httpjson.WriteText(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	var req startClaimRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		httpjson.WriteText(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.ClaimID == "" {
+		httpjson.WriteText(w, http.StatusBadRequest, "claimId is required")
+		return
+	}
+	applyClaimDefaults(&req)
+
+	if !s.reserve(req.ClaimID) {
+		httpjson.WriteText(w, http.StatusConflict, fmt.Sprintf("claim %s already exists", req.ClaimID))
+		return
+	}
+	defer s.release(req.ClaimID)
+	if _, err := s.lookup(req.ClaimID); err == nil {
+		httpjson.WriteText(w, http.StatusConflict, fmt.Sprintf("claim %s already exists", req.ClaimID))
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if req.Async {
+		s.startAsync(w, req)
+		return
+	}
+
+	// The Saga runs to its end even if the client goes away, so it does not
+	// get the request context.
+	instance, err := s.engine.StartWithBusinessKey(context.Background(), stateMachineName, "", req.BusinessKey, claimParams(req))
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, fmt.Sprintf("failed to start the Saga: %v", err))
+		return
+	}
+	s.remember(req.ClaimID, claimRef{businessKey: req.BusinessKey, xid: instance.ID()})
+	log.Printf("operation=StartClaim businessKey=%s claimId=%s xid=%s status=%s", req.BusinessKey, req.ClaimID, instance.ID(), instance.Status())
+
+	s.writeClaim(w, http.StatusCreated, req.ClaimID)
+}
+
+func (s *claimServer) handleClaim(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/claims/"), "/")
+	claimID := parts[0]
+	if claimID == "" || len(parts) > 2 {
+		httpjson.WriteText(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		s.writeClaim(w, http.StatusOK, claimID)
+	case len(parts) == 2 && parts[1] == "compensate" && r.Method == http.MethodPost:
+		s.compensate(r.Context(), w, claimID)
+	case len(parts) == 2 && parts[1] != "compensate":
+		httpjson.WriteText(w, http.StatusNotFound, "not found")
+	default:
+		httpjson.WriteText(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *claimServer) compensate(ctx context.Context, w http.ResponseWriter, claimID string) {
+	ref, err := s.lookup(claimID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpjson.WriteText(w, http.StatusNotFound, fmt.Sprintf("claim %s not found", claimID))
+		return
+	}
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	instance, err := s.engine.Compensate(ctx, ref.xid, nil)
+	if err != nil {
+		httpjson.WriteText(w, http.StatusConflict, fmt.Sprintf("failed to compensate the Saga: %v", err))
+		return
+	}
+	log.Printf("operation=CompensateClaim businessKey=%s claimId=%s xid=%s compensationStatus=%s", ref.businessKey, claimID, ref.xid, instance.CompensationStatus())
+
+	s.writeClaim(w, http.StatusOK, claimID)
+}
+
+func (s *claimServer) writeClaim(w http.ResponseWriter, statusCode int, claimID string) {
+	ref, err := s.lookup(claimID)
+	if errors.Is(err, sql.ErrNoRows) {
+		httpjson.WriteText(w, http.StatusNotFound, fmt.Sprintf("claim %s not found", claimID))
+		return
+	}
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	machine, err := sagastore.LoadMachine(s.db, ref.xid)
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, fmt.Sprintf("failed to load the Saga status: %v", err))
+		return
+	}
+	snapshot, err := app.LoadSnapshot(s.db, claimID)
+	if err != nil {
+		httpjson.WriteText(w, http.StatusInternalServerError, fmt.Sprintf("failed to load the insurance claim snapshot: %v", err))
+		return
+	}
+
+	ledgerCheck := "OK"
+	if err := app.CheckClaimLedger(s.db, claimID); err != nil {
+		ledgerCheck = err.Error()
+	}
+
+	httpjson.WriteJSON(w, statusCode, claimResponse{
+		ClaimID:     claimID,
+		BusinessKey: ref.businessKey,
+		Machine:     app.NewMachineStatus(machine),
+		Snapshot:    snapshot,
+		Progress:    s.progressOf(claimID),
+		LedgerCheck: ledgerCheck,
+	})
+}
+
+// lookup resolves a claim to its Saga instance. Claims started by an earlier
+// run of the server are found through the step log and the Saga store.
+func (s *claimServer) lookup(claimID string) (claimRef, error) {
+	s.mu.Lock()
+	ref, ok := s.claims[claimID]
+	s.mu.Unlock()
+	if ok {
+		return ref, nil
+	}
+
+	businessKey, err := app.FindBusinessKey(s.db, claimID)
+	if err != nil {
+		return claimRef{}, err
+	}
+	machine, err := sagastore.FindLatest(s.db, businessKey)
+	if err != nil {
+		return claimRef{}, err
+	}
+	ref = claimRef{businessKey: businessKey, xid: machine.ID}
+	s.remember(claimID, ref)
+	return ref, nil
+}
+
+// reserve claims claimID for one start request, failing if the claim is
+// already known or another request is starting it. release ends the
+// reservation once the claim is remembered or its start failed.
+func (s *claimServer) reserve(claimID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.claims[claimID]; ok || s.starting[claimID] {
+		return false
+	}
+	s.starting[claimID] = true
+	return true
+}
+
+func (s *claimServer) release(claimID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.starting, claimID)
+}
+
+func (s *claimServer) remember(claimID string, ref claimRef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.claims[claimID]; ok && ref.progress == nil {
+		return
+	}
+	s.claims[claimID] = ref
+}
+
+func applyClaimDefaults(req *startClaimRequest) {
+	if req.BusinessKey == "" {
+		req.BusinessKey = "insurance-claim-" + req.ClaimID
+	}
+	if req.ClaimantID == "" {
+		req.ClaimantID = "claimant-9001"
+	}
+	if req.AssessmentID == "" {
+		req.AssessmentID = "assessment-7001"
+	}
+	if req.SurveyorID == "" {
+		req.SurveyorID = "surveyor-3001"
+	}
+	if req.BankAccount == "" {
+		req.BankAccount = "6222020202020202"
+	}
+	if req.PayoutAmount == 0 {
+		req.PayoutAmount = 1500
+	}
+	if req.PolicyID == "" {
+		req.PolicyID = app.DefaultPolicyID
+	}
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+)
+
+var errInjected = errors.New("INJECTED_FAULT")
+
+// checkAtomicity fails every action between its business write and its step
+// log entry. The failed call must leave the snapshot untouched, and the retry
+// must then commit the business change together with exactly one log entry.
+func checkAtomicity(db *sql.DB) error {
+	const (
+		businessKey = "insurance-claim-selfcheck-atomicity"
+		claimID     = "claim-selfcheck-atomicity"
+	)
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		return err
+	}
+	defer app.SetFaultHook(nil)
+
+	calls := []struct {
+		step   string
+		action string
+		call   func() error
+	}{
+		{"identity", "verify", func() error { return app.RecordIdentityVerified(db, businessKey, claimID, "claimant-9001") }},
+		{"assessment", "create", func() error { return app.CreateAssessment(db, businessKey, claimID, "assessment-7001") }},
+		{"funds", "reserve", func() error { return app.ReserveFunds(db, businessKey, claimID, app.DefaultPolicyID, 1500) }},
+		{"surveyor", "notify", func() error { return app.NotifySurveyor(db, businessKey, claimID, "surveyor-3001") }},
+		{"transfer", "execute", func() error {
+			return app.ExecuteTransfer(db, businessKey, claimID, "6222020202020202", 1500, false, "")
+		}},
+		{"surveyor", "compensate", func() error { return app.CancelSurveyorNotification(db, businessKey, claimID) }},
+		{"funds", "compensate", func() error { return app.ReleaseFunds(db, businessKey, claimID) }},
+		{"assessment", "compensate", func() error { return app.DeleteAssessment(db, businessKey, claimID) }},
+		{"identity", "compensate", func() error { return app.UnverifyIdentity(db, businessKey, claimID) }},
+	}
+
+	for _, c := range calls {
+		name := c.step + ":" + c.action
+		before, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+
+		step, action := c.step, c.action
+		app.SetFaultHook(func(stepName string, actionName string) error {
+			if stepName == step && actionName == action {
+				return errInjected
+			}
+			return nil
+		})
+		if err := c.call(); !errors.Is(err, errInjected) {
+			return fmt.Errorf("%s: faulted call returned %v, want %v", name, err, errInjected)
+		}
+		afterFault, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(before, afterFault) {
+			return fmt.Errorf("%s: faulted call left partial state behind\nbefore:\n%s\nafter:\n%s",
+				name, app.FormatSnapshot(before), app.FormatSnapshot(afterFault))
+		}
+
+		app.SetFaultHook(nil)
+		if err := c.call(); err != nil {
+			return fmt.Errorf("%s: retry after fault returned %v", name, err)
+		}
+		afterRetry, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+		if len(afterRetry.OrderedActionTrail) != len(before.OrderedActionTrail)+1 {
+			return fmt.Errorf("%s: retry wrote %d step log entries, want 1",
+				name, len(afterRetry.OrderedActionTrail)-len(before.OrderedActionTrail))
+		}
+	}
+	return nil
+}
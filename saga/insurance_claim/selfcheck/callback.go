@@ -0,0 +1,116 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+)
+
+const callbackWait = time.Minute
+
+// checkCallback starts one successful and one failing claim asynchronously on
+// a running orchestrator and verifies that both are answered with an XID
+// right away and later reported to a local callback receiver.
+func checkCallback(_ *sql.DB) error {
+	received := make(chan app.CompletionEvent, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event app.CompletionEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- event
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	cases := []struct {
+		failTransfer       bool
+		status             string
+		compensationStatus string
+	}{
+		{false, "SU", ""},
+		{true, "FA", "SU"},
+	}
+	for _, c := range cases {
+		claimID := fmt.Sprintf("claim-selfcheck-callback-%d", time.Now().UnixNano())
+		accepted, err := startAsyncClaim(claimID, c.failTransfer, receiver.URL)
+		if err != nil {
+			return err
+		}
+		if accepted.XID == "" {
+			return fmt.Errorf("%s: async start returned no xid", claimID)
+		}
+
+		var event app.CompletionEvent
+		select {
+		case event = <-received:
+		case <-time.After(callbackWait):
+			return fmt.Errorf("%s: no callback within %s", claimID, callbackWait)
+		}
+		if event.ClaimID != claimID || event.XID != accepted.XID {
+			return fmt.Errorf("%s: callback for claim %s xid %s, want xid %s", claimID, event.ClaimID, event.XID, accepted.XID)
+		}
+		if event.Status != c.status || event.CompensationStatus != c.compensationStatus {
+			return fmt.Errorf("%s: callback status=%s compensationStatus=%s, want %s/%s",
+				claimID, event.Status, event.CompensationStatus, c.status, c.compensationStatus)
+		}
+	}
+	return nil
+}
+
+type acceptedClaim struct {
+	ClaimID string `json:"claimId"`
+	XID     string `json:"xid"`
+}
+
+func startAsyncClaim(claimID string, failTransfer bool, callbackURL string) (acceptedClaim, error) {
+	var accepted acceptedClaim
+	body, err := json.Marshal(map[string]any{
+		"claimId":      claimID,
+		"failTransfer": failTransfer,
+		"async":        true,
+		"callbackUrl":  callbackURL,
+	})
+	if err != nil {
+		return accepted, err
+	}
+
+	started := time.Now()
+	resp, err := http.Post(orchestratorURL+"/claims", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return accepted, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return accepted, fmt.Errorf("%s: async start returned %s, want 202", claimID, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accepted); err != nil {
+		return accepted, err
+	}
+	fmt.Printf("claimId=%s xid=%s accepted in %s\n", claimID, accepted.XID, time.Since(started).Round(time.Millisecond))
+	return accepted, nil
+}
@@ -0,0 +1,106 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/contract"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+)
+
+// checkContract decodes the same transfer request in every accepted body
+// form, and verifies that invalid requests and action failures turn into
+// the expected structured errors.
+func checkContract(_ *sql.DB) error {
+	want := contract.ExecuteBankTransferRequest{
+		BusinessKey:  "bk-1",
+		ClaimID:      "claim-1",
+		BankAccount:  "6222020202020202",
+		PayoutAmount: 1500,
+	}
+	accepted := map[string]string{
+		"named":           `{"businessKey":"bk-1","claimId":"claim-1","bankAccount":"6222020202020202","payoutAmount":1500}`,
+		"wrapped":         `[{"businessKey":"bk-1","claimId":"claim-1","bankAccount":"6222020202020202","payoutAmount":1500}]`,
+		"positional":      `["bk-1","claim-1","6222020202020202",1500,false,""]`,
+		"positional-v1.1": `["bk-1","claim-1","6222020202020202",1500,false]`,
+	}
+	for form, body := range accepted {
+		var got contract.ExecuteBankTransferRequest
+		if err := readBody(body, &got); err != nil {
+			return fmt.Errorf("%s form: %v", form, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("%s form decoded to %+v, want %+v", form, got, want)
+		}
+	}
+
+	rejected := map[string]string{
+		"missing claimId": `{"businessKey":"bk-1","bankAccount":"6222020202020202","payoutAmount":1500}`,
+		"zero amount":     `["bk-1","claim-1","6222020202020202",0]`,
+		"unknown field":   `{"businessKey":"bk-1","claimId":"claim-1","bankAccount":"6222020202020202","payoutAmount":1500,"iban":"x"}`,
+		"too many args":   `["bk-1","claim-1","6222020202020202",1500,false,"",0,"extra"]`,
+		"wrong type":      `["bk-1","claim-1","6222020202020202","1500"]`,
+	}
+	for name, body := range rejected {
+		var got contract.ExecuteBankTransferRequest
+		err := readBody(body, &got)
+		var requestErr *httpjson.Error
+		if !errors.As(err, &requestErr) || requestErr.Code != httpjson.CodeInvalidRequest {
+			return fmt.Errorf("%s: got %v, want %s", name, err, httpjson.CodeInvalidRequest)
+		}
+	}
+
+	failures := []struct {
+		err        error
+		statusCode int
+		body       httpjson.Error
+	}{
+		{app.ErrForwardRejected, http.StatusConflict, httpjson.Error{Code: contract.CodeForwardRejected, Retryable: false}},
+		{&app.RetryableError{Message: app.TransferBankUnavailable}, http.StatusServiceUnavailable, httpjson.Error{Code: app.TransferBankUnavailable, Retryable: true}},
+		{&app.RetryableError{Message: app.TransferBankTimeout}, http.StatusGatewayTimeout, httpjson.Error{Code: app.TransferBankTimeout, Retryable: true}},
+		{&app.OutcomeError{Message: app.TransferAccountInvalid}, http.StatusUnprocessableEntity, httpjson.Error{Code: app.TransferAccountInvalid, Retryable: false}},
+		{&app.OutcomeError{Message: app.TransferFailed}, http.StatusInternalServerError, httpjson.Error{Code: app.TransferFailed, Retryable: false}},
+		{errors.New("connection refused"), http.StatusInternalServerError, httpjson.Error{Code: contract.CodeInternal, Retryable: true}},
+	}
+	for _, f := range failures {
+		recorder := httptest.NewRecorder()
+		contract.WriteError(recorder, f.err)
+		var body httpjson.Error
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			return fmt.Errorf("%v: %v", f.err, err)
+		}
+		if recorder.Code != f.statusCode || body.Code != f.body.Code || body.Retryable != f.body.Retryable || body.Message == "" {
+			return fmt.Errorf("%v: got %d %+v, want %d %+v", f.err, recorder.Code, body, f.statusCode, f.body)
+		}
+	}
+	return nil
+}
+
+func readBody(body string, req httpjson.Request) error {
+	r := httptest.NewRequest(http.MethodPost, "/ExecuteBankTransfer", strings.NewReader(body))
+	return httpjson.ReadRequest(r, req)
+}
@@ -0,0 +1,102 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/expect"
+)
+
+// checkExpect replays the action sequence the Saga runs for every failure
+// point directly against the store and verifies that the snapshot matches
+// the expectation the orchestrator asserts after a real run.
+func checkExpect(db *sql.DB) error {
+	const (
+		businessKey = "insurance-claim-selfcheck-expect"
+		claimID     = "claim-selfcheck-expect"
+		amount      = 1500
+	)
+	claim := expect.Claim{PolicyID: app.DefaultPolicyID, PayoutAmount: amount}
+
+	forward := map[string]func() error{
+		expect.Identity:   func() error { return app.RecordIdentityVerified(db, businessKey, claimID, "claimant-9001") },
+		expect.Assessment: func() error { return app.CreateAssessment(db, businessKey, claimID, "assessment-7001") },
+		expect.Funds:      func() error { return app.ReserveFunds(db, businessKey, claimID, claim.PolicyID, amount) },
+		expect.Surveyor:   func() error { return app.NotifySurveyor(db, businessKey, claimID, "surveyor-3001") },
+	}
+	compensate := map[string]func() error{
+		expect.Identity:   func() error { return app.UnverifyIdentity(db, businessKey, claimID) },
+		expect.Assessment: func() error { return app.DeleteAssessment(db, businessKey, claimID) },
+		expect.Funds:      func() error { return app.ReleaseFunds(db, businessKey, claimID) },
+		expect.Surveyor:   func() error { return app.CancelSurveyorNotification(db, businessKey, claimID) },
+	}
+
+	for _, failAt := range append([]string{expect.None}, expect.Steps...) {
+		if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+			return err
+		}
+		var completed []string
+		for _, step := range expect.Steps {
+			if step == failAt {
+				break
+			}
+			completed = append(completed, step)
+		}
+
+		for _, step := range completed {
+			var err error
+			if step == expect.Transfer {
+				err = app.ExecuteTransfer(db, businessKey, claimID, "6222020202020202", amount, false, "")
+			} else {
+				err = forward[step]()
+			}
+			if err != nil {
+				return fmt.Errorf("failAt=%s: %s forward: %w", failAt, step, err)
+			}
+		}
+		if failAt == expect.Transfer {
+			var outcomeErr *app.OutcomeError
+			if err := app.ExecuteTransfer(db, businessKey, claimID, "6222020202020202", amount, true, ""); !errors.As(err, &outcomeErr) {
+				return fmt.Errorf("failAt=%s: failed transfer returned %v, want %s", failAt, err, app.TransferFailed)
+			}
+		}
+		if failAt != expect.None {
+			for i := len(completed) - 1; i >= 0; i-- {
+				if err := compensate[completed[i]](); err != nil {
+					return fmt.Errorf("failAt=%s: %s compensation: %w", failAt, completed[i], err)
+				}
+			}
+		}
+
+		expected, err := expect.For(failAt, claim)
+		if err != nil {
+			return err
+		}
+		if err := expect.VerifySnapshot(db, claimID, expected); err != nil {
+			return err
+		}
+		if err := app.CheckClaimLedger(db, claimID); err != nil {
+			return fmt.Errorf("failAt=%s: %w", failAt, err)
+		}
+	}
+	return nil
+}
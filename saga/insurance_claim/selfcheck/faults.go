@@ -0,0 +1,136 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
+)
+
+// checkFaults drives every fault mode through a stand-in action handler and
+// the /faults admin endpoint, verifying which calls reach the action and
+// what the caller sees.
+func checkFaults(_ *sql.DB) error {
+	injector := &faults.Injector{}
+	calls := 0
+	mux := http.NewServeMux()
+	injector.Register(mux)
+	mux.HandleFunc("/ReservePayoutFunds", injector.Wrap("funds", faults.Forward, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := []struct {
+		spec       string
+		statusCode int
+		calls      int
+		minLatency time.Duration
+	}{
+		{"", http.StatusOK, 1, 0},
+		{"funds.forward=error", http.StatusInternalServerError, 0, 0},
+		{"funds.compensate=error", http.StatusOK, 1, 0},
+		{"funds.forward=latency:200ms", http.StatusOK, 1, 200 * time.Millisecond},
+		{"funds.forward=timeout:200ms", http.StatusGatewayTimeout, 0, 200 * time.Millisecond},
+		{"funds.forward=afterCommit", http.StatusInternalServerError, 1, 0},
+	}
+	for _, c := range cases {
+		if err := putFaults(server.URL, c.spec); err != nil {
+			return err
+		}
+		calls = 0
+		started := time.Now()
+		statusCode, err := postAction(server.URL)
+		if err != nil {
+			return err
+		}
+		elapsed := time.Since(started)
+		if statusCode != c.statusCode || calls != c.calls || elapsed < c.minLatency {
+			return fmt.Errorf("%q: status=%d calls=%d elapsed=%s, want status=%d calls=%d elapsed>=%s",
+				c.spec, statusCode, calls, elapsed, c.statusCode, c.calls, c.minLatency)
+		}
+	}
+
+	if err := putFaults(server.URL, "funds.forward=error*2"); err != nil {
+		return err
+	}
+	calls = 0
+	for attempt, want := range []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusOK} {
+		statusCode, err := postAction(server.URL)
+		if err != nil {
+			return err
+		}
+		if statusCode != want {
+			return fmt.Errorf("error*2: attempt %d returned %d, want %d", attempt+1, statusCode, want)
+		}
+	}
+
+	if _, err := faults.ParseRules("funds.forward=explode"); err == nil {
+		return fmt.Errorf("an unknown mode was accepted")
+	}
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/faults", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if rules := injector.String(); rules != "" {
+		return fmt.Errorf("DELETE /faults left rules behind: %s", rules)
+	}
+	return nil
+}
+
+func putFaults(baseURL string, spec string) error {
+	req, err := http.NewRequest(http.MethodPut, baseURL+"/faults", strings.NewReader(spec))
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK || string(body) != spec {
+		return fmt.Errorf("PUT /faults %q returned %d %q", spec, resp.StatusCode, body)
+	}
+	return nil
+}
+
+func postAction(baseURL string) (int, error) {
+	resp, err := http.Post(baseURL+"/ReservePayoutFunds", "application/json", strings.NewReader("[]"))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
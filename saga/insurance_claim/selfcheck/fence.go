@@ -0,0 +1,78 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+)
+
+// checkFence runs every compensation before its forward action. Each one must
+// succeed as an empty rollback, and each late forward call afterwards must be
+// rejected without creating business state.
+func checkFence(db *sql.DB) error {
+	const (
+		businessKey = "insurance-claim-selfcheck-fence"
+		claimID     = "claim-selfcheck-fence"
+	)
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		return err
+	}
+
+	compensations := []struct {
+		name string
+		call func() error
+	}{
+		{"CancelSurveyorNotification", func() error { return app.CancelSurveyorNotification(db, businessKey, claimID) }},
+		{"ReleasePayoutFunds", func() error { return app.ReleaseFunds(db, businessKey, claimID) }},
+		{"DeleteDamageAssessment", func() error { return app.DeleteAssessment(db, businessKey, claimID) }},
+		{"UnverifyClaim", func() error { return app.UnverifyIdentity(db, businessKey, claimID) }},
+	}
+	for _, c := range compensations {
+		if err := c.call(); err != nil {
+			return fmt.Errorf("%s: empty rollback returned %v", c.name, err)
+		}
+	}
+
+	forwards := []struct {
+		name string
+		call func() error
+	}{
+		{"VerifyIdentity", func() error { return app.RecordIdentityVerified(db, businessKey, claimID, "claimant-9001") }},
+		{"CreateDamageAssessment", func() error { return app.CreateAssessment(db, businessKey, claimID, "assessment-7001") }},
+		{"ReservePayoutFunds", func() error { return app.ReserveFunds(db, businessKey, claimID, app.DefaultPolicyID, 1500) }},
+		{"NotifyAssignedSurveyor", func() error { return app.NotifySurveyor(db, businessKey, claimID, "surveyor-3001") }},
+	}
+	for _, c := range forwards {
+		if err := c.call(); !errors.Is(err, app.ErrForwardRejected) {
+			return fmt.Errorf("%s: late forward call returned %v, want %v", c.name, err, app.ErrForwardRejected)
+		}
+	}
+
+	snapshot, err := app.LoadSnapshot(db, claimID)
+	if err != nil {
+		return err
+	}
+	if snapshot.IdentityVerified || snapshot.AssessmentStatus != "MISSING" || snapshot.FundsStatus != "MISSING" || snapshot.SurveyorStatus != "MISSING" {
+		return fmt.Errorf("late forward calls left business state behind\n%s", app.FormatSnapshot(snapshot))
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/expect"
+	"seata.apache.org/seata-go-samples/saga/invariant"
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+var statelangGlob string
+
+// checkInvariant builds the Saga store rows each failure point is expected
+// to leave behind and verifies that they satisfy the generic state machine
+// invariants of InsuranceClaimSaga. It then breaks the rows on purpose,
+// dropping a compensation and swapping the compensation order, and verifies
+// that the checker notices.
+func checkInvariant(*sql.DB) error {
+	defs, err := statelang.LoadGlob(statelangGlob)
+	if err != nil {
+		return err
+	}
+	def, err := statelang.Find(defs, "InsuranceClaimSaga")
+	if err != nil {
+		return err
+	}
+
+	claim := expect.Claim{PolicyID: app.DefaultPolicyID, PayoutAmount: 1500}
+	for _, failAt := range append([]string{expect.None}, expect.Steps...) {
+		e, err := expect.For(failAt, claim)
+		if err != nil {
+			return err
+		}
+		machine, states := expectedRows(e)
+		if violations := invariant.Check(def, machine, states); len(violations) > 0 {
+			return fmt.Errorf("failAt=%s: %s", failAt, strings.Join(violations, "; "))
+		}
+
+		var compensations []int
+		for i, s := range states {
+			if s.IsCompensation() {
+				compensations = append(compensations, i)
+			}
+		}
+		if len(compensations) == 0 {
+			continue
+		}
+		last := compensations[len(compensations)-1]
+		dropped := append(append([]sagastore.State{}, states[:last]...), states[last+1:]...)
+		if len(invariant.Check(def, machine, dropped)) == 0 {
+			return fmt.Errorf("failAt=%s: a missing %s was not reported", failAt, states[last].Name)
+		}
+		if len(compensations) < 2 {
+			continue
+		}
+		swapped := append([]sagastore.State{}, states...)
+		first, second := compensations[0], compensations[1]
+		swapped[first].GmtStarted, swapped[second].GmtStarted = swapped[second].GmtStarted, swapped[first].GmtStarted
+		if len(invariant.Check(def, machine, swapped)) == 0 {
+			return fmt.Errorf("failAt=%s: compensations out of order were not reported", failAt)
+		}
+	}
+	return nil
+}
+
+// expectedRows turns an expectation into the rows the engine would persist,
+// one second apart, with compensations linked to their forward states.
+func expectedRows(e expect.Expectation) (sagastore.Machine, []sagastore.State) {
+	const xid = "selfcheck-invariant"
+	started := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	machine := sagastore.Machine{
+		ID:                 xid,
+		Status:             sql.NullString{String: e.Status, Valid: true},
+		CompensationStatus: sql.NullString{String: e.CompensationStatus, Valid: e.CompensationStatus != ""},
+		GmtStarted:         sql.NullTime{Time: started, Valid: true},
+	}
+
+	forwardIDs := make(map[string]string)
+	states := make([]sagastore.State, 0, len(e.States))
+	for i, expected := range e.States {
+		at := started.Add(time.Duration(i+1) * time.Second)
+		s := sagastore.State{
+			ID:            fmt.Sprintf("%s-%d", xid, i+1),
+			MachineInstID: xid,
+			Name:          expected.Name,
+			Type:          statelang.TypeServiceTask,
+			Status:        sql.NullString{String: expected.Status, Valid: true},
+			GmtStarted:    sql.NullTime{Time: at, Valid: true},
+			GmtEnd:        sql.NullTime{Time: at, Valid: true},
+		}
+		if expected.CompensationFor != "" {
+			s.CompensatedFor = sql.NullString{String: forwardIDs[expected.CompensationFor], Valid: true}
+		} else {
+			forwardIDs[expected.Name] = s.ID
+		}
+		states = append(states, s)
+	}
+	machine.GmtEnd = sql.NullTime{Time: started.Add(time.Duration(len(states)+1) * time.Second), Valid: true}
+	return machine, states
+}
@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/ledger"
+)
+
+// checkLedger drives the funds and transfer actions through every outcome a
+// claim can reach and verifies the ledger invariants and the expected split
+// after each one. It finally corrupts a ledger on purpose to make sure the
+// checker notices.
+func checkLedger(db *sql.DB) error {
+	const (
+		policyID = "policy-selfcheck-ledger"
+		account  = "6222020202020202"
+	)
+	outcomes := []struct {
+		name string
+		run  func(businessKey string, claimID string) error
+		want ledger.Balance
+	}{
+		{"paid in full", func(businessKey string, claimID string) error {
+			if err := app.ReserveFunds(db, businessKey, claimID, policyID, 1500); err != nil {
+				return err
+			}
+			return app.ExecuteTransfer(db, businessKey, claimID, account, 1500, false, "")
+		}, ledger.Balance{Requested: 1500, Captured: 1500}},
+		{"settled for less", func(businessKey string, claimID string) error {
+			if err := app.ReserveFunds(db, businessKey, claimID, policyID, 1500); err != nil {
+				return err
+			}
+			return app.ExecuteTransfer(db, businessKey, claimID, account, 1200, false, "")
+		}, ledger.Balance{Requested: 1500, Captured: 1200, Released: 300}},
+		{"paid after a transient failure", func(businessKey string, claimID string) error {
+			if err := app.ReserveFunds(db, businessKey, claimID, policyID, 1500); err != nil {
+				return err
+			}
+			if err := app.ExecuteTransfer(db, businessKey, claimID, account, 1500, false, "503"); err == nil {
+				return fmt.Errorf("the injected 503 did not fail the first attempt")
+			}
+			return app.ExecuteTransfer(db, businessKey, claimID, account, 1500, false, "503")
+		}, ledger.Balance{Requested: 1500, Captured: 1500}},
+		{"compensated", func(businessKey string, claimID string) error {
+			if err := app.ReserveFunds(db, businessKey, claimID, policyID, 1500); err != nil {
+				return err
+			}
+			if err := app.ExecuteTransfer(db, businessKey, claimID, account, 1500, true, ""); err == nil {
+				return fmt.Errorf("the failing transfer succeeded")
+			}
+			return app.ReleaseFunds(db, businessKey, claimID)
+		}, ledger.Balance{Requested: 1500, Released: 1500}},
+		{"still reserved", func(businessKey string, claimID string) error {
+			return app.ReserveFunds(db, businessKey, claimID, policyID, 1500)
+		}, ledger.Balance{Requested: 1500, Reserved: 1500}},
+		{"empty rollback", func(businessKey string, claimID string) error {
+			return app.ReleaseFunds(db, businessKey, claimID)
+		}, ledger.Balance{}},
+	}
+
+	for index, o := range outcomes {
+		businessKey := fmt.Sprintf("insurance-claim-selfcheck-ledger-%d", index)
+		claimID := fmt.Sprintf("claim-selfcheck-ledger-%d", index)
+		if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+			return err
+		}
+		if err := o.run(businessKey, claimID); err != nil {
+			return fmt.Errorf("%s: %v", o.name, err)
+		}
+		if err := app.CheckClaimLedger(db, claimID); err != nil {
+			return fmt.Errorf("%s: %v", o.name, err)
+		}
+		got, err := ledger.ClaimBalance(db, claimID)
+		if err != nil {
+			return err
+		}
+		if got != o.want {
+			return fmt.Errorf("%s: ledger %s, want %s", o.name, got, o.want)
+		}
+	}
+
+	businessKey := "insurance-claim-selfcheck-ledger-corrupt"
+	claimID := "claim-selfcheck-ledger-corrupt"
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		return err
+	}
+	if err := app.ReserveFunds(db, businessKey, claimID, policyID, 1500); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE claim_fund_ledger SET amount = amount - 1 WHERE claim_id = ?`, claimID); err != nil {
+		return err
+	}
+	if err := app.CheckClaimLedger(db, claimID); err == nil {
+		return fmt.Errorf("a ledger that lost 1 from its reservation passed the check")
+	}
+	if _, err := db.Exec(`UPDATE claim_fund_ledger SET amount = amount + 1 WHERE claim_id = ?`, claimID); err != nil {
+		return err
+	}
+	return app.ResetClaimData(db, businessKey, claimID)
+}
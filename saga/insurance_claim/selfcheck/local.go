@@ -0,0 +1,159 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/local"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// checkLocal drives a failing claim through the in-process services the
+// orchestrator registers on the local invoker: every ServiceTask of
+// InsuranceClaimSaga must have a method named after it, a retryable bank
+// failure and an injected fault must fail in the form the Catch and Retry
+// rules match, and the compensations must leave a balanced ledger.
+func checkLocal(db *sql.DB) error {
+	const (
+		businessKey = "insurance-claim-selfcheck-local"
+		claimID     = "claim-selfcheck-local"
+	)
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		return err
+	}
+
+	selected, err := local.Select(local.All)
+	if err != nil {
+		return err
+	}
+	injector := &faults.Injector{}
+	services := local.New(db, injector, selected)
+
+	defs, err := statelang.LoadGlob(statelangGlob)
+	if err != nil {
+		return err
+	}
+	def, err := statelang.Find(defs, "InsuranceClaimSaga")
+	if err != nil {
+		return err
+	}
+	for _, name := range def.Order {
+		s := def.States[name]
+		if s.Type != statelang.TypeServiceTask {
+			continue
+		}
+		service, ok := services[s.ServiceName]
+		if !ok {
+			return fmt.Errorf("%s: no local service %s", name, s.ServiceName)
+		}
+		if !reflect.ValueOf(service).MethodByName(name).IsValid() {
+			return fmt.Errorf("%s: local service %s has no method %s", name, s.ServiceName, name)
+		}
+	}
+
+	call := func(service string, method string, input map[string]any) (map[string]any, error) {
+		out := reflect.ValueOf(services[service]).MethodByName(method).Call([]reflect.Value{reflect.ValueOf(input)})
+		err, _ := out[1].Interface().(error)
+		return out[0].Interface().(map[string]any), err
+	}
+	claim := func(fields map[string]any) map[string]any {
+		input := map[string]any{"businessKey": businessKey, "claimId": claimID}
+		for key, value := range fields {
+			input[key] = value
+		}
+		return input
+	}
+
+	injector.Set([]faults.Rule{{Step: "identity", Action: faults.Forward, Mode: faults.ModeError, Times: 1}})
+	if _, err := call(local.IdentityService, "VerifyIdentity", claim(map[string]any{"claimantId": "claimant-9001"})); err == nil ||
+		!strings.Contains(err.Error(), "HTTP error") || !strings.Contains(err.Error(), "INJECTED_FAULT") {
+		return fmt.Errorf("injected identity fault: got %v, want an HTTP error with INJECTED_FAULT", err)
+	}
+
+	forward := []struct {
+		service string
+		method  string
+		input   map[string]any
+		status  string
+	}{
+		{local.IdentityService, "VerifyIdentity", claim(map[string]any{"claimantId": "claimant-9001"}), "IDENTITY_VERIFIED"},
+		{local.AssessmentService, "CreateDamageAssessment", claim(map[string]any{"assessmentId": "assessment-7001"}), "ASSESSMENT_CREATED"},
+		{local.FundsService, "ReservePayoutFunds", claim(map[string]any{"payoutAmount": 1500, "policyId": app.DefaultPolicyID}), "FUNDS_RESERVED"},
+		{local.SurveyorService, "NotifyAssignedSurveyor", claim(map[string]any{"surveyorId": "surveyor-3001"}), "SURVEYOR_NOTIFIED"},
+	}
+	for _, step := range forward {
+		out, err := call(step.service, step.method, step.input)
+		if err != nil {
+			return fmt.Errorf("%s: %v", step.method, err)
+		}
+		if out["status"] != step.status {
+			return fmt.Errorf("%s returned status %v, want %s", step.method, out["status"], step.status)
+		}
+	}
+
+	transfer := claim(map[string]any{
+		"bankAccount":    "6222020202020202",
+		"payoutAmount":   1500,
+		"failTransfer":   false,
+		"transferFaults": "503",
+		"settledAmount":  0,
+	})
+	if _, err := call(local.TransferService, "ExecuteBankTransfer", transfer); err == nil ||
+		!strings.Contains(err.Error(), "HTTP error: 503") || !strings.Contains(err.Error(), app.TransferBankUnavailable) {
+		return fmt.Errorf("unavailable bank: got %v, want an HTTP error 503 with %s", err, app.TransferBankUnavailable)
+	}
+	transfer["failTransfer"] = true
+	if _, err := call(local.TransferService, "ExecuteBankTransfer", transfer); err == nil || !strings.Contains(err.Error(), "HTTP error") {
+		return fmt.Errorf("failed transfer: got %v, want an HTTP error", err)
+	}
+
+	compensations := []struct {
+		service string
+		method  string
+		status  string
+	}{
+		{local.SurveyorService, "CancelSurveyorNotification", "SURVEYOR_NOTIFICATION_CANCELED"},
+		{local.FundsService, "ReleasePayoutFunds", "FUNDS_RELEASED"},
+		{local.AssessmentService, "DeleteDamageAssessment", "ASSESSMENT_DELETED"},
+		{local.IdentityService, "UnverifyClaim", "IDENTITY_UNVERIFIED"},
+	}
+	for _, step := range compensations {
+		out, err := call(step.service, step.method, claim(nil))
+		if err != nil {
+			return fmt.Errorf("%s: %v", step.method, err)
+		}
+		if out["status"] != step.status {
+			return fmt.Errorf("%s returned status %v, want %s", step.method, out["status"], step.status)
+		}
+	}
+
+	snapshot, err := app.LoadSnapshot(db, claimID)
+	if err != nil {
+		return err
+	}
+	if snapshot.IdentityVerified || snapshot.FundsStatus != "RELEASED" {
+		return fmt.Errorf("compensated claim left\n%s", app.FormatSnapshot(snapshot))
+	}
+	return app.CheckClaimLedger(db, claimID)
+}
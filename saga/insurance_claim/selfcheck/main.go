@@ -0,0 +1,104 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+)
+
+type check struct {
+	name string
+	run  func(db *sql.DB) error
+	// needsOrchestrator marks checks that drive a running orchestrator
+	// started with -serve instead of calling the actions directly.
+	needsOrchestrator bool
+}
+
+var checks = []check{
+	{"replay", checkReplay, false},
+	{"fence", checkFence, false},
+	{"atomicity", checkAtomicity, false},
+	{"ledger", checkLedger, false},
+	{"faults", checkFaults, false},
+	{"contract", checkContract, false},
+	{"expect", checkExpect, false},
+	{"invariant", checkInvariant, false},
+	{"local", checkLocal, false},
+	{"callback", checkCallback, true},
+}
+
+var orchestratorURL string
+
+func main() {
+	var only string
+	flag.StringVar(&only, "check", "", "run a single check by name (default: all)")
+	flag.StringVar(&orchestratorURL, "orchestrator", "", "base URL of a running orchestrator, e.g. http://127.0.0.1:18080")
+	flag.StringVar(&statelangGlob, "statelang", "saga/insurance_claim/statelang/*.json", "glob of the state-language definitions")
+	flag.Parse()
+
+	db, err := app.OpenDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to open the database: %v\n", err)
+		os.Exit(2)
+	}
+	defer db.Close()
+
+	if err := app.EnsureBusinessSchema(db); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize the business schema: %v\n", err)
+		os.Exit(2)
+	}
+
+	failed := false
+	ran := 0
+	for _, c := range checks {
+		if only != "" && only != c.name {
+			continue
+		}
+		ran++
+		if c.needsOrchestrator && orchestratorURL == "" {
+			fmt.Printf("CHECK %s SKIPPED: -orchestrator is not set\n", c.name)
+			continue
+		}
+		if err := c.run(db); err != nil {
+			fmt.Printf("CHECK %s FAILED: %v\n", c.name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("CHECK %s OK\n", c.name)
+	}
+	if ran == 0 {
+		fmt.Fprintf(os.Stderr, "unknown check: %s\n", only)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// sameError reports whether two action results are indistinguishable to a caller.
+func sameError(first error, second error) bool {
+	if first == nil || second == nil {
+		return first == nil && second == nil
+	}
+	return first.Error() == second.Error()
+}
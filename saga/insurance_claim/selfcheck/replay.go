@@ -0,0 +1,91 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+)
+
+// checkReplay calls every forward and compensation action twice. The first
+// call must return the expected result and change the snapshot; the second
+// must return the same result and leave the snapshot, including the step
+// log, exactly as the first call left it.
+func checkReplay(db *sql.DB) error {
+	const (
+		businessKey = "insurance-claim-selfcheck-replay"
+		claimID     = "claim-selfcheck-replay"
+	)
+	if err := app.ResetClaimData(db, businessKey, claimID); err != nil {
+		return err
+	}
+
+	// want is the error the first call must return: the transfer is told
+	// to fail, everything else succeeds.
+	calls := []struct {
+		name string
+		want error
+		call func() error
+	}{
+		{"VerifyIdentity", nil, func() error { return app.RecordIdentityVerified(db, businessKey, claimID, "claimant-9001") }},
+		{"CreateDamageAssessment", nil, func() error { return app.CreateAssessment(db, businessKey, claimID, "assessment-7001") }},
+		{"ReservePayoutFunds", nil, func() error { return app.ReserveFunds(db, businessKey, claimID, app.DefaultPolicyID, 1500) }},
+		{"NotifyAssignedSurveyor", nil, func() error { return app.NotifySurveyor(db, businessKey, claimID, "surveyor-3001") }},
+		{"ExecuteBankTransfer", &app.OutcomeError{Message: app.TransferFailed}, func() error {
+			return app.ExecuteTransfer(db, businessKey, claimID, "6222020202020202", 1500, true, "")
+		}},
+		{"CancelSurveyorNotification", nil, func() error { return app.CancelSurveyorNotification(db, businessKey, claimID) }},
+		{"ReleasePayoutFunds", nil, func() error { return app.ReleaseFunds(db, businessKey, claimID) }},
+		{"DeleteDamageAssessment", nil, func() error { return app.DeleteAssessment(db, businessKey, claimID) }},
+		{"UnverifyClaim", nil, func() error { return app.UnverifyIdentity(db, businessKey, claimID) }},
+	}
+
+	for _, c := range calls {
+		initial, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+		firstErr := c.call()
+		if !sameError(c.want, firstErr) {
+			return fmt.Errorf("%s: first call returned %v, want %v", c.name, firstErr, c.want)
+		}
+		before, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+		if reflect.DeepEqual(initial, before) {
+			return fmt.Errorf("%s: first call left the snapshot unchanged\n%s", c.name, app.FormatSnapshot(before))
+		}
+		secondErr := c.call()
+		after, err := app.LoadSnapshot(db, claimID)
+		if err != nil {
+			return err
+		}
+		if !sameError(firstErr, secondErr) {
+			return fmt.Errorf("%s: replay returned %v, first call returned %v", c.name, secondErr, firstErr)
+		}
+		if !reflect.DeepEqual(before, after) {
+			return fmt.Errorf("%s: replay changed the snapshot\nfirst:\n%s\nreplay:\n%s",
+				c.name, app.FormatSnapshot(before), app.FormatSnapshot(after))
+		}
+	}
+	return nil
+}
@@ -23,7 +23,9 @@ import (
 	"net/http"
 
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/operation"
 )
 
 func main() {
@@ -37,62 +39,18 @@ func main() {
 	if err := app.EnsureBusinessSchema(db); err != nil {
 		log.Fatalf("failed to initialize the business schema: %v", err)
 	}
+	injector, err := faults.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to load the fault rules: %v", err)
+	}
 
 	mux := http.NewServeMux()
+	injector.Register(mux)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		httpjson.WriteText(w, http.StatusOK, "OK")
 	})
-	mux.HandleFunc("/CreateDamageAssessment", func(w http.ResponseWriter, r *http.Request) {
-		args, err := httpjson.ReadArgs(r, 3)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		businessKey, err := httpjson.StringArg(args, 0)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		claimID, err := httpjson.StringArg(args, 1)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		assessmentID, err := httpjson.StringArg(args, 2)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if err := app.CreateAssessment(db, businessKey, claimID, assessmentID); err != nil {
-			httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		log.Printf("operation=CreateDamageAssessment businessKey=%s claimId=%s assessmentId=%s status=SUCCESS", businessKey, claimID, assessmentID)
-		httpjson.WriteText(w, http.StatusOK, "ASSESSMENT_CREATED")
-	})
-	mux.HandleFunc("/DeleteDamageAssessment", func(w http.ResponseWriter, r *http.Request) {
-		args, err := httpjson.ReadArgs(r, 2)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		businessKey, err := httpjson.StringArg(args, 0)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		claimID, err := httpjson.StringArg(args, 1)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if err := app.DeleteAssessment(db, businessKey, claimID); err != nil {
-			httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		log.Printf("operation=DeleteDamageAssessment businessKey=%s claimId=%s status=SUCCESS", businessKey, claimID)
-		httpjson.WriteText(w, http.StatusOK, "ASSESSMENT_DELETED")
-	})
+	mux.HandleFunc("/CreateDamageAssessment", injector.Wrap("assessment", faults.Forward, operation.Handler(db, operation.CreateDamageAssessment)))
+	mux.HandleFunc("/DeleteDamageAssessment", injector.Wrap("assessment", faults.Compensate, operation.Handler(db, operation.DeleteDamageAssessment)))
 
 	addr := fmt.Sprintf(":%s", settings.AssessmentPort)
 	log.Printf("assessment service listening on %s\n", addr)
@@ -23,7 +23,9 @@ import (
 	"net/http"
 
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/operation"
 )
 
 func main() {
@@ -37,62 +39,18 @@ func main() {
 	if err := app.EnsureBusinessSchema(db); err != nil {
 		log.Fatalf("failed to initialize the business schema: %v", err)
 	}
+	injector, err := faults.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to load the fault rules: %v", err)
+	}
 
 	mux := http.NewServeMux()
+	injector.Register(mux)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		httpjson.WriteText(w, http.StatusOK, "OK")
 	})
-	mux.HandleFunc("/ReservePayoutFunds", func(w http.ResponseWriter, r *http.Request) {
-		args, err := httpjson.ReadArgs(r, 3)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		businessKey, err := httpjson.StringArg(args, 0)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		claimID, err := httpjson.StringArg(args, 1)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		amount, err := httpjson.IntArg(args, 2)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if err := app.ReserveFunds(db, businessKey, claimID, amount); err != nil {
-			httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		log.Printf("operation=ReservePayoutFunds businessKey=%s claimId=%s amount=%d status=SUCCESS", businessKey, claimID, amount)
-		httpjson.WriteText(w, http.StatusOK, "FUNDS_RESERVED")
-	})
-	mux.HandleFunc("/ReleasePayoutFunds", func(w http.ResponseWriter, r *http.Request) {
-		args, err := httpjson.ReadArgs(r, 2)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		businessKey, err := httpjson.StringArg(args, 0)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		claimID, err := httpjson.StringArg(args, 1)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if err := app.ReleaseFunds(db, businessKey, claimID); err != nil {
-			httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		log.Printf("operation=ReleasePayoutFunds businessKey=%s claimId=%s status=SUCCESS", businessKey, claimID)
-		httpjson.WriteText(w, http.StatusOK, "FUNDS_RELEASED")
-	})
+	mux.HandleFunc("/ReservePayoutFunds", injector.Wrap("funds", faults.Forward, operation.Handler(db, operation.ReservePayoutFunds)))
+	mux.HandleFunc("/ReleasePayoutFunds", injector.Wrap("funds", faults.Compensate, operation.Handler(db, operation.ReleasePayoutFunds)))
 
 	addr := fmt.Sprintf(":%s", settings.FundsPort)
 	log.Printf("funds service listening on %s\n", addr)
@@ -23,7 +23,9 @@ import (
 	"net/http"
 
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/app"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/faults"
 	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/httpjson"
+	"seata.apache.org/seata-go-samples/saga/insurance_claim/internal/operation"
 )
 
 func main() {
@@ -37,50 +39,17 @@ func main() {
 	if err := app.EnsureBusinessSchema(db); err != nil {
 		log.Fatalf("failed to initialize the business schema: %v", err)
 	}
+	injector, err := faults.FromEnv()
+	if err != nil {
+		log.Fatalf("failed to load the fault rules: %v", err)
+	}
 
 	mux := http.NewServeMux()
+	injector.Register(mux)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, _ *http.Request) {
 		httpjson.WriteText(w, http.StatusOK, "OK")
 	})
-	mux.HandleFunc("/ExecuteBankTransfer", func(w http.ResponseWriter, r *http.Request) {
-		args, err := httpjson.ReadArgs(r, 5)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		businessKey, err := httpjson.StringArg(args, 0)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		claimID, err := httpjson.StringArg(args, 1)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		bankAccount, err := httpjson.StringArg(args, 2)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		amount, err := httpjson.IntArg(args, 3)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		failTransfer, err := httpjson.BoolArg(args, 4)
-		if err != nil {
-			httpjson.WriteText(w, http.StatusBadRequest, err.Error())
-			return
-		}
-		if err := app.ExecuteTransfer(db, businessKey, claimID, bankAccount, amount, failTransfer); err != nil {
-			log.Printf("operation=ExecuteBankTransfer businessKey=%s claimId=%s bankAccount=%s amount=%d status=FAILED error=%s", businessKey, claimID, bankAccount, amount, err)
-			httpjson.WriteText(w, http.StatusInternalServerError, err.Error())
-			return
-		}
-		log.Printf("operation=ExecuteBankTransfer businessKey=%s claimId=%s bankAccount=%s amount=%d status=SUCCESS", businessKey, claimID, bankAccount, amount)
-		httpjson.WriteText(w, http.StatusOK, "BANK_TRANSFER_SUCCESS")
-	})
+	mux.HandleFunc("/ExecuteBankTransfer", injector.Wrap("transfer", faults.Forward, operation.Handler(db, operation.ExecuteBankTransfer)))
 
 	addr := fmt.Sprintf(":%s", settings.TransferPort)
 	log.Printf("transfer service listening on %s\n", addr)
@@ -95,6 +95,7 @@ CREATE TABLE IF NOT EXISTS `claim_assessment` (
 CREATE TABLE IF NOT EXISTS `claim_fund_reservation` (
   `claim_id` varchar(64) NOT NULL,
   `business_key` varchar(64) NOT NULL,
+  `policy_id` varchar(64) NOT NULL DEFAULT '',
   `amount` int NOT NULL,
   `status` varchar(32) NOT NULL,
   `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
@@ -117,6 +118,7 @@ CREATE TABLE IF NOT EXISTS `claim_transfer` (
   `amount` int NOT NULL,
   `status` varchar(32) NOT NULL,
   `last_error` varchar(255) NOT NULL DEFAULT '',
+  `attempts` int NOT NULL DEFAULT 0,
   `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   PRIMARY KEY (`claim_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -133,3 +135,52 @@ CREATE TABLE IF NOT EXISTS `claim_step_log` (
   KEY `idx_claim_step_log_claim` (`claim_id`),
   KEY `idx_claim_step_log_biz` (`business_key`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `claim_action_record` (
+  `business_key` varchar(64) NOT NULL,
+  `step_name` varchar(64) NOT NULL,
+  `action_name` varchar(64) NOT NULL,
+  `claim_id` varchar(64) NOT NULL,
+  `outcome` varchar(16) NOT NULL,
+  `message` varchar(255) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`business_key`,`step_name`,`action_name`),
+  KEY `idx_claim_action_record_claim` (`claim_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `claim_step_fence` (
+  `business_key` varchar(64) NOT NULL,
+  `step_name` varchar(64) NOT NULL,
+  `claim_id` varchar(64) NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`business_key`,`step_name`),
+  KEY `idx_claim_step_fence_claim` (`claim_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `claim_fund_ledger` (
+  `id` bigint NOT NULL AUTO_INCREMENT,
+  `policy_id` varchar(64) NOT NULL,
+  `claim_id` varchar(64) NOT NULL,
+  `business_key` varchar(64) NOT NULL,
+  `entry_type` varchar(32) NOT NULL,
+  `debit_account` varchar(32) NOT NULL,
+  `credit_account` varchar(32) NOT NULL,
+  `amount` int NOT NULL,
+  `policy_reserved` int NOT NULL,
+  `policy_captured` int NOT NULL,
+  `policy_released` int NOT NULL,
+  `created_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_claim_fund_ledger_claim` (`claim_id`),
+  KEY `idx_claim_fund_ledger_policy` (`policy_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `claim_policy_balance` (
+  `policy_id` varchar(64) NOT NULL,
+  `requested` int NOT NULL DEFAULT 0,
+  `reserved` int NOT NULL DEFAULT 0,
+  `captured` int NOT NULL DEFAULT 0,
+  `released` int NOT NULL DEFAULT 0,
+  `updated_at` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`policy_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,210 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package invariant checks the rows of a finished saga run against rules
+// that hold for any state machine, using only its state-language
+// definition. It complements the per-scenario expectations, which say what
+// a particular run should have done.
+package invariant
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// Status values the engine writes.
+const (
+	StatusSucceed = "SU"
+	StatusRunning = "RU"
+)
+
+// Check returns one message per violated invariant, in a stable order:
+//
+//   - the machine has finished and no state row is still running, unless a
+//     later attempt retried it, as forward recovery does after a crash;
+//   - every state row names a state of the definition;
+//   - every compensation row points at a forward row of the same run and is
+//     the CompensateState the definition declares for it;
+//   - when compensation ended SU, every SU forward state that declares a
+//     CompensateState has an SU compensation;
+//   - compensations ran in the reverse order of their forward states;
+//   - a machine that ended SU ran no compensation.
+func Check(def *statelang.StateMachine, machine sagastore.Machine, states []sagastore.State) []string {
+	var violations []string
+	violations = append(violations, checkFinished(machine, states)...)
+	violations = append(violations, checkKnown(def, states)...)
+	violations = append(violations, checkLinks(def, states)...)
+	violations = append(violations, checkComplete(def, machine, states)...)
+	violations = append(violations, checkReverseOrder(states)...)
+	if machine.Status.String == StatusSucceed {
+		for _, s := range states {
+			if s.IsCompensation() {
+				violations = append(violations, fmt.Sprintf("machine ended %s but compensation %s ran", StatusSucceed, s.Name))
+			}
+		}
+	}
+	return violations
+}
+
+func checkFinished(machine sagastore.Machine, states []sagastore.State) []string {
+	var violations []string
+	if machine.IsRunning {
+		violations = append(violations, "machine is still running")
+	}
+	if machine.Status.String == StatusRunning {
+		violations = append(violations, fmt.Sprintf("machine status is %s", StatusRunning))
+	}
+	retried := make(map[string]bool)
+	for _, s := range states {
+		if s.IsRetry() {
+			retried[s.RetriedFor.String] = true
+		}
+	}
+	for _, s := range states {
+		if s.Status.String == StatusRunning && !retried[s.ID] {
+			violations = append(violations, fmt.Sprintf("state %s (%s) stayed %s", s.Name, s.ID, StatusRunning))
+		}
+	}
+	return violations
+}
+
+func checkKnown(def *statelang.StateMachine, states []sagastore.State) []string {
+	var violations []string
+	for _, s := range states {
+		if def.State(s.Name) == nil {
+			violations = append(violations, fmt.Sprintf("state %s is not declared in %s", s.Name, def.Name))
+		}
+	}
+	return violations
+}
+
+func checkLinks(def *statelang.StateMachine, states []sagastore.State) []string {
+	byID := indexByID(states)
+	var violations []string
+	for _, s := range states {
+		if !s.IsCompensation() {
+			continue
+		}
+		forward, ok := byID[s.CompensatedFor.String]
+		if !ok {
+			violations = append(violations, fmt.Sprintf("compensation %s points at unknown state %s", s.Name, s.CompensatedFor.String))
+			continue
+		}
+		if forward.IsCompensation() {
+			violations = append(violations, fmt.Sprintf("compensation %s points at compensation %s", s.Name, forward.Name))
+			continue
+		}
+		declared := def.State(forward.Name)
+		if declared == nil {
+			continue
+		}
+		if declared.CompensateState != s.Name {
+			violations = append(violations, fmt.Sprintf("%s was compensated by %s, definition declares %q", forward.Name, s.Name, declared.CompensateState))
+		}
+	}
+	return violations
+}
+
+func checkComplete(def *statelang.StateMachine, machine sagastore.Machine, states []sagastore.State) []string {
+	if machine.CompensationStatus.String != StatusSucceed {
+		return nil
+	}
+	compensated := make(map[string]bool)
+	for _, s := range states {
+		if s.IsCompensation() && s.Status.String == StatusSucceed {
+			compensated[s.CompensatedFor.String] = true
+		}
+	}
+	var violations []string
+	for _, s := range states {
+		if s.IsCompensation() || s.Status.String != StatusSucceed {
+			continue
+		}
+		declared := def.State(s.Name)
+		if declared == nil || declared.CompensateState == "" {
+			continue
+		}
+		if !compensated[s.ID] {
+			violations = append(violations, fmt.Sprintf("compensation status is %s but %s (%s) has no %s %s", StatusSucceed, s.Name, s.ID, StatusSucceed, declared.CompensateState))
+		}
+	}
+	return violations
+}
+
+// checkReverseOrder compares every pair of compensations whose start times
+// differ: the one that started later must undo a forward state that started
+// earlier. Pairs started in the same instant are skipped, since the store's
+// timestamp precision cannot order them.
+func checkReverseOrder(states []sagastore.State) []string {
+	byID := indexByID(states)
+	type pair struct {
+		compensation, forward sagastore.State
+	}
+	var pairs []pair
+	for _, s := range states {
+		if !s.IsCompensation() {
+			continue
+		}
+		if forward, ok := byID[s.CompensatedFor.String]; ok {
+			pairs = append(pairs, pair{compensation: s, forward: forward})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].compensation.GmtStarted.Time.Before(pairs[j].compensation.GmtStarted.Time)
+	})
+
+	var violations []string
+	for i := 0; i < len(pairs); i++ {
+		for j := i + 1; j < len(pairs); j++ {
+			earlier, later := pairs[i], pairs[j]
+			if !earlier.compensation.GmtStarted.Time.Before(later.compensation.GmtStarted.Time) {
+				continue
+			}
+			if earlier.forward.GmtStarted.Time.Before(later.forward.GmtStarted.Time) {
+				violations = append(violations, fmt.Sprintf("compensations out of order: %s ran before %s, but %s ran before %s",
+					earlier.compensation.Name, later.compensation.Name, earlier.forward.Name, later.forward.Name))
+			}
+		}
+	}
+	return violations
+}
+
+func indexByID(states []sagastore.State) map[string]sagastore.State {
+	byID := make(map[string]sagastore.State, len(states))
+	for _, s := range states {
+		byID[s.ID] = s
+	}
+	return byID
+}
+
+// Summary renders the state rows as name/status pairs, marking
+// compensations, for log lines such as "ReduceInventory/SU, ~CompensateReduceInventory/SU".
+func Summary(states []sagastore.State) string {
+	parts := make([]string, 0, len(states))
+	for _, s := range states {
+		prefix := ""
+		if s.IsCompensation() {
+			prefix = "~"
+		}
+		parts = append(parts, prefix+s.Name+"/"+s.Status.String)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,128 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package invariant
+
+import (
+	"fmt"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// maxDepth bounds the nesting of sub-machines, in case parent_id values
+// ever form a cycle.
+const maxDepth = 16
+
+// CheckTree runs Check on machine and on every sub-machine instance it
+// started, each against its own definition from defs, and checks that the
+// instances agree with the SubStateMachine states that started them:
+//
+//   - every SU SubStateMachine state started an instance of the declared
+//     StateMachineName, and that instance ended SU;
+//   - every SU compensation of a SubStateMachine state left its instance
+//     with compensation status SU;
+//   - every sub-machine instance belongs to a SubStateMachine state.
+//
+// Violations found in a sub-machine are prefixed with its name and id.
+func CheckTree(q sagastore.Querier, defs []*statelang.StateMachine, def *statelang.StateMachine, machine sagastore.Machine) ([]string, error) {
+	return checkTree(q, defs, def, machine, 0)
+}
+
+func checkTree(q sagastore.Querier, defs []*statelang.StateMachine, def *statelang.StateMachine, machine sagastore.Machine, depth int) ([]string, error) {
+	states, err := sagastore.LoadStates(q, machine.ID)
+	if err != nil {
+		return nil, fmt.Errorf("query state rows of %s: %w", machine.ID, err)
+	}
+	violations := Check(def, machine, states)
+	children, err := sagastore.LoadChildren(q, machine.ID)
+	if err != nil {
+		return nil, fmt.Errorf("query sub-machines of %s: %w", machine.ID, err)
+	}
+	if len(children) == 0 {
+		return violations, nil
+	}
+	violations = append(violations, CheckSubMachines(def, machine, states, children)...)
+	if depth >= maxDepth {
+		return append(violations, fmt.Sprintf("sub-machines nested deeper than %d", maxDepth)), nil
+	}
+	for _, child := range children {
+		childDef, err := statelang.Find(defs, child.Name)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("sub-machine %s (%s): %v", child.Name, child.ID, err))
+			continue
+		}
+		nested, err := checkTree(q, defs, childDef, child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range nested {
+			violations = append(violations, fmt.Sprintf("sub-machine %s (%s): %s", child.Name, child.ID, v))
+		}
+	}
+	return violations, nil
+}
+
+// CheckSubMachines checks the rows of machine against the sub-machine
+// instances it started, as listed by sagastore.LoadChildren. It does not
+// look inside the instances; CheckTree does.
+func CheckSubMachines(def *statelang.StateMachine, machine sagastore.Machine, states []sagastore.State, children []sagastore.Machine) []string {
+	byState := make(map[string]sagastore.Machine, len(children))
+	for _, child := range children {
+		byState[strings.TrimPrefix(child.ParentID.String, machine.ID+":")] = child
+	}
+	rows := indexByID(states)
+
+	var violations []string
+	for _, s := range states {
+		declared := def.State(s.Name)
+		if declared == nil || s.Status.String != StatusSucceed {
+			continue
+		}
+		switch {
+		case declared.Type == statelang.TypeSubStateMachine:
+			child, ok := byState[s.ID]
+			if !ok {
+				violations = append(violations, fmt.Sprintf("%s (%s) is %s but started no sub-machine", s.Name, s.ID, StatusSucceed))
+				continue
+			}
+			if child.Name != declared.StateMachineName {
+				violations = append(violations, fmt.Sprintf("%s started %s, definition declares %s", s.Name, child.Name, declared.StateMachineName))
+			}
+			if child.Status.String != StatusSucceed {
+				violations = append(violations, fmt.Sprintf("%s is %s but its sub-machine %s ended %s", s.Name, StatusSucceed, child.ID, child.Status.String))
+			}
+		case s.IsCompensation() && declared.Type == statelang.TypeCompensateSubMachine:
+			child, ok := byState[s.CompensatedFor.String]
+			if !ok {
+				continue
+			}
+			if child.CompensationStatus.String != StatusSucceed {
+				violations = append(violations, fmt.Sprintf("%s is %s but sub-machine %s has compensation status %s",
+					s.Name, StatusSucceed, child.ID, child.CompensationStatus.String))
+			}
+		}
+	}
+	for _, child := range children {
+		forward, ok := rows[strings.TrimPrefix(child.ParentID.String, machine.ID+":")]
+		if !ok || def.State(forward.Name) == nil || def.State(forward.Name).Type != statelang.TypeSubStateMachine {
+			violations = append(violations, fmt.Sprintf("sub-machine %s (%s) was not started by a %s state", child.Name, child.ID, statelang.TypeSubStateMachine))
+		}
+	}
+	return violations
+}
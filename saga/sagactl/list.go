@@ -0,0 +1,81 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var store storeFlags
+	store.register(fs)
+	var filter sagastore.Filter
+	var since, until string
+	fs.StringVar(&filter.Status, "status", "", "machine status, e.g. SU, FA, UN")
+	fs.StringVar(&filter.CompensationStatus, "compensation-status", "", "compensation status, e.g. SU, FA")
+	fs.StringVar(&filter.BusinessKey, "business-key", "", "business key prefix")
+	fs.StringVar(&filter.MachineName, "machine", "", "state machine name")
+	fs.BoolVar(&filter.Running, "running", false, "only instances the engine is still driving")
+	fs.StringVar(&since, "since", "", "started at or after: a duration ago (1h), RFC 3339 or YYYY-MM-DD[ hh:mm:ss]")
+	fs.StringVar(&until, "until", "", "started before, in the same formats as -since")
+	fs.IntVar(&filter.Limit, "limit", 20, "maximum number of instances, 0 for all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if filter.Since, err = parseTime(since); err != nil {
+		return err
+	}
+	if filter.Until, err = parseTime(until); err != nil {
+		return err
+	}
+
+	db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	machines, err := sagastore.ListMachines(db, filter)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "XID\tMACHINE\tBUSINESS KEY\tSTATUS\tSTARTED\tDURATION")
+	for _, m := range machines {
+		name := m.Name
+		if m.ParentID.Valid && m.ParentID.String != "" {
+			name += " (sub)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.ID, name, nullable(m.BusinessKey), status(m),
+			formatTime(m.GmtStarted), formatDuration(m.GmtStarted, m.GmtEnd))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if filter.Limit > 0 && len(machines) == filter.Limit {
+		fmt.Fprintf(os.Stderr, "showing the newest %d instances, use -limit to see more\n", filter.Limit)
+	}
+	return nil
+}
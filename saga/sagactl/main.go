@@ -0,0 +1,192 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// sagactl inspects the Saga instances the engine recorded in its store
+// tables, instead of hand-written SQL against seata_state_machine_inst and
+// seata_state_inst.
+//
+//	sagactl list [-status FA] [-business-key order-] [-since 1h]
+//	sagactl show <xid>
+//	sagactl tree <xid>
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/mattn/go-sqlite3"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"list", "list instances, filtered by status, business key and start time", runList},
+	{"show", "print the timeline of one instance with inputs, outputs and exceptions", runShow},
+	{"tree", "print the states of one instance with their compensations, retries and sub-machines", runTree},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "sagactl %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sagactl <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-6s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "Run 'sagactl <command> -h' for the flags of a command.")
+}
+
+// storeFlags are the connection flags every command accepts.
+type storeFlags struct {
+	engine string
+	dsn    string
+}
+
+func (f *storeFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.engine, "engine", "saga/e2e/config.yaml", "Saga engine config whose store_dsn is used")
+	fs.StringVar(&f.dsn, "dsn", "", "MySQL DSN of the Saga store (overrides -engine)")
+}
+
+func (f *storeFlags) open() (*sql.DB, error) {
+	if f.dsn != "" {
+		cfg := sagastore.EngineConf{StoreEnabled: true, StoreType: "mysql", StoreDSN: f.dsn}
+		return cfg.Open()
+	}
+	cfg, err := sagastore.LoadEngineConf(f.engine)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Open()
+}
+
+// parseWithXID parses the flags of a command that takes one XID, which may
+// come before or after the flags.
+func parseWithXID(fs *flag.FlagSet, args []string) (string, error) {
+	var xid string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		xid, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if xid == "" {
+		xid = fs.Arg(0)
+	}
+	if xid == "" {
+		return "", fmt.Errorf("missing <xid>")
+	}
+	return xid, nil
+}
+
+// parseTime accepts a duration relative to now ("90m" means 90 minutes
+// ago), an RFC 3339 timestamp, or a local date with an optional time.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, want a duration such as 1h, RFC 3339 or YYYY-MM-DD[ hh:mm:ss]", value)
+}
+
+func formatTime(t sql.NullTime) string {
+	if !t.Valid {
+		return "-"
+	}
+	return t.Time.Format("2006-01-02 15:04:05.000")
+}
+
+func formatDuration(started, ended sql.NullTime) string {
+	if !started.Valid {
+		return "-"
+	}
+	if !ended.Valid {
+		return "running"
+	}
+	d := ended.Time.Sub(started.Time)
+	if d < time.Millisecond {
+		return d.String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+func nullable(s sql.NullString) string {
+	if !s.Valid || s.String == "" {
+		return "-"
+	}
+	return s.String
+}
+
+// status renders a machine's status and, when set, its compensation status.
+func status(m sagastore.Machine) string {
+	if m.CompensationStatus.Valid && m.CompensationStatus.String != "" {
+		return nullable(m.Status) + "/" + m.CompensationStatus.String
+	}
+	return nullable(m.Status)
+}
+
+// oneLine folds a stored value onto one line and, unless full is set,
+// shortens it to limit runes.
+func oneLine(s string, limit int, full bool) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if full {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "..."
+}
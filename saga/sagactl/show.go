@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+const valueLimit = 160
+
+func runShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	var store storeFlags
+	store.register(fs)
+	full := fs.Bool("full", false, "print inputs, outputs and exceptions without shortening them")
+	xid, err := parseWithXID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	machine, err := sagastore.LoadMachine(db, xid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no instance %s", xid)
+	}
+	if err != nil {
+		return err
+	}
+	states, err := sagastore.LoadStates(db, xid)
+	if err != nil {
+		return err
+	}
+	printMachine(os.Stdout, machine, *full)
+	fmt.Println()
+	printTimeline(os.Stdout, machine, states, *full)
+	return nil
+}
+
+func printMachine(out io.Writer, m sagastore.Machine, full bool) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "XID\t%s\n", m.ID)
+	fmt.Fprintf(w, "Machine\t%s (%s)\n", m.Name, m.MachineID)
+	if m.ParentID.Valid && m.ParentID.String != "" {
+		fmt.Fprintf(w, "Parent\t%s\n", m.ParentID.String)
+	}
+	fmt.Fprintf(w, "Business key\t%s\n", nullable(m.BusinessKey))
+	fmt.Fprintf(w, "Status\t%s\n", status(m))
+	fmt.Fprintf(w, "Started\t%s\n", formatTime(m.GmtStarted))
+	fmt.Fprintf(w, "Ended\t%s\n", formatTime(m.GmtEnd))
+	fmt.Fprintf(w, "Duration\t%s\n", formatDuration(m.GmtStarted, m.GmtEnd))
+	if m.StartParams.Valid && m.StartParams.String != "" {
+		fmt.Fprintf(w, "Start params\t%s\n", oneLine(m.StartParams.String, valueLimit, full))
+	}
+	if m.EndParams.Valid && m.EndParams.String != "" {
+		fmt.Fprintf(w, "End params\t%s\n", oneLine(m.EndParams.String, valueLimit, full))
+	}
+	if m.Excep.Valid && m.Excep.String != "" {
+		fmt.Fprintf(w, "Exception\t%s\n", oneLine(m.Excep.String, valueLimit, full))
+	}
+	_ = w.Flush()
+}
+
+// printTimeline prints one line per state, offset from the machine start,
+// followed by its input, output and exception. The columns are aligned by
+// hand because the detail lines must not widen them.
+func printTimeline(out io.Writer, m sagastore.Machine, states []sagastore.State, full bool) {
+	if len(states) == 0 {
+		fmt.Fprintln(out, "No state rows.")
+		return
+	}
+	names := make(map[string]string, len(states))
+	for _, s := range states {
+		names[s.ID] = s.Name
+	}
+
+	rows := [][]string{{"OFFSET", "DURATION", "STATE", "TYPE", "STATUS", "SERVICE", "NOTE"}}
+	for _, s := range states {
+		offset := "-"
+		if m.GmtStarted.Valid && s.GmtStarted.Valid {
+			offset = "+" + s.GmtStarted.Time.Sub(m.GmtStarted.Time).Round(time.Millisecond).String()
+		}
+		service := "-"
+		if s.ServiceName.Valid && s.ServiceName.String != "" {
+			service = s.ServiceName.String + "." + s.ServiceMethod.String
+		}
+		note := ""
+		switch {
+		case s.IsCompensation():
+			note = "compensates " + linked(names, s.CompensatedFor.String)
+		case s.IsRetry():
+			note = "retries " + linked(names, s.RetriedFor.String)
+		}
+		rows = append(rows, []string{offset, formatDuration(s.GmtStarted, s.GmtEnd), s.Name, s.Type, nullable(s.Status), service, note})
+	}
+	widths := make([]int, len(rows[0]))
+	for _, row := range rows {
+		for i, cell := range row {
+			if len(cell) > widths[i] {
+				widths[i] = len(cell)
+			}
+		}
+	}
+	indent := widths[0] + widths[1] + 4
+
+	for i, row := range rows {
+		line := ""
+		for j, cell := range row[:len(row)-1] {
+			line += fmt.Sprintf("%-*s  ", widths[j], cell)
+		}
+		fmt.Fprintln(out, strings.TrimRight(line+row[len(row)-1], " "))
+		if i == 0 {
+			continue
+		}
+		s := states[i-1]
+		for _, detail := range []struct {
+			label string
+			value sql.NullString
+		}{
+			{"input", s.InputParams},
+			{"output", s.OutputParams},
+			{"exception", s.Excep},
+		} {
+			if detail.value.Valid && detail.value.String != "" {
+				fmt.Fprintf(out, "%*s%s: %s\n", indent, "", detail.label, oneLine(detail.value.String, valueLimit, full))
+			}
+		}
+	}
+}
+
+// linked names the state row id points at, falling back to the id itself.
+func linked(names map[string]string, id string) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	return id
+}
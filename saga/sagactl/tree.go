@@ -0,0 +1,138 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/sagastore"
+)
+
+// maxDepth bounds the nesting of sub-machines, in case parent_id values
+// ever form a cycle.
+const maxDepth = 16
+
+type node struct {
+	label    string
+	children []*node
+}
+
+func runTree(args []string) error {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	var store storeFlags
+	store.register(fs)
+	xid, err := parseWithXID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	db, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	machine, err := sagastore.LoadMachine(db, xid)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("no instance %s", xid)
+	}
+	if err != nil {
+		return err
+	}
+	root, err := buildMachine(db, machine, 0)
+	if err != nil {
+		return err
+	}
+	fmt.Println(root.label)
+	printChildren(os.Stdout, root, "")
+	return nil
+}
+
+// buildMachine hangs every compensation under the forward state named by
+// state_id_compensated_for, every retry under the attempt named by
+// state_id_retried_for, and every sub-machine instance under the
+// SubStateMachine state that started it.
+func buildMachine(db *sql.DB, m sagastore.Machine, depth int) (*node, error) {
+	root := &node{label: fmt.Sprintf("%s %s %s", m.Name, m.ID, status(m))}
+	if depth > maxDepth {
+		root.children = append(root.children, &node{label: "..."})
+		return root, nil
+	}
+	states, err := sagastore.LoadStates(db, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	children, err := sagastore.LoadChildren(db, m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*node, len(states))
+	for _, s := range states {
+		nodes[s.ID] = &node{label: fmt.Sprintf("%s %s %s %s", s.Name, nullable(s.Status), s.Type, formatDuration(s.GmtStarted, s.GmtEnd))}
+	}
+	for _, s := range states {
+		n := nodes[s.ID]
+		parent := root
+		switch {
+		case s.IsCompensation():
+			n.label = "compensated by " + n.label
+			if forward, ok := nodes[s.CompensatedFor.String]; ok {
+				parent = forward
+			} else {
+				n.label += " (forward state " + s.CompensatedFor.String + " not found)"
+			}
+		case s.IsRetry():
+			n.label = "retried by " + n.label
+			if attempt, ok := nodes[s.RetriedFor.String]; ok {
+				parent = attempt
+			}
+		}
+		parent.children = append(parent.children, n)
+	}
+	for _, child := range children {
+		sub, err := buildMachine(db, child, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		sub.label = "sub-machine " + sub.label
+		parent := root
+		if state, ok := nodes[strings.TrimPrefix(child.ParentID.String, m.ID+":")]; ok {
+			parent = state
+		}
+		parent.children = append(parent.children, sub)
+	}
+	return root, nil
+}
+
+func printChildren(out io.Writer, n *node, prefix string) {
+	for i, child := range n.children {
+		branch, next := "├── ", "│   "
+		if i == len(n.children)-1 {
+			branch, next = "└── ", "    "
+		}
+		fmt.Fprintln(out, prefix+branch+child.label)
+		printChildren(out, child, prefix+next)
+	}
+}
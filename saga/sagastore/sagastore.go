@@ -0,0 +1,284 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package sagastore reads the rows the seata-go Saga engine persists in
+// seata_state_machine_def, seata_state_machine_inst and seata_state_inst.
+// It only reads; the engine owns the tables. The queries run on MySQL and
+// SQLite; a MySQL DSN must set parseTime.
+package sagastore
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EngineConf is the store part of a Saga engine config file.
+type EngineConf struct {
+	StoreEnabled bool   `yaml:"store_enabled"`
+	StoreType    string `yaml:"store_type"`
+	StoreDSN     string `yaml:"store_dsn"`
+}
+
+// LoadEngineConf reads the store settings of the engine config at path.
+func LoadEngineConf(path string) (*EngineConf, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c EngineConf
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if !c.StoreEnabled || c.StoreType == "" || c.StoreDSN == "" {
+		return nil, errors.New("engineConf missing store_enabled/store_type/store_dsn")
+	}
+	return &c, nil
+}
+
+// SQLite is the database/sql driver name of the SQLite store.
+const SQLite = "sqlite3"
+
+// Driver returns the database/sql driver name of the store type, accepting
+// "sqlite" for SQLite.
+func (c *EngineConf) Driver() string {
+	if c.StoreType == "sqlite" {
+		return SQLite
+	}
+	return c.StoreType
+}
+
+// Open connects to the configured store. The caller imports the driver.
+func (c *EngineConf) Open() (*sql.DB, error) {
+	db, err := sql.Open(c.Driver(), c.StoreDSN)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Querier is satisfied by *sql.DB and *sql.Tx.
+type Querier interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// Machine is one seata_state_machine_inst row. Name is the definition name
+// from seata_state_machine_def, empty when the definition row is missing.
+type Machine struct {
+	ID                 string
+	MachineID          string
+	Name               string
+	ParentID           sql.NullString
+	BusinessKey        sql.NullString
+	Status             sql.NullString
+	CompensationStatus sql.NullString
+	IsRunning          bool
+	GmtStarted         sql.NullTime
+	GmtEnd             sql.NullTime
+	GmtUpdated         sql.NullTime
+	StartParams        sql.NullString
+	EndParams          sql.NullString
+	Excep              sql.NullString
+}
+
+// State is one seata_state_inst row.
+type State struct {
+	ID             string
+	MachineInstID  string
+	Name           string
+	Type           string
+	ServiceName    sql.NullString
+	ServiceMethod  sql.NullString
+	ServiceType    sql.NullString
+	Status         sql.NullString
+	CompensatedFor sql.NullString
+	RetriedFor     sql.NullString
+	InputParams    sql.NullString
+	OutputParams   sql.NullString
+	Excep          sql.NullString
+	GmtStarted     sql.NullTime
+	GmtEnd         sql.NullTime
+}
+
+// IsCompensation reports whether the row ran as the compensation of another.
+func (s State) IsCompensation() bool {
+	return s.CompensatedFor.Valid && s.CompensatedFor.String != ""
+}
+
+// IsRetry reports whether the row is a retry of an earlier attempt.
+func (s State) IsRetry() bool {
+	return s.RetriedFor.Valid && s.RetriedFor.String != ""
+}
+
+const machineColumns = `m.id, m.machine_id, COALESCE(d.name, ''), m.parent_id, m.business_key, m.status, m.compensation_status, m.is_running,
+	m.gmt_started, m.gmt_end, m.gmt_updated, m.start_params, m.end_params, m.excep
+	FROM seata_state_machine_inst m LEFT JOIN seata_state_machine_def d ON d.id = m.machine_id`
+
+const stateColumns = `id, machine_inst_id, name, type, service_name, service_method, service_type, status,
+	state_id_compensated_for, state_id_retried_for, input_params, output_params, excep, gmt_started, gmt_end
+	FROM seata_state_inst`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMachine(row scanner) (Machine, error) {
+	var m Machine
+	err := row.Scan(&m.ID, &m.MachineID, &m.Name, &m.ParentID, &m.BusinessKey, &m.Status, &m.CompensationStatus, &m.IsRunning,
+		&m.GmtStarted, &m.GmtEnd, &m.GmtUpdated, &m.StartParams, &m.EndParams, &m.Excep)
+	return m, err
+}
+
+// LoadMachine reads the instance row of xid.
+func LoadMachine(q Querier, xid string) (Machine, error) {
+	return scanMachine(q.QueryRow(`SELECT `+machineColumns+` WHERE m.id = ?`, xid))
+}
+
+// Filter narrows ListMachines. Zero fields do not filter.
+type Filter struct {
+	Status             string
+	CompensationStatus string
+	// BusinessKey matches as a prefix.
+	BusinessKey string
+	MachineName string
+	Since       time.Time
+	Until       time.Time
+	// Running selects instances the engine is still driving.
+	Running bool
+	Limit   int
+}
+
+// ListMachines returns the instances matching f, newest first. Instances
+// started by a SubStateMachine state are included.
+func ListMachines(q Querier, f Filter) ([]Machine, error) {
+	var conditions []string
+	var args []any
+	if f.Status != "" {
+		conditions = append(conditions, "m.status = ?")
+		args = append(args, f.Status)
+	}
+	if f.CompensationStatus != "" {
+		conditions = append(conditions, "m.compensation_status = ?")
+		args = append(args, f.CompensationStatus)
+	}
+	if f.BusinessKey != "" {
+		conditions = append(conditions, "m.business_key LIKE ? ESCAPE '!'")
+		args = append(args, escapeLike(f.BusinessKey)+"%")
+	}
+	if f.MachineName != "" {
+		conditions = append(conditions, "d.name = ?")
+		args = append(args, f.MachineName)
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, "m.gmt_started >= ?")
+		args = append(args, f.Since)
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, "m.gmt_started < ?")
+		args = append(args, f.Until)
+	}
+	if f.Running {
+		conditions = append(conditions, "m.is_running = 1")
+	}
+	query := `SELECT ` + machineColumns
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY m.gmt_started DESC, m.id"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+	return queryMachines(q, query, args...)
+}
+
+// FindLatest returns the most recently started instance of businessKey, or
+// sql.ErrNoRows when the business key was never used.
+func FindLatest(q Querier, businessKey string) (Machine, error) {
+	return scanMachine(q.QueryRow(`SELECT `+machineColumns+` WHERE m.business_key = ? ORDER BY m.gmt_started DESC, m.id LIMIT 1`, businessKey))
+}
+
+// ListStuck returns the instances the engine did not bring to an end:
+// still marked running, or left with status or compensation status UN. Only
+// instances last updated before updatedBefore are returned, so a live
+// instance is not mistaken for a stuck one.
+func ListStuck(q Querier, updatedBefore time.Time) ([]Machine, error) {
+	return queryMachines(q, `SELECT `+machineColumns+`
+		WHERE (m.is_running = 1 OR m.status = 'UN' OR m.compensation_status = 'UN') AND m.gmt_updated < ?
+		ORDER BY m.gmt_updated, m.id`, updatedBefore)
+}
+
+// LoadChildren returns the instances a SubStateMachine state of xid started.
+// The engine records their parent as "<parent xid>:<state id>".
+func LoadChildren(q Querier, xid string) ([]Machine, error) {
+	return queryMachines(q, `SELECT `+machineColumns+` WHERE m.parent_id LIKE ? ESCAPE '!' ORDER BY m.gmt_started, m.id`, escapeLike(xid)+":%")
+}
+
+func queryMachines(q Querier, query string, args ...any) ([]Machine, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var machines []Machine
+	for rows.Next() {
+		m, err := scanMachine(rows)
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	return machines, rows.Err()
+}
+
+// LoadStates reads the state rows of xid in start order. Rows started in
+// the same instant keep the order the database returns them in.
+func LoadStates(q Querier, xid string) ([]State, error) {
+	rows, err := q.Query(`SELECT `+stateColumns+` WHERE machine_inst_id = ? ORDER BY gmt_started ASC`, xid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []State
+	for rows.Next() {
+		var s State
+		if err := rows.Scan(&s.ID, &s.MachineInstID, &s.Name, &s.Type, &s.ServiceName, &s.ServiceMethod, &s.ServiceType, &s.Status,
+			&s.CompensatedFor, &s.RetriedFor, &s.InputParams, &s.OutputParams, &s.Excep, &s.GmtStarted, &s.GmtEnd); err != nil {
+			return nil, err
+		}
+		states = append(states, s)
+	}
+	return states, rows.Err()
+}
+
+// escapeLike escapes s for a LIKE pattern with ESCAPE '!'. SQLite has no
+// default escape character and MySQL's backslash would need quoting that
+// differs between the two, so the queries name their own.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
@@ -0,0 +1,249 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package statelang reads the state-language JSON definitions used by the
+// saga samples, so that tools can reason about a state machine without
+// starting the engine. It understands the structural fields only; inputs,
+// outputs and expressions are kept as raw JSON.
+package statelang
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// State types used by the samples.
+const (
+	TypeServiceTask          = "ServiceTask"
+	TypeScriptTask           = "ScriptTask"
+	TypeChoice               = "Choice"
+	TypeSubStateMachine      = "SubStateMachine"
+	TypeCompensateSubMachine = "CompensateSubMachine"
+	TypeCompensationTrigger  = "CompensationTrigger"
+	TypeSucceed              = "Succeed"
+	TypeFail                 = "Fail"
+)
+
+// CompensateSubMachinePrefix starts the name of the state the engine adds
+// to compensate a SubStateMachine state that declares no CompensateState.
+const CompensateSubMachinePrefix = "_compensate_sub_machine_state_"
+
+// StateMachine is one parsed definition.
+type StateMachine struct {
+	Name       string            `json:"Name"`
+	Comment    string            `json:"Comment"`
+	StartState string            `json:"StartState"`
+	Version    string            `json:"Version"`
+	States     map[string]*State `json:"States"`
+
+	// Order lists the state names in declaration order.
+	Order []string `json:"-"`
+	// File is the path the definition was loaded from.
+	File string `json:"-"`
+}
+
+// State is one entry of States.
+type State struct {
+	Name string `json:"-"`
+
+	Type             string          `json:"Type"`
+	Comment          string          `json:"Comment"`
+	ServiceType      string          `json:"ServiceType"`
+	ServiceName      string          `json:"ServiceName"`
+	ServiceMethod    string          `json:"ServiceMethod"`
+	CompensateState  string          `json:"CompensateState"`
+	StateMachineName string          `json:"StateMachineName"`
+	ScriptType       string          `json:"ScriptType"`
+	ScriptContent    string          `json:"ScriptContent"`
+	Next             string          `json:"Next"`
+	Default          string          `json:"Default"`
+	Choices          []Choice        `json:"Choices"`
+	Catch            []Catch         `json:"Catch"`
+	Retry            []Retry         `json:"Retry"`
+	Input            json.RawMessage `json:"Input"`
+	Output           json.RawMessage `json:"Output"`
+
+	// ForCompensation is set on states another state names as its
+	// CompensateState.
+	ForCompensation bool `json:"-"`
+}
+
+// Choice is one branch of a Choice state.
+type Choice struct {
+	Expression string `json:"Expression"`
+	Next       string `json:"Next"`
+}
+
+// Catch routes the listed exceptions to Next.
+type Catch struct {
+	Exceptions []string `json:"Exceptions"`
+	Next       string   `json:"Next"`
+}
+
+// Retry retries the listed exceptions before any Catch applies.
+type Retry struct {
+	Exceptions      []string `json:"Exceptions"`
+	IntervalSeconds float64  `json:"IntervalSeconds"`
+	MaxAttempts     int      `json:"MaxAttempts"`
+	BackoffRate     float64  `json:"BackoffRate"`
+}
+
+// Load parses one definition file.
+func Load(path string) (*StateMachine, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.File = path
+	return m, nil
+}
+
+// Parse parses a definition held in memory.
+func Parse(raw []byte) (*StateMachine, error) {
+	var m StateMachine
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	if m.Name == "" {
+		return nil, fmt.Errorf("state machine has no Name")
+	}
+	order, err := stateOrder(raw)
+	if err != nil {
+		return nil, err
+	}
+	m.Order = order
+	for name, state := range m.States {
+		if state == nil {
+			return nil, fmt.Errorf("state %s is null", name)
+		}
+		state.Name = name
+	}
+	for _, name := range order {
+		state := m.States[name]
+		if state.Type != TypeSubStateMachine || state.CompensateState != "" {
+			continue
+		}
+		// the engine compensates the sub-machine with a state of its own,
+		// which is what the store records
+		compensation := &State{Name: CompensateSubMachinePrefix + name, Type: TypeCompensateSubMachine}
+		m.States[compensation.Name] = compensation
+		m.Order = append(m.Order, compensation.Name)
+		state.CompensateState = compensation.Name
+	}
+	for _, state := range m.States {
+		if compensation, ok := m.States[state.CompensateState]; ok {
+			compensation.ForCompensation = true
+		}
+	}
+	return &m, nil
+}
+
+// LoadGlob parses every file matching pattern, ordered by path.
+func LoadGlob(pattern string) ([]*StateMachine, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no state machine definitions match %s", pattern)
+	}
+	sort.Strings(paths)
+	machines := make([]*StateMachine, 0, len(paths))
+	for _, path := range paths {
+		m, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
+// Find returns the definition called name.
+func Find(machines []*StateMachine, name string) (*StateMachine, error) {
+	for _, m := range machines {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown state machine %q", name)
+}
+
+// State returns the state called name, or nil.
+func (m *StateMachine) State(name string) *State {
+	return m.States[name]
+}
+
+// Compensates returns the forward states whose CompensateState is name.
+func (m *StateMachine) Compensates(name string) []string {
+	var forward []string
+	for _, stateName := range m.Order {
+		if m.States[stateName].CompensateState == name {
+			forward = append(forward, stateName)
+		}
+	}
+	return forward
+}
+
+// stateOrder walks the raw JSON to recover the declaration order of States,
+// which a Go map does not keep.
+func stateOrder(raw []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := token.(string); key != "States" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if token, err := decoder.Token(); err != nil {
+			return nil, err
+		} else if delim, ok := token.(json.Delim); !ok || delim != '{' {
+			return nil, fmt.Errorf("States must be an object")
+		}
+		var order []string
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			order = append(order, token.(string))
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+		}
+		return order, nil
+	}
+	return nil, nil
+}
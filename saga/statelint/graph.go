@@ -0,0 +1,171 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// edges lists the transitions of m in declaration order. Both formats draw
+// the forward flow with solid edges, Catch routes in red and the
+// CompensateState of every state as a dotted blue edge, so the compensation
+// chain can be read next to the flow it undoes.
+func edges(m *statelang.StateMachine) []edge {
+	var all []edge
+	for _, name := range m.Order {
+		all = append(all, outgoing(m.States[name])...)
+	}
+	return all
+}
+
+func writeDOT(w io.Writer, m *statelang.StateMachine) {
+	fmt.Fprintf(w, "digraph %s {\n", dotQuote(m.Name))
+	fmt.Fprintln(w, "  rankdir=TB;")
+	fmt.Fprintln(w, `  node [shape=box, style=rounded, fontname="Helvetica"];`)
+	fmt.Fprintln(w, `  edge [fontname="Helvetica", fontsize=10];`)
+	fmt.Fprintln(w, `  __start [shape=point];`)
+	fmt.Fprintf(w, "  __start -> %s;\n", dotQuote(m.StartState))
+	for _, name := range m.Order {
+		fmt.Fprintf(w, "  %s [%s];\n", dotQuote(name), dotNode(m.States[name]))
+	}
+	for _, e := range edges(m) {
+		var attrs []string
+		if e.label != "" {
+			attrs = append(attrs, "label="+dotQuote(e.label))
+		}
+		switch e.kind {
+		case "catch":
+			attrs = append(attrs, "color=red", "fontcolor=red")
+		case "compensate":
+			attrs = append(attrs, "style=dotted", "color=blue", "constraint=false")
+		case "default":
+			attrs = append(attrs, "style=dashed")
+		}
+		if len(attrs) == 0 {
+			fmt.Fprintf(w, "  %s -> %s;\n", dotQuote(e.from), dotQuote(e.to))
+			continue
+		}
+		fmt.Fprintf(w, "  %s -> %s [%s];\n", dotQuote(e.from), dotQuote(e.to), strings.Join(attrs, ", "))
+	}
+	fmt.Fprintln(w, "}")
+}
+
+func dotNode(s *statelang.State) string {
+	label := "label=" + dotQuote(s.Name+"\n"+s.Type)
+	switch {
+	case s.ForCompensation:
+		return label + `, style="rounded,dashed", color=blue`
+	case s.Type == statelang.TypeChoice:
+		return label + ", shape=diamond, style=solid"
+	case s.Type == statelang.TypeSucceed:
+		return label + ", shape=doublecircle, style=solid, color=darkgreen"
+	case s.Type == statelang.TypeFail:
+		return label + ", shape=doublecircle, style=solid, color=red"
+	case s.Type == statelang.TypeCompensationTrigger:
+		return label + ", shape=octagon, style=solid, color=blue"
+	case s.Type == statelang.TypeSubStateMachine:
+		return "label=" + dotQuote(s.Name+"\n"+s.Type+" "+s.StateMachineName) + ", shape=box3d, style=solid"
+	case s.Type == statelang.TypeScriptTask:
+		return label + ", shape=note, style=solid"
+	}
+	return label
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func writeMermaid(w io.Writer, m *statelang.StateMachine) {
+	ids := make(map[string]string, len(m.Order))
+	for i, name := range m.Order {
+		ids[name] = fmt.Sprintf("s%d", i)
+	}
+	id := func(name string) string {
+		if v, ok := ids[name]; ok {
+			return v
+		}
+		// an undeclared target still gets a node, so the mistake shows
+		v := fmt.Sprintf("s%d", len(ids))
+		ids[name] = v
+		return v
+	}
+
+	fmt.Fprintf(w, "---\ntitle: %s\n---\n", m.Name)
+	fmt.Fprintln(w, "flowchart TD")
+	fmt.Fprintf(w, "  start((start)) --> %s\n", id(m.StartState))
+	var compensations []string
+	for _, name := range m.Order {
+		s := m.States[name]
+		fmt.Fprintf(w, "  %s%s\n", id(name), mermaidShape(s))
+		if s.ForCompensation {
+			compensations = append(compensations, id(name))
+		}
+	}
+	var catchLinks, compensateLinks []int
+	for i, e := range edges(m) {
+		from, to := id(e.from), id(e.to)
+		switch e.kind {
+		case "catch":
+			catchLinks = append(catchLinks, i+1)
+			fmt.Fprintf(w, "  %s -->|%s| %s\n", from, mermaidQuote("catch: "+e.label), to)
+		case "compensate":
+			compensateLinks = append(compensateLinks, i+1)
+			fmt.Fprintf(w, "  %s -.->|compensate| %s\n", from, to)
+		case "choice", "default":
+			fmt.Fprintf(w, "  %s -->|%s| %s\n", from, mermaidQuote(e.label), to)
+		default:
+			fmt.Fprintf(w, "  %s --> %s\n", from, to)
+		}
+	}
+	// link 0 is the start edge
+	for _, link := range catchLinks {
+		fmt.Fprintf(w, "  linkStyle %d stroke:red\n", link)
+	}
+	for _, link := range compensateLinks {
+		fmt.Fprintf(w, "  linkStyle %d stroke:blue\n", link)
+	}
+	if len(compensations) > 0 {
+		fmt.Fprintln(w, "  classDef compensation stroke:blue,stroke-dasharray:4 3")
+		fmt.Fprintf(w, "  class %s compensation\n", strings.Join(compensations, ","))
+	}
+}
+
+func mermaidShape(s *statelang.State) string {
+	label := mermaidQuote(s.Name + "<br/><i>" + s.Type + "</i>")
+	switch s.Type {
+	case statelang.TypeChoice:
+		return "{" + label + "}"
+	case statelang.TypeSucceed, statelang.TypeFail:
+		return "([" + label + "])"
+	case statelang.TypeCompensationTrigger:
+		return "{{" + label + "}}"
+	case statelang.TypeSubStateMachine:
+		return "[[" + mermaidQuote(s.Name+"<br/><i>"+s.Type+" "+s.StateMachineName+"</i>") + "]]"
+	}
+	return "[" + label + "]"
+}
+
+// mermaidQuote quotes a label; double quotes inside it become entity codes.
+func mermaidQuote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -0,0 +1,395 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+type severity string
+
+const (
+	severityError   severity = "error"
+	severityWarning severity = "warning"
+)
+
+// finding is one problem of one state, or of the whole machine when state
+// is empty.
+type finding struct {
+	machine  *statelang.StateMachine
+	state    string
+	severity severity
+	message  string
+}
+
+func (f finding) String() string {
+	where := f.machine.Name
+	if f.state != "" {
+		where += "." + f.state
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", f.machine.File, where, f.severity, f.message)
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	params := fs.String("params", "", "comma-separated start parameters; enables the check for unknown context keys")
+	strict := fs.Bool("strict", false, "fail on warnings too")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	machines, err := loadAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	var startParams []string
+	if *params != "" {
+		startParams = strings.Split(*params, ",")
+	}
+
+	var findings []finding
+	for _, m := range machines {
+		findings = append(findings, lint(m, machines, startParams)...)
+	}
+	errors, warnings := 0, 0
+	for _, f := range findings {
+		fmt.Println(f)
+		if f.severity == severityError {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	fmt.Printf("%d definitions, %d errors, %d warnings\n", len(machines), errors, warnings)
+	if errors > 0 || (*strict && warnings > 0) {
+		return fmt.Errorf("definitions have problems")
+	}
+	return nil
+}
+
+// lint runs every rule on m. all is used to find the parents that start m
+// as a sub-machine. startParams, when set, enables the context key check.
+func lint(m *statelang.StateMachine, all []*statelang.StateMachine, startParams []string) []finding {
+	var findings []finding
+	report := func(state string, sev severity, format string, args ...any) {
+		findings = append(findings, finding{machine: m, state: state, severity: sev, message: fmt.Sprintf(format, args...)})
+	}
+
+	if m.State(m.StartState) == nil {
+		report("", severityError, "StartState %q is not declared", m.StartState)
+		return findings
+	}
+	for _, name := range m.Order {
+		s := m.States[name]
+		for _, e := range outgoing(s) {
+			if m.State(e.to) == nil {
+				report(name, severityError, "%s target %q is not declared", e.kind, e.to)
+			}
+		}
+	}
+
+	reachable := reachableFrom(m, m.StartState)
+	for _, name := range m.Order {
+		if !reachable[name] {
+			report(name, severityError, "unreachable from StartState %s", m.StartState)
+		}
+	}
+
+	for _, name := range m.Order {
+		s := m.States[name]
+		if s.Type == statelang.TypeServiceTask && !s.ForCompensation && s.CompensateState == "" {
+			report(name, severityWarning, "ServiceTask declares no CompensateState; a later failure cannot undo it")
+		}
+		if s.ForCompensation && s.Next != "" {
+			if next := m.State(s.Next); next != nil && isForward(next) {
+				report(name, severityError, "compensation state continues with forward state %s", s.Next)
+			}
+		}
+	}
+
+	for _, name := range m.Order {
+		for _, c := range m.States[name].Catch {
+			target := m.State(c.Next)
+			if target == nil {
+				continue
+			}
+			if target.ForCompensation {
+				report(name, severityError, "Catch %s goes straight to compensation state %s, bypassing %s; only that one compensation would run",
+					strings.Join(c.Exceptions, ","), c.Next, statelang.TypeCompensationTrigger)
+				continue
+			}
+			if target.Type == statelang.TypeCompensationTrigger {
+				continue
+			}
+			undone := compensableBefore(m, name)
+			if len(undone) > 0 && endsWithoutTrigger(m, c.Next) {
+				report(name, severityWarning, "Catch %s can end the machine through %s without a %s, leaving %s uncompensated",
+					strings.Join(c.Exceptions, ","), c.Next, statelang.TypeCompensationTrigger, strings.Join(undone, ", "))
+			}
+		}
+	}
+
+	if known := knownKeys(m, all, startParams); known != nil {
+		for _, name := range m.Order {
+			s := m.States[name]
+			for _, key := range contextKeys(s.Input) {
+				if !known[key] {
+					report(name, severityError, "Input references context key %q, which is neither a start parameter nor any state's Output", key)
+				}
+			}
+			if s.Type == statelang.TypeChoice {
+				for _, choice := range s.Choices {
+					for _, key := range contextKeys(json.RawMessage(fmt.Sprintf("%q", choice.Expression))) {
+						if !known[key] {
+							report(name, severityError, "Choice expression references context key %q, which is neither a start parameter nor any state's Output", key)
+						}
+					}
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// edge is one transition of the definition. kind is next, choice, default,
+// catch or compensate.
+type edge struct {
+	from, to string
+	kind     string
+	label    string
+}
+
+func outgoing(s *statelang.State) []edge {
+	var edges []edge
+	if s.Next != "" {
+		edges = append(edges, edge{from: s.Name, to: s.Next, kind: "next"})
+	}
+	for _, c := range s.Choices {
+		edges = append(edges, edge{from: s.Name, to: c.Next, kind: "choice", label: c.Expression})
+	}
+	if s.Default != "" {
+		edges = append(edges, edge{from: s.Name, to: s.Default, kind: "default", label: "default"})
+	}
+	for _, c := range s.Catch {
+		edges = append(edges, edge{from: s.Name, to: c.Next, kind: "catch", label: strings.Join(c.Exceptions, ", ")})
+	}
+	if s.CompensateState != "" {
+		edges = append(edges, edge{from: s.Name, to: s.CompensateState, kind: "compensate", label: "compensate"})
+	}
+	return edges
+}
+
+// isForward reports whether s is a step of the forward flow, as opposed to
+// a compensation, a trigger or an end state.
+func isForward(s *statelang.State) bool {
+	if s.ForCompensation {
+		return false
+	}
+	switch s.Type {
+	case statelang.TypeServiceTask, statelang.TypeScriptTask, statelang.TypeSubStateMachine, statelang.TypeChoice:
+		return true
+	}
+	return false
+}
+
+// reachableFrom follows every edge, including CompensateState, so
+// compensation states count as reachable through the states they undo.
+func reachableFrom(m *statelang.StateMachine, start string) map[string]bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		s := m.State(queue[0])
+		queue = queue[1:]
+		if s == nil {
+			continue
+		}
+		for _, e := range outgoing(s) {
+			if !seen[e.to] {
+				seen[e.to] = true
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return seen
+}
+
+// forwardReachable follows the edges a run takes before any compensation:
+// Next, Choices, Default and Catch.
+func forwardReachable(m *statelang.StateMachine, start string) map[string]bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		s := m.State(queue[0])
+		queue = queue[1:]
+		if s == nil || s.Type == statelang.TypeCompensationTrigger {
+			continue
+		}
+		for _, e := range outgoing(s) {
+			if e.kind != "compensate" && !seen[e.to] {
+				seen[e.to] = true
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return seen
+}
+
+// compensableBefore lists the states with a CompensateState that can have
+// run before state name.
+func compensableBefore(m *statelang.StateMachine, name string) []string {
+	fromStart := forwardReachable(m, m.StartState)
+	var undone []string
+	for _, other := range m.Order {
+		s := m.States[other]
+		if other == name || !fromStart[other] || s.CompensateState == "" || s.ForCompensation {
+			continue
+		}
+		if forwardReachable(m, other)[name] {
+			undone = append(undone, other)
+		}
+	}
+	return undone
+}
+
+// endsWithoutTrigger reports whether a run that continues at start can reach
+// a Succeed or Fail state without passing a CompensationTrigger.
+func endsWithoutTrigger(m *statelang.StateMachine, start string) bool {
+	seen := map[string]bool{start: true}
+	queue := []string{start}
+	for len(queue) > 0 {
+		s := m.State(queue[0])
+		queue = queue[1:]
+		if s == nil || s.Type == statelang.TypeCompensationTrigger {
+			continue
+		}
+		if s.Type == statelang.TypeSucceed || s.Type == statelang.TypeFail {
+			return true
+		}
+		for _, e := range outgoing(s) {
+			if e.kind != "compensate" && !seen[e.to] {
+				seen[e.to] = true
+				queue = append(queue, e.to)
+			}
+		}
+	}
+	return false
+}
+
+var contextKey = regexp.MustCompile(`elContext\['context'\]\['([^']+)'\]`)
+
+// contextKeys returns the context variables an Input or expression reads,
+// in order of appearance.
+func contextKeys(raw json.RawMessage) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case string:
+			for _, match := range contextKey.FindAllStringSubmatch(v, -1) {
+				if !seen[match[1]] {
+					seen[match[1]] = true
+					keys = append(keys, match[1])
+				}
+			}
+		case []any:
+			for _, item := range v {
+				walk(item)
+			}
+		case map[string]any:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				walk(v[name])
+			}
+		}
+	}
+	var v any
+	if len(raw) > 0 && json.Unmarshal(raw, &v) == nil {
+		walk(v)
+	}
+	return keys
+}
+
+// mapKeys returns the keys of the JSON objects in raw, which is an Output
+// object or an Input list.
+func mapKeys(raw json.RawMessage) []string {
+	var object map[string]json.RawMessage
+	if json.Unmarshal(raw, &object) == nil {
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		return keys
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) != nil {
+		return nil
+	}
+	var keys []string
+	for _, item := range list {
+		if json.Unmarshal(item, &object) == nil {
+			for key := range object {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// knownKeys collects the context variables m can read: its Outputs, plus
+// either startParams or, for a sub-machine, the Input keys of the
+// SubStateMachine states that start it. It returns nil when neither is
+// available, which disables the check.
+func knownKeys(m *statelang.StateMachine, all []*statelang.StateMachine, startParams []string) map[string]bool {
+	known := make(map[string]bool)
+	sub := false
+	for _, parent := range all {
+		for _, s := range parent.States {
+			if s.Type == statelang.TypeSubStateMachine && s.StateMachineName == m.Name {
+				sub = true
+				for _, key := range mapKeys(s.Input) {
+					known[key] = true
+				}
+			}
+		}
+	}
+	if !sub {
+		if len(startParams) == 0 {
+			return nil
+		}
+		for _, key := range startParams {
+			known[strings.TrimSpace(key)] = true
+		}
+	}
+	for _, s := range m.States {
+		for _, key := range mapKeys(s.Output) {
+			known[key] = true
+		}
+	}
+	return known
+}
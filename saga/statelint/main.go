@@ -0,0 +1,145 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// statelint checks state-language definitions for mistakes the engine only
+// reveals at run time, and draws their flow and compensation edges.
+//
+//	statelint lint [-params businessKey,amount] [-strict] [files or globs...]
+//	statelint dot [-machine Name] [files or globs...]
+//	statelint mermaid [-machine Name] [files or globs...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"seata.apache.org/seata-go-samples/saga/statelang"
+)
+
+// defaultPattern covers the definitions of every saga sample, relative to
+// the repository root.
+const defaultPattern = "saga/*/statelang/*.json"
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"lint", "report unreachable states, missing compensations, Catch routes that bypass CompensationTrigger and unknown context keys", runLint},
+	{"dot", "print the flow and compensation edges as a Graphviz DOT graph", func(args []string) error { return runGraph("dot", args) }},
+	{"mermaid", "print the flow and compensation edges as a Mermaid flowchart", func(args []string) error { return runGraph("mermaid", args) }},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "statelint %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: statelint <command> [flags] [files or globs...]")
+	fmt.Fprintln(os.Stderr, "")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintf(os.Stderr, "Without files, the definitions matching %s are read.\n", defaultPattern)
+	fmt.Fprintln(os.Stderr, "Run 'statelint <command> -h' for the flags of a command.")
+}
+
+// loadAll parses every file named or matched by args, or by defaultPattern
+// when there are none, ordered by path.
+func loadAll(args []string) ([]*statelang.StateMachine, error) {
+	if len(args) == 0 {
+		args = []string{defaultPattern}
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no definitions match %s", arg)
+		}
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	machines := make([]*statelang.StateMachine, 0, len(paths))
+	for _, path := range paths {
+		m, err := statelang.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		machines = append(machines, m)
+	}
+	return machines, nil
+}
+
+func runGraph(format string, args []string) error {
+	fs := flag.NewFlagSet(format, flag.ExitOnError)
+	machine := fs.String("machine", "", "only draw the state machine with this name")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	machines, err := loadAll(fs.Args())
+	if err != nil {
+		return err
+	}
+	if *machine != "" {
+		m, err := statelang.Find(machines, *machine)
+		if err != nil {
+			return err
+		}
+		machines = []*statelang.StateMachine{m}
+	}
+	for i, m := range machines {
+		if i > 0 {
+			fmt.Println()
+		}
+		if format == "dot" {
+			writeDOT(os.Stdout, m)
+		} else {
+			writeMermaid(os.Stdout, m)
+		}
+	}
+	return nil
+}
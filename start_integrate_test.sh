@@ -23,6 +23,10 @@ array+=("integrate_test/at/select_for_update")
 array+=("integrate_test/tcc/insert")
 array+=("integrate_test/tcc/insert_on_update")
 array+=("integrate_test/tcc/select_on_update")
+array+=("integrate_test/tcc/fence")
+array+=("integrate_test/tcc/failure")
+
+array+=("integrate_test/xa/insert")
 
 
 DOCKER_DIR=$(pwd)/dockercompose
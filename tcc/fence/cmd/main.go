@@ -19,6 +19,9 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"seata.apache.org/seata-go/pkg/client"
@@ -26,29 +29,66 @@ import (
 	"seata.apache.org/seata-go/pkg/util/log"
 
 	"seata.apache.org/seata-go-samples/tcc/fence/service"
+	"seata.apache.org/seata-go-samples/util"
 )
 
+const userID = "U1001"
+
 func main() {
 	client.InitPath("../../../conf/seatago.yml")
-	_ = tm.WithGlobalTx(context.Background(), &tm.GtxConfig{
+	db := util.GetTccMySqlDb()
+	defer db.Close()
+
+	accountService, err := service.NewAccountService(db).TCC()
+	if err != nil {
+		panic(err)
+	}
+	logAccount(db, "before")
+
+	// The first global transaction commits: 30 is frozen, then deducted.
+	err = tm.WithGlobalTx(context.Background(), &tm.GtxConfig{
+		Name: "TccSampleLocalGlobalTx",
+	}, func(ctx context.Context) error {
+		err := accountService.Prepare(ctx, service.FreezeParam{UserID: userID, Amount: 30})
+		return err
+	})
+	if err != nil {
+		log.Errorf("commit global tx error, %v", err)
+	}
+
+	// The second one fails after freezing 50, so the freeze is rolled back.
+	err = tm.WithGlobalTx(context.Background(), &tm.GtxConfig{
 		Name: "TccSampleLocalGlobalTx",
-	}, business)
-	<-make(chan struct{})
+	}, func(ctx context.Context) error {
+		if err := accountService.Prepare(ctx, service.FreezeParam{UserID: userID, Amount: 50}); err != nil {
+			return err
+		}
+		return errors.New("order creation failed after the freeze")
+	})
+	log.Infof("rollback global tx result, %v", err)
+
+	// Branch commit and rollback are delivered by the TC asynchronously.
+	waitUnfrozen(db, 10*time.Second)
+	logAccount(db, "after")
 }
 
-func business(ctx context.Context) (re error) {
-	tccService := service.NewTestTCCServiceBusinessProxy()
-	tccService2 := service.NewTestTCCServiceBusiness2Proxy()
-	_, re = tccService.Prepare(ctx, 1)
-	if re != nil {
-		log.Errorf("TestTCCServiceBusiness prepare error, %v", re.Error())
-		return
-	}
-	_, re = tccService2.Prepare(ctx, 3)
-	if re != nil {
-		log.Errorf("TestTCCServiceBusiness2 prepare error, %v", re.Error())
+func logAccount(db *sql.DB, when string) {
+	var balance, frozen int64
+	if err := db.QueryRow("SELECT balance, frozen_balance FROM account_tbl WHERE user_id = ?", userID).Scan(&balance, &frozen); err != nil {
+		log.Errorf("query account %s error, %v", userID, err)
 		return
 	}
+	log.Infof("account %s %s: balance=%d frozen_balance=%d", userID, when, balance, frozen)
+}
 
-	return
+func waitUnfrozen(db *sql.DB, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var frozen int64
+		if err := db.QueryRow("SELECT frozen_balance FROM account_tbl WHERE user_id = ?", userID).Scan(&frozen); err == nil && frozen == 0 {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	log.Errorf("account %s still has a frozen balance after %s", userID, timeout)
 }
@@ -0,0 +1,201 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// fencelog inspects and purges the TCC fence log that fence.WithFence
+// writes, using the MySQL settings of util.GetTccMySqlDb.
+//
+//	fencelog list [-xid X] [-branch N] [-status tried|committed|rollbacked|suspended] [-limit N]
+//	fencelog clean [-retention 168h] [-batch 1000] [-dry-run]
+//	fencelog suspended [-older 0s]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+
+	"seata.apache.org/seata-go-samples/util"
+)
+
+// defaultTable is tcc.fence.log-table-name in conf/seatago.yml.
+const defaultTable = "tcc_fence_log_test"
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"list", "list fence records, filtered by xid, branch and status", runList},
+	{"clean", "delete committed and rolled back records older than the retention period, in batches", runClean},
+	{"suspended", "report suspended records that need operator attention", runSuspended},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "fencelog %s: %v\n", c.name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fencelog <command> [flags]")
+	fmt.Fprintln(os.Stderr, "")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "The database is taken from MYSQL_HOST, MYSQL_PORT, MYSQL_USERNAME, MYSQL_PASSWORD and MYSQL_DB.")
+	fmt.Fprintln(os.Stderr, "Run 'fencelog <command> -h' for the flags of a command.")
+}
+
+// tableName is the -table flag every command takes. The name is written
+// into the statements, so it is checked to be a plain identifier.
+type tableName string
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func (t *tableName) String() string {
+	return string(*t)
+}
+
+func (t *tableName) Set(value string) error {
+	if !identifier.MatchString(value) {
+		return fmt.Errorf("%q is not a table name", value)
+	}
+	*t = tableName(value)
+	return nil
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *tableName) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	table := tableName(defaultTable)
+	fs.Var(&table, "table", "fence log table, tcc.fence.log-table-name in seatago.yml")
+	return fs, &table
+}
+
+func runList(args []string) error {
+	fs, table := newFlagSet("list")
+	xid := fs.String("xid", "", "only records of this global transaction")
+	branch := fs.Int64("branch", 0, "only records of this branch id")
+	var status statusFlag
+	fs.Var(&status, "status", "only records in this status: tried, committed, rollbacked, suspended or 1-4")
+	limit := fs.Int("limit", 100, "print at most this many records, newest first; 0 prints all")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db := util.GetTccMySqlDb()
+	defer db.Close()
+	records, err := queryRecords(db, string(*table), filter{xid: *xid, branchID: *branch, status: Status(status), limit: *limit})
+	if err != nil {
+		return err
+	}
+	printRecords(records)
+	fmt.Printf("%d record(s)\n", len(records))
+	return nil
+}
+
+func runClean(args []string) error {
+	fs, table := newFlagSet("clean")
+	retention := fs.Duration("retention", 7*24*time.Hour, "keep records modified within this period")
+	batch := fs.Int("batch", 1000, "delete at most this many records per statement")
+	dryRun := fs.Bool("dry-run", false, "only count the records that would be deleted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *retention <= 0 {
+		return fmt.Errorf("-retention must be positive")
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("-batch must be positive")
+	}
+
+	db := util.GetTccMySqlDb()
+	defer db.Close()
+	before := time.Now().Add(-*retention)
+	if *dryRun {
+		n, err := countFinished(db, string(*table), before)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d committed or rolled back record(s) modified before %s would be deleted\n", n, before.Format(time.RFC3339))
+		return nil
+	}
+	deleted, err := deleteFinished(db, string(*table), before, *batch, func(total int64) {
+		fmt.Printf("deleted %d record(s)\n", total)
+	})
+	fmt.Printf("%d committed or rolled back record(s) modified before %s deleted\n", deleted, before.Format(time.RFC3339))
+	return err
+}
+
+// runSuspended prints the suspended records. A suspended record is left by
+// a rollback that arrived before its prepare; it keeps blocking that
+// prepare, so it is never cleaned, and a late prepare that did arrive
+// failed. Either may need a look at the business data of the branch.
+func runSuspended(args []string) error {
+	fs, table := newFlagSet("suspended")
+	older := fs.Duration("older", 0, "only records suspended for at least this long")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db := util.GetTccMySqlDb()
+	defer db.Close()
+	records, err := queryRecords(db, string(*table), filter{status: StatusSuspended, modifiedBefore: time.Now().Add(-*older)})
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		fmt.Println("no suspended records")
+		return nil
+	}
+	printRecords(records)
+	fmt.Printf("%d suspended record(s) need attention: their prepare never ran or was refused\n", len(records))
+	return nil
+}
+
+func printRecords(records []Record) {
+	if len(records) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "XID\tBRANCH\tACTION\tSTATUS\tCREATED\tMODIFIED")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", r.Xid, r.BranchID, r.ActionName, r.Status,
+			r.Created.Format(time.DateTime), r.Modified.Format(time.DateTime))
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,183 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the status column of the fence log.
+type Status int
+
+const (
+	StatusTried      Status = 1
+	StatusCommitted  Status = 2
+	StatusRollbacked Status = 3
+	StatusSuspended  Status = 4
+)
+
+var statusNames = map[Status]string{
+	StatusTried:      "tried",
+	StatusCommitted:  "committed",
+	StatusRollbacked: "rollbacked",
+	StatusSuspended:  "suspended",
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return "unknown(" + strconv.Itoa(int(s)) + ")"
+}
+
+// ParseStatus accepts a status name or its number.
+func ParseStatus(value string) (Status, error) {
+	for status, name := range statusNames {
+		if strings.EqualFold(value, name) || value == strconv.Itoa(int(status)) {
+			return status, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown status %q, expect tried, committed, rollbacked, suspended or 1-4", value)
+}
+
+// statusFlag is a Status flag whose zero value means any status.
+type statusFlag Status
+
+func (s *statusFlag) String() string {
+	if *s == 0 {
+		return ""
+	}
+	return Status(*s).String()
+}
+
+func (s *statusFlag) Set(value string) error {
+	status, err := ParseStatus(value)
+	if err != nil {
+		return err
+	}
+	*s = statusFlag(status)
+	return nil
+}
+
+// Record is one row of the fence log.
+type Record struct {
+	Xid        string
+	BranchID   int64
+	ActionName string
+	Status     Status
+	Created    time.Time
+	Modified   time.Time
+}
+
+// filter selects records; zero fields do not filter.
+type filter struct {
+	xid            string
+	branchID       int64
+	status         Status
+	modifiedBefore time.Time
+	limit          int
+}
+
+func queryRecords(db *sql.DB, table string, f filter) ([]Record, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	if f.xid != "" {
+		where = append(where, "xid = ?")
+		args = append(args, f.xid)
+	}
+	if f.branchID != 0 {
+		where = append(where, "branch_id = ?")
+		args = append(args, f.branchID)
+	}
+	if f.status != 0 {
+		where = append(where, "status = ?")
+		args = append(args, int(f.status))
+	}
+	if !f.modifiedBefore.IsZero() {
+		where = append(where, "gmt_modified <= ?")
+		args = append(args, f.modifiedBefore)
+	}
+
+	query := "SELECT xid, branch_id, action_name, status, gmt_create, gmt_modified FROM " + table
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY gmt_modified DESC"
+	if f.limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []Record
+	for rows.Next() {
+		var r Record
+		if err := rows.Scan(&r.Xid, &r.BranchID, &r.ActionName, &r.Status, &r.Created, &r.Modified); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// finished is the condition of the records clean may delete. Tried records
+// still wait for their second phase and suspended ones still block a late
+// prepare, so both are kept whatever their age.
+const finished = "status IN (?, ?) AND gmt_modified < ?"
+
+func countFinished(db *sql.DB, table string, before time.Time) (int64, error) {
+	var n int64
+	err := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE "+finished,
+		int(StatusCommitted), int(StatusRollbacked), before).Scan(&n)
+	return n, err
+}
+
+// deleteFinished deletes the finished records modified before before, batch
+// rows per statement so that no statement holds locks on a large part of
+// the table, and calls progress with the running total after each batch.
+func deleteFinished(db *sql.DB, table string, before time.Time, batch int, progress func(total int64)) (int64, error) {
+	var total int64
+	for {
+		result, err := db.Exec("DELETE FROM "+table+" WHERE "+finished+" LIMIT ?",
+			int(StatusCommitted), int(StatusRollbacked), before, batch)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n > 0 {
+			progress(total)
+		}
+		if n < int64(batch) {
+			return total, nil
+		}
+	}
+}
@@ -28,4 +28,17 @@ CREATE TABLE IF NOT EXISTS `tcc_fence_log`
     KEY `idx_gmt_modified` (`gmt_modified`),
     KEY `idx_status` (`status`)
 ) ENGINE = InnoDB
-DEFAULT CHARSET = utf8mb4;
\ No newline at end of file
+DEFAULT CHARSET = utf8mb4;
+
+-- -------------------------------- The account frozen by the sample service --------------------------------
+CREATE TABLE IF NOT EXISTS `account_tbl`
+(
+    `user_id`        VARCHAR(64)   NOT NULL COMMENT 'user id',
+    `balance`        BIGINT        NOT NULL COMMENT 'balance, including the frozen part',
+    `frozen_balance` BIGINT        NOT NULL DEFAULT 0 COMMENT 'amount frozen by tried branches',
+    PRIMARY KEY (`user_id`)
+) ENGINE = InnoDB
+DEFAULT CHARSET = utf8mb4;
+
+INSERT INTO `account_tbl` (`user_id`, `balance`, `frozen_balance`) VALUES ('U1001', 1000, 0)
+ON DUPLICATE KEY UPDATE `balance` = VALUES(`balance`), `frozen_balance` = VALUES(`frozen_balance`);
@@ -27,4 +27,13 @@ CREATE TABLE tcc_fence_log
     PRIMARY KEY (xid, branch_id)
 );
 CREATE INDEX idx_gmt_modified ON tcc_fence_log (gmt_modified);
-CREATE INDEX idx_status ON tcc_fence_log (status);
\ No newline at end of file
+CREATE INDEX idx_status ON tcc_fence_log (status);
+-- -------------------------------- The account frozen by the sample service --------------------------------
+CREATE TABLE account_tbl
+(
+    user_id          VARCHAR2(64)   NOT NULL,
+    balance          NUMBER(19)     NOT NULL,
+    frozen_balance   NUMBER(19)     DEFAULT 0 NOT NULL,
+    PRIMARY KEY (user_id)
+);
+INSERT INTO account_tbl (user_id, balance, frozen_balance) VALUES ('U1001', 1000, 0);
@@ -27,4 +27,14 @@ CREATE TABLE IF NOT EXISTS public.tcc_fence_log
     CONSTRAINT pk_tcc_fence_log PRIMARY KEY (xid, branch_id)
 );
 CREATE INDEX idx_gmt_modified ON public.tcc_fence_log (gmt_modified);
-CREATE INDEX idx_status ON public.tcc_fence_log (status);
\ No newline at end of file
+CREATE INDEX idx_status ON public.tcc_fence_log (status);
+-- -------------------------------- The account frozen by the sample service --------------------------------
+CREATE TABLE IF NOT EXISTS public.account_tbl
+(
+    user_id          VARCHAR(64)   NOT NULL,
+    balance          BIGINT        NOT NULL,
+    frozen_balance   BIGINT        NOT NULL DEFAULT 0,
+    CONSTRAINT pk_account_tbl PRIMARY KEY (user_id)
+);
+INSERT INTO public.account_tbl (user_id, balance, frozen_balance) VALUES ('U1001', 1000, 0)
+ON CONFLICT (user_id) DO UPDATE SET balance = EXCLUDED.balance, frozen_balance = EXCLUDED.frozen_balance;
@@ -19,216 +19,85 @@ package service
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
-	"sync"
 
-	"seata.apache.org/seata-go-samples/util"
-	"seata.apache.org/seata-go/pkg/rm/tcc"
-	"seata.apache.org/seata-go/pkg/rm/tcc/fence"
-	"seata.apache.org/seata-go/pkg/tm"
 	"seata.apache.org/seata-go/pkg/util/log"
-)
-
-var (
-	tccService     *tcc.TCCServiceProxy
-	tccServiceOnce sync.Once
 
-	tccService2     *tcc.TCCServiceProxy
-	tccService2Once sync.Once
+	"seata.apache.org/seata-go-samples/util"
 )
 
-type TestTCCServiceBusiness struct{}
+// ErrInsufficientBalance is returned by Prepare when the available balance,
+// balance minus frozen_balance, does not cover the amount.
+var ErrInsufficientBalance = errors.New("insufficient available balance")
 
-func NewTestTCCServiceBusinessProxy() *tcc.TCCServiceProxy {
-	if tccService != nil {
-		return tccService
-	}
-	tccServiceOnce.Do(func() {
-		var err error
-		tccService, err = tcc.NewTCCServiceProxy(&TestTCCServiceBusiness{})
-		if err != nil {
-			panic(fmt.Errorf("get TestTCCServiceBusiness tcc service proxy error, %v", err.Error()))
-		}
-	})
-	return tccService
+// FreezeParam is the Prepare argument. TypedTCC carries it to Commit and
+// Rollback, which is how they learn what to deduct or unfreeze.
+type FreezeParam struct {
+	UserID string `json:"userId"`
+	Amount int64  `json:"amount"`
 }
 
-func (T TestTCCServiceBusiness) Prepare(ctx context.Context, params interface{}) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
-	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
-	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness Prepare, param %v", params)
-		return nil
-	})
-
-	return
+// NewAccountService returns the AccountService action on db. It freezes an
+// amount in Prepare, deducts it in Commit and unfreezes it in Rollback. The
+// handle is a pool and is shared by all calls; the caller owns it.
+func NewAccountService(db *sql.DB) *util.FencedTCCAction[FreezeParam] {
+	return util.NewFencedTCCAction[FreezeParam]("AccountService", db, freeze, deduct, unfreeze)
 }
 
-func (T TestTCCServiceBusiness) Commit(ctx context.Context, businessActionContext *tm.BusinessActionContext) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
-	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
+func freeze(ctx context.Context, tx *sql.Tx, param FreezeParam) error {
+	if param.UserID == "" || param.Amount <= 0 {
+		return fmt.Errorf("invalid prepare param %+v", param)
 	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness Commit, param %v", businessActionContext)
-		return nil
-	})
-
-	return
-}
-
-func (T TestTCCServiceBusiness) Rollback(ctx context.Context, businessActionContext *tm.BusinessActionContext) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
+	result, err := tx.ExecContext(ctx,
+		"UPDATE account_tbl SET frozen_balance = frozen_balance + ? WHERE user_id = ? AND balance - frozen_balance >= ?",
+		param.Amount, param.UserID, param.Amount)
 	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
+		return err
 	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness Rollback, param %v", businessActionContext)
-		return nil
-	})
-
-	return
-}
-
-func (T TestTCCServiceBusiness) GetActionName() string {
-	return "TestTCCServiceBusiness"
-}
-
-type TestTCCServiceBusiness2 struct{}
-
-func NewTestTCCServiceBusiness2Proxy() *tcc.TCCServiceProxy {
-	if tccService2 != nil {
-		return tccService2
+	if err := oneRow(result, param.UserID, ErrInsufficientBalance); err != nil {
+		return err
 	}
-	tccService2Once.Do(func() {
-		var err error
-		tccService2, err = tcc.NewTCCServiceProxy(&TestTCCServiceBusiness2{})
-		if err != nil {
-			panic(fmt.Errorf("TestTCCServiceBusiness2 get tcc service proxy error, %v", err.Error()))
-		}
-	})
-	return tccService2
+	log.Infof("AccountService Prepare, froze %d of %s", param.Amount, param.UserID)
+	return nil
 }
 
-func (T TestTCCServiceBusiness2) Prepare(ctx context.Context, params interface{}) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
+func deduct(ctx context.Context, tx *sql.Tx, param FreezeParam) error {
+	result, err := tx.ExecContext(ctx,
+		"UPDATE account_tbl SET balance = balance - ?, frozen_balance = frozen_balance - ? WHERE user_id = ? AND frozen_balance >= ?",
+		param.Amount, param.Amount, param.UserID, param.Amount)
 	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
+		return err
 	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness2 Prepare, param %v", params)
-		return nil
-	})
-
-	return
+	if err := oneRow(result, param.UserID, fmt.Errorf("frozen balance is below %d", param.Amount)); err != nil {
+		return err
+	}
+	log.Infof("AccountService Commit, deducted %d from %s", param.Amount, param.UserID)
+	return nil
 }
 
-func (T TestTCCServiceBusiness2) Commit(ctx context.Context, businessActionContext *tm.BusinessActionContext) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
+func unfreeze(ctx context.Context, tx *sql.Tx, param FreezeParam) error {
+	result, err := tx.ExecContext(ctx,
+		"UPDATE account_tbl SET frozen_balance = frozen_balance - ? WHERE user_id = ? AND frozen_balance >= ?",
+		param.Amount, param.UserID, param.Amount)
 	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
+		return err
 	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness2 Commit, param %v", businessActionContext)
-		return nil
-	})
-
-	return
+	if err := oneRow(result, param.UserID, fmt.Errorf("frozen balance is below %d", param.Amount)); err != nil {
+		return err
+	}
+	log.Infof("AccountService Rollback, unfroze %d of %s", param.Amount, param.UserID)
+	return nil
 }
 
-func (T TestTCCServiceBusiness2) Rollback(ctx context.Context, businessActionContext *tm.BusinessActionContext) (b bool, err error) {
-	db := util.GetTccMySqlDb()
-	defer func() {
-		_ = db.Close()
-	}()
-	tx, err := db.Begin()
+func oneRow(result sql.Result, userID string, notMatched error) error {
+	rows, err := result.RowsAffected()
 	if err != nil {
-		return false, fmt.Errorf("transaction begin failed, msg :%s", err.Error())
+		return err
 	}
-
-	defer func() {
-		if err != nil {
-			err = fmt.Errorf("business method throw error: %s, rollback result: %s", err, tx.Rollback())
-			return
-		}
-		b, err = true, tx.Commit()
-	}()
-
-	err = fence.WithFence(ctx, tx, func() error {
-		log.Infof("TestTCCServiceBusiness2 Rollback, param %v", businessActionContext)
-		return nil
-	})
-
-	return
-}
-
-func (T TestTCCServiceBusiness2) GetActionName() string {
-	return "TestTCCServiceBusiness2"
+	if rows == 0 {
+		return fmt.Errorf("account %s: %w", userID, notMatched)
+	}
+	return nil
 }
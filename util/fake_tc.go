@@ -0,0 +1,77 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"seata.apache.org/seata-go-samples/util/faketc"
+)
+
+// FakeTCEnv set to true runs an integration test against an in-process
+// faketc instead of the Seata Server of dockercompose, like -fakeTC.
+const FakeTCEnv = "SEATA_FAKE_TC"
+
+// FakeTCFlag registers -fakeTC, which defaults to FakeTCEnv.
+func FakeTCFlag() *bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(FakeTCEnv))
+	return flag.Bool("fakeTC", enabled, "run against an in-process fake TC instead of a Seata Server (or set "+FakeTCEnv+"=true)")
+}
+
+// StartFakeTC starts faketc on the address conf/seatago.yml points the
+// client at. Call it before client.InitPath.
+func StartFakeTC() *faketc.Server {
+	tc, err := faketc.Start(faketc.Config{Addr: faketc.DefaultAddr, Logf: log.Printf})
+	if err != nil {
+		log.Fatalf("start fake TC: %v", err)
+	}
+	return tc
+}
+
+// ExpectGlobal checks that tc saw xid end in status with exactly the
+// branches in want, compared by type and status in registration order. AT
+// branches must also have declared the rows they lock. A nil tc, as in a
+// run against a Seata Server, checks nothing.
+func ExpectGlobal(tc *faketc.Server, xid string, status faketc.GlobalStatus, want ...faketc.Branch) error {
+	if tc == nil {
+		return nil
+	}
+	g, ok := tc.Global(xid)
+	if !ok {
+		return fmt.Errorf("fake TC: no global transaction %s", xid)
+	}
+	if g.Status != status {
+		return fmt.Errorf("fake TC: global %s ended %s, want %s", xid, g.Status, status)
+	}
+	if len(g.Branches) != len(want) {
+		return fmt.Errorf("fake TC: global %s has %d branches, want %d", xid, len(g.Branches), len(want))
+	}
+	for i, b := range g.Branches {
+		if b.Type != want[i].Type || b.Status != want[i].Status {
+			return fmt.Errorf("fake TC: branch %d of %s is %s %s, want %s %s", b.ID, xid, b.Type, b.Status, want[i].Type, want[i].Status)
+		}
+		if b.Type == faketc.BranchAT && b.LockKey == "" {
+			return fmt.Errorf("fake TC: AT branch %d of %s declared no lock key", b.ID, xid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// faketc runs the in-process fake Seata TC as a standalone server, for
+// samples started with go run that cannot embed it:
+//
+//	go run ./util/faketc/cmd/faketc [-addr 127.0.0.1:8091] [-quiet]
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"seata.apache.org/seata-go-samples/util/faketc"
+)
+
+func main() {
+	addr := flag.String("addr", faketc.DefaultAddr, "listen address")
+	quiet := flag.Bool("quiet", false, "do not log transaction events")
+	flag.Parse()
+
+	cfg := faketc.Config{Addr: *addr, Logf: log.Printf}
+	if *quiet {
+		cfg.Logf = nil
+	}
+	tc, err := faketc.Start(cfg)
+	if err != nil {
+		log.Fatalf("start fake TC: %v", err)
+	}
+	log.Printf("fake TC listening on %s", tc.Addr())
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	for _, g := range tc.Globals() {
+		log.Printf("%s %s %s, %d branches", g.XID, g.Name, g.Status, len(g.Branches))
+	}
+	_ = tc.Close()
+}
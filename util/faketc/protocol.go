@@ -0,0 +1,385 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faketc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Seata RPC protocol v1. Every frame is a 16 byte header, an optional head
+// map and a body:
+//
+//	magic(2) version(1) full length(4) head length(2) message type(1)
+//	codec(1) compressor(1) request id(4) [head map] [body]
+//
+// Only the seata codec without compression is supported, which is what the
+// samples' seatago.yml configure. A body is the int16 type code of the
+// message followed by its fields, big-endian; strings carry an int16 length,
+// lock keys, application data and resource ids an int32 length.
+const (
+	magic0        byte = 0xda
+	magic1        byte = 0xda
+	version       byte = 1
+	headerLength       = 16
+	codecSeata    byte = 1
+	compressNone  byte = 0
+	maxFrameBytes      = 8 << 20
+)
+
+// Message types of the frame header.
+const (
+	frameRequestSync       byte = 0
+	frameResponse          byte = 1
+	frameRequestOneway     byte = 2
+	frameHeartbeatRequest  byte = 3
+	frameHeartbeatResponse byte = 4
+)
+
+// Type codes of the message bodies.
+const (
+	typeGlobalBegin              int16 = 1
+	typeGlobalBeginResult        int16 = 2
+	typeBranchCommit             int16 = 3
+	typeBranchCommitResult       int16 = 4
+	typeBranchRollback           int16 = 5
+	typeBranchRollbackResult     int16 = 6
+	typeGlobalCommit             int16 = 7
+	typeGlobalCommitResult       int16 = 8
+	typeGlobalRollback           int16 = 9
+	typeGlobalRollbackResult     int16 = 10
+	typeBranchRegister           int16 = 11
+	typeBranchRegisterResult     int16 = 12
+	typeBranchStatusReport       int16 = 13
+	typeBranchStatusReportResult int16 = 14
+	typeGlobalStatus             int16 = 15
+	typeGlobalStatusResult       int16 = 16
+	typeGlobalReport             int16 = 17
+	typeGlobalReportResult       int16 = 18
+	typeGlobalLockQuery          int16 = 21
+	typeGlobalLockQueryResult    int16 = 22
+	typeSeataMerge               int16 = 59
+	typeSeataMergeResult         int16 = 60
+	typeRegisterTM               int16 = 101
+	typeRegisterTMResult         int16 = 102
+	typeRegisterRM               int16 = 103
+	typeRegisterRMResult         int16 = 104
+)
+
+// Result codes and the transaction exception codes the coordinator returns.
+const (
+	resultFailed  byte = 0
+	resultSuccess byte = 1
+
+	exceptionUnknown                 byte = 0
+	exceptionLockKeyConflict         byte = 2
+	exceptionBranchAbsent            byte = 9
+	exceptionGlobalTransactionAbsent byte = 10
+	exceptionGlobalNotActive         byte = 11
+)
+
+type frame struct {
+	kind      byte
+	requestID uint32
+	body      []byte
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var header [headerLength]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	if header[0] != magic0 || header[1] != magic1 {
+		return frame{}, fmt.Errorf("bad magic %#x%02x", header[0], header[1])
+	}
+	if header[2] != version {
+		return frame{}, fmt.Errorf("unsupported protocol version %d", header[2])
+	}
+	full := binary.BigEndian.Uint32(header[3:7])
+	head := binary.BigEndian.Uint16(header[7:9])
+	if full < headerLength || full > maxFrameBytes || uint32(head) < headerLength || uint32(head) > full {
+		return frame{}, fmt.Errorf("bad frame length %d/%d", full, head)
+	}
+	rest := make([]byte, full-headerLength)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return frame{}, err
+	}
+	f := frame{kind: header[9], requestID: binary.BigEndian.Uint32(header[12:16]), body: rest[head-headerLength:]}
+	if f.kind == frameHeartbeatRequest || f.kind == frameHeartbeatResponse {
+		// heartbeats carry no body worth reading
+		f.body = nil
+		return f, nil
+	}
+	if header[10] != codecSeata {
+		return frame{}, fmt.Errorf("unsupported codec %d, configure serialization: seata", header[10])
+	}
+	if header[11] != compressNone {
+		return frame{}, fmt.Errorf("unsupported compressor %d, configure compressor: none", header[11])
+	}
+	return f, nil
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, headerLength, headerLength+len(f.body))
+	buf[0], buf[1], buf[2] = magic0, magic1, version
+	binary.BigEndian.PutUint32(buf[3:7], uint32(headerLength+len(f.body)))
+	binary.BigEndian.PutUint16(buf[7:9], headerLength)
+	buf[9], buf[10], buf[11] = f.kind, codecSeata, compressNone
+	binary.BigEndian.PutUint32(buf[12:16], f.requestID)
+	_, err := w.Write(append(buf, f.body...))
+	return err
+}
+
+// encoder writes message fields. Writes to a bytes.Buffer do not fail.
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) u8(v byte) { e.WriteByte(v) }
+
+func (e *encoder) i16(v int16) { _ = binary.Write(e, binary.BigEndian, v) }
+
+func (e *encoder) i32(v int32) { _ = binary.Write(e, binary.BigEndian, v) }
+
+func (e *encoder) i64(v int64) { _ = binary.Write(e, binary.BigEndian, v) }
+
+func (e *encoder) str16(s string) {
+	if len(s) > 1<<15-1 {
+		s = s[:1<<15-1]
+	}
+	e.i16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) str32(s string) {
+	e.i32(int32(len(s)))
+	e.WriteString(s)
+}
+
+// result writes the result code and, for a failure, its message.
+func (e *encoder) result(err *tcError) {
+	if err == nil {
+		e.u8(resultSuccess)
+		return
+	}
+	e.u8(resultFailed)
+	e.str16(err.msg)
+}
+
+// transactionResult is result followed by the transaction exception code.
+func (e *encoder) transactionResult(err *tcError) {
+	e.result(err)
+	if err == nil {
+		e.u8(exceptionUnknown)
+		return
+	}
+	e.u8(err.code)
+}
+
+// decoder reads message fields. The first short read sticks in err and
+// every later read returns zero values.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.b) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) u8() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) i16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) i32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) i64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) str16() string {
+	return string(d.take(int(uint16(d.i16()))))
+}
+
+func (d *decoder) str32() string {
+	return string(d.take(int(d.i32())))
+}
+
+type globalBeginRequest struct {
+	timeout int32
+	name    string
+}
+
+// globalEndRequest is the body of GlobalCommit, GlobalRollback and
+// GlobalStatus.
+type globalEndRequest struct {
+	typeCode  int16
+	xid       string
+	extraData string
+}
+
+type globalReportRequest struct {
+	xid       string
+	extraData string
+	status    GlobalStatus
+}
+
+// branchRegisterRequest is also the body of GlobalLockQuery.
+type branchRegisterRequest struct {
+	typeCode        int16
+	xid             string
+	branchType      BranchType
+	resourceID      string
+	lockKey         string
+	applicationData string
+}
+
+type branchReportRequest struct {
+	xid             string
+	branchID        int64
+	status          BranchStatus
+	resourceID      string
+	applicationData string
+	branchType      BranchType
+}
+
+// registerRequest is the body of RegisterTM and RegisterRM; only RM
+// registrations carry resource ids.
+type registerRequest struct {
+	typeCode       int16
+	version        string
+	applicationID  string
+	txServiceGroup string
+	extraData      string
+	resourceIDs    string
+}
+
+type mergedRequest struct {
+	messages []any
+}
+
+// branchEndResponse is what an RM answers a BranchCommit or BranchRollback
+// with.
+type branchEndResponse struct {
+	typeCode int16
+	failed   bool
+	msg      string
+	xid      string
+	branchID int64
+	status   BranchStatus
+}
+
+var errUnknownType = errors.New("unknown message type")
+
+// decodeMessage reads one type code and the message it announces.
+func decodeMessage(d *decoder) (any, error) {
+	typeCode := d.i16()
+	var msg any
+	switch typeCode {
+	case typeGlobalBegin:
+		msg = globalBeginRequest{timeout: d.i32(), name: d.str16()}
+	case typeGlobalCommit, typeGlobalRollback, typeGlobalStatus:
+		msg = globalEndRequest{typeCode: typeCode, xid: d.str16(), extraData: d.str16()}
+	case typeGlobalReport:
+		msg = globalReportRequest{xid: d.str16(), extraData: d.str16(), status: GlobalStatus(d.u8())}
+	case typeBranchRegister, typeGlobalLockQuery:
+		msg = branchRegisterRequest{typeCode: typeCode, xid: d.str16(), branchType: BranchType(d.u8()),
+			resourceID: d.str16(), lockKey: d.str32(), applicationData: d.str32()}
+	case typeBranchStatusReport:
+		msg = branchReportRequest{xid: d.str16(), branchID: d.i64(), status: BranchStatus(d.u8()),
+			resourceID: d.str16(), applicationData: d.str32(), branchType: BranchType(d.u8())}
+	case typeRegisterTM, typeRegisterRM:
+		r := registerRequest{typeCode: typeCode, version: d.str16(), applicationID: d.str16(),
+			txServiceGroup: d.str16(), extraData: d.str16()}
+		if typeCode == typeRegisterRM {
+			r.resourceIDs = d.str32()
+		}
+		msg = r
+	case typeSeataMerge:
+		// int32 content length, int16 count, then each message with its
+		// type code; newer clients append message ids, which are not needed
+		d.i32()
+		var merged mergedRequest
+		for n := int(d.i16()); n > 0 && d.err == nil; n-- {
+			m, err := decodeMessage(d)
+			if err != nil {
+				return nil, err
+			}
+			merged.messages = append(merged.messages, m)
+		}
+		msg = merged
+	case typeBranchCommitResult, typeBranchRollbackResult:
+		r := branchEndResponse{typeCode: typeCode}
+		if d.u8() == resultFailed {
+			r.failed = true
+			r.msg = d.str16()
+		}
+		d.u8() // exception code
+		r.xid, r.branchID, r.status = d.str16(), d.i64(), BranchStatus(d.u8())
+		msg = r
+	default:
+		return nil, fmt.Errorf("%w %d", errUnknownType, typeCode)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("decode message type %d: %w", typeCode, d.err)
+	}
+	return msg, nil
+}
+
+// encodeBranchEnd builds the BranchCommit or BranchRollback request the
+// coordinator sends an RM in phase two.
+func encodeBranchEnd(typeCode int16, xid string, b *Branch) []byte {
+	var e encoder
+	e.i16(typeCode)
+	e.str16(xid)
+	e.i64(b.ID)
+	e.u8(byte(b.Type))
+	e.str16(b.ResourceID)
+	e.str32(b.ApplicationData)
+	return e.Bytes()
+}
@@ -0,0 +1,228 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package faketc
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The *Body helpers encode messages the way a seata-go client does.
+
+func beginBody(timeout int32, name string) []byte {
+	var e encoder
+	e.i16(typeGlobalBegin)
+	e.i32(timeout)
+	e.str16(name)
+	return e.Bytes()
+}
+
+func endBody(typeCode int16, xid string) []byte {
+	var e encoder
+	e.i16(typeCode)
+	e.str16(xid)
+	e.str16("")
+	return e.Bytes()
+}
+
+func reportBody(xid string, status GlobalStatus) []byte {
+	var e encoder
+	e.i16(typeGlobalReport)
+	e.str16(xid)
+	e.str16("")
+	e.u8(byte(status))
+	return e.Bytes()
+}
+
+func branchRegisterBody(typeCode int16, xid string, branchType BranchType, resourceID, lockKey string) []byte {
+	var e encoder
+	e.i16(typeCode)
+	e.str16(xid)
+	e.u8(byte(branchType))
+	e.str16(resourceID)
+	e.str32(lockKey)
+	e.str32("")
+	return e.Bytes()
+}
+
+func branchReportBody(xid string, branchID int64, status BranchStatus, resourceID string, branchType BranchType) []byte {
+	var e encoder
+	e.i16(typeBranchStatusReport)
+	e.str16(xid)
+	e.i64(branchID)
+	e.u8(byte(status))
+	e.str16(resourceID)
+	e.str32("")
+	e.u8(byte(branchType))
+	return e.Bytes()
+}
+
+func registerBody(typeCode int16, resourceIDs string) []byte {
+	var e encoder
+	e.i16(typeCode)
+	e.str16("1.0.0")
+	e.str16("faketc-test")
+	e.str16("default_tx_group")
+	e.str16("")
+	if typeCode == typeRegisterRM {
+		e.str32(resourceIDs)
+	}
+	return e.Bytes()
+}
+
+func mergeBody(bodies ...[]byte) []byte {
+	var content encoder
+	content.i16(int16(len(bodies)))
+	for _, b := range bodies {
+		content.Write(b)
+	}
+	var e encoder
+	e.i16(typeSeataMerge)
+	e.i32(int32(content.Len()))
+	e.Write(content.Bytes())
+	return e.Bytes()
+}
+
+// branchEndResultBody answers a BranchCommit or BranchRollback; a non-empty
+// failure fails the result.
+func branchEndResultBody(typeCode int16, xid string, branchID int64, status BranchStatus, failure string) []byte {
+	var e encoder
+	e.i16(typeCode)
+	if failure != "" {
+		e.result(&tcError{exceptionUnknown, failure})
+		e.u8(exceptionUnknown)
+	} else {
+		e.transactionResult(nil)
+	}
+	e.str16(xid)
+	e.i64(branchID)
+	e.u8(byte(status))
+	return e.Bytes()
+}
+
+func TestDecodeMessage(t *testing.T) {
+	const xid = "127.0.0.1:8091:42"
+	tests := []struct {
+		name string
+		body []byte
+		want any
+	}{
+		{"GlobalBegin", beginBody(60000, "tx"), globalBeginRequest{timeout: 60000, name: "tx"}},
+		{"GlobalCommit", endBody(typeGlobalCommit, xid), globalEndRequest{typeCode: typeGlobalCommit, xid: xid}},
+		{"GlobalRollback", endBody(typeGlobalRollback, xid), globalEndRequest{typeCode: typeGlobalRollback, xid: xid}},
+		{"GlobalStatus", endBody(typeGlobalStatus, xid), globalEndRequest{typeCode: typeGlobalStatus, xid: xid}},
+		{"GlobalReport", reportBody(xid, GlobalCommitted), globalReportRequest{xid: xid, status: GlobalCommitted}},
+		{
+			"BranchRegister", branchRegisterBody(typeBranchRegister, xid, BranchAT, "db", "order_tbl:1,2"),
+			branchRegisterRequest{typeCode: typeBranchRegister, xid: xid, branchType: BranchAT, resourceID: "db", lockKey: "order_tbl:1,2"},
+		},
+		{
+			"GlobalLockQuery", branchRegisterBody(typeGlobalLockQuery, xid, BranchAT, "db", "order_tbl:1"),
+			branchRegisterRequest{typeCode: typeGlobalLockQuery, xid: xid, branchType: BranchAT, resourceID: "db", lockKey: "order_tbl:1"},
+		},
+		{
+			"BranchStatusReport", branchReportBody(xid, 7, BranchPhaseOneFailed, "db", BranchTCC),
+			branchReportRequest{xid: xid, branchID: 7, status: BranchPhaseOneFailed, resourceID: "db", branchType: BranchTCC},
+		},
+		{
+			"RegisterTM", registerBody(typeRegisterTM, ""),
+			registerRequest{typeCode: typeRegisterTM, version: "1.0.0", applicationID: "faketc-test", txServiceGroup: "default_tx_group"},
+		},
+		{
+			"RegisterRM", registerBody(typeRegisterRM, "db1,db2"),
+			registerRequest{typeCode: typeRegisterRM, version: "1.0.0", applicationID: "faketc-test", txServiceGroup: "default_tx_group", resourceIDs: "db1,db2"},
+		},
+		{
+			"SeataMerge", mergeBody(beginBody(1000, "a"), endBody(typeGlobalStatus, xid)),
+			mergedRequest{messages: []any{globalBeginRequest{timeout: 1000, name: "a"}, globalEndRequest{typeCode: typeGlobalStatus, xid: xid}}},
+		},
+		{
+			"BranchCommitResult", branchEndResultBody(typeBranchCommitResult, xid, 7, BranchPhaseTwoCommitted, ""),
+			branchEndResponse{typeCode: typeBranchCommitResult, xid: xid, branchID: 7, status: BranchPhaseTwoCommitted},
+		},
+		{
+			"BranchRollbackResult", branchEndResultBody(typeBranchRollbackResult, xid, 7, BranchPhaseTwoRollbackFailedRetryable, "boom"),
+			branchEndResponse{typeCode: typeBranchRollbackResult, failed: true, msg: "boom", xid: xid, branchID: 7, status: BranchPhaseTwoRollbackFailedRetryable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeMessage(&decoder{b: tt.body})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decoded %#v, want %#v", got, tt.want)
+			}
+			if _, err := decodeMessage(&decoder{b: tt.body[:len(tt.body)-1]}); err == nil {
+				t.Fatal("decoded a truncated body")
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownMessage(t *testing.T) {
+	var e encoder
+	e.i16(typeGlobalBeginResult)
+	if _, err := decodeMessage(&decoder{b: e.Bytes()}); !errors.Is(err, errUnknownType) {
+		t.Fatalf("got %v, want %v", err, errUnknownType)
+	}
+}
+
+func TestEncodeBranchEnd(t *testing.T) {
+	b := Branch{ID: 7, Type: BranchTCC, ResourceID: "db", ApplicationData: `{"k":"v"}`}
+	d := decoder{b: encodeBranchEnd(typeBranchRollback, "xid", &b)}
+	typeCode, xid, id, branchType, resourceID, data := d.i16(), d.str16(), d.i64(), BranchType(d.u8()), d.str16(), d.str32()
+	if d.err != nil || len(d.b) != 0 {
+		t.Fatalf("bad body: %v, %d bytes left", d.err, len(d.b))
+	}
+	if typeCode != typeBranchRollback || xid != "xid" || id != b.ID || branchType != b.Type || resourceID != b.ResourceID || data != b.ApplicationData {
+		t.Fatalf("decoded %d %s %d %s %s %s", typeCode, xid, id, branchType, resourceID, data)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, f := range []frame{
+		{kind: frameRequestSync, requestID: 1, body: beginBody(1000, "tx")},
+		{kind: frameResponse, requestID: 2, body: []byte{0, 2}},
+		{kind: frameHeartbeatRequest, requestID: 3},
+	} {
+		var buf bytes.Buffer
+		if err := writeFrame(&buf, f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readFrame(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.kind != f.kind || got.requestID != f.requestID || !bytes.Equal(got.body, f.body) {
+			t.Fatalf("read %+v, want %+v", got, f)
+		}
+	}
+}
+
+func TestReadFrameRejectsOtherCodecs(t *testing.T) {
+	var buf bytes.Buffer
+	_ = writeFrame(&buf, frame{kind: frameRequestSync, body: beginBody(1000, "tx")})
+	b := buf.Bytes()
+	b[10] = 2 // protobuf
+	if _, err := readFrame(bytes.NewReader(b)); err == nil {
+		t.Fatal("read a protobuf frame")
+	}
+}
@@ -0,0 +1,773 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package faketc is an in-process stand-in for the Seata transaction
+// coordinator (TC), so samples can run without a Seata Server, e.g. from go
+// test or in CI without network services:
+//
+//	tc, err := faketc.Start(faketc.Config{Addr: faketc.DefaultAddr})
+//	if err != nil {
+//		return err
+//	}
+//	defer tc.Close()
+//	client.InitPath("conf/seatago.yml")
+//
+// It speaks Seata RPC protocol v1 with the seata codec and handles client
+// registration, global begin, commit, rollback, status and report, branch
+// register and report, global lock queries, and drives phase two by sending
+// BranchCommit and BranchRollback to the RM that registered each branch.
+//
+// It keeps everything in memory and is meant for tests. As in Seata, a
+// transaction still open after its timeout is rolled back, and a branch
+// that fails phase two is retried unless it reports the failure as
+// unretryable. Unlike Seata, phase two runs synchronously, including AT
+// commits, and Saga branches only get their status from the engine's
+// reports, as there is no Saga recovery.
+package faketc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultAddr is the address the samples' seatago.yml point at.
+const DefaultAddr = "127.0.0.1:8091"
+
+// Config configures Start. The zero value listens on DefaultAddr.
+type Config struct {
+	// Addr is the listen address; "127.0.0.1:0" picks a free port.
+	Addr string
+	// CallbackTimeout bounds each phase-two call to an RM, 10s by default.
+	CallbackTimeout time.Duration
+	// RetryInterval is the wait before phase two is retried for a branch
+	// that may still succeed, 1s by default.
+	RetryInterval time.Duration
+	// Logf receives one line per transaction event and protocol error.
+	Logf func(format string, args ...any)
+}
+
+// Global is a snapshot of a global transaction.
+type Global struct {
+	XID      string
+	Name     string
+	Timeout  time.Duration
+	Status   GlobalStatus
+	Began    time.Time
+	Branches []Branch
+}
+
+// Branch is a snapshot of a branch transaction.
+type Branch struct {
+	ID              int64
+	Type            BranchType
+	ResourceID      string
+	LockKey         string
+	ApplicationData string
+	Status          BranchStatus
+}
+
+// Server is a running fake TC.
+type Server struct {
+	cfg       Config
+	ln        net.Listener
+	requestID atomic.Uint32
+
+	mu      sync.Mutex
+	closed  bool
+	nextID  int64
+	globals map[string]*global
+	xids    []string
+	// locks maps resource, table and primary key to the xid holding the
+	// row, as AT branches declare them in their lock keys.
+	locks map[string]string
+	conns map[*conn]bool
+	wg    sync.WaitGroup
+}
+
+type global struct {
+	Global
+	// owners are the connections that registered each branch, which
+	// receive its phase-two calls.
+	owners map[int64]*conn
+	locks  []string
+	// timer rolls the transaction back once its timeout elapses.
+	timer *time.Timer
+}
+
+// tcError is a failed result with its transaction exception code.
+type tcError struct {
+	code byte
+	msg  string
+}
+
+// Start listens on cfg.Addr and serves clients until Close.
+func Start(cfg Config) (*Server, error) {
+	if cfg.Addr == "" {
+		cfg.Addr = DefaultAddr
+	}
+	if cfg.CallbackTimeout <= 0 {
+		cfg.CallbackTimeout = 10 * time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = time.Second
+	}
+	ln, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		cfg:     cfg,
+		ln:      ln,
+		nextID:  time.Now().UnixNano() / int64(time.Millisecond),
+		globals: make(map[string]*global),
+		locks:   make(map[string]string),
+		conns:   make(map[*conn]bool),
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr is the address the server listens on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close stops listening, drops every client and waits for in-flight
+// requests to finish.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	err := s.ln.Close()
+	for _, c := range conns {
+		c.nc.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Global returns a snapshot of the transaction xid.
+func (s *Server) Global(xid string) (Global, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.globals[xid]
+	if !ok {
+		return Global{}, false
+	}
+	return g.snapshot(), true
+}
+
+// Globals returns snapshots of every transaction, in begin order.
+func (s *Server) Globals() []Global {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	globals := make([]Global, 0, len(s.xids))
+	for _, xid := range s.xids {
+		globals = append(globals, s.globals[xid].snapshot())
+	}
+	return globals
+}
+
+func (g *global) snapshot() Global {
+	snapshot := g.Global
+	snapshot.Branches = append([]Branch(nil), g.Branches...)
+	return snapshot
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.cfg.Logf != nil {
+		s.cfg.Logf(format, args...)
+	}
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{s: s, nc: nc, pending: make(map[uint32]chan branchEndResponse)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// begin starts a global transaction, which is rolled back if it is still
+// open after its timeout. XIDs follow Seata's "<tc address>:<transaction
+// id>" form.
+func (s *Server) begin(req globalBeginRequest) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	xid := fmt.Sprintf("%s:%d", s.Addr(), s.nextID)
+	g := &global{
+		Global: Global{
+			XID:     xid,
+			Name:    req.name,
+			Timeout: time.Duration(req.timeout) * time.Millisecond,
+			Status:  GlobalBegin,
+			Began:   time.Now(),
+		},
+		owners: make(map[int64]*conn),
+	}
+	if g.Timeout > 0 {
+		g.timer = s.after(g.Timeout, func() { s.expire(xid) })
+	}
+	s.globals[xid] = g
+	s.xids = append(s.xids, xid)
+	s.logf("faketc: begin %s (%s)", xid, req.name)
+	return xid
+}
+
+func (s *Server) registerBranch(c *conn, req branchRegisterRequest) (int64, *tcError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.globals[req.xid]
+	if !ok {
+		return 0, &tcError{exceptionGlobalTransactionAbsent, "global transaction does not exist: " + req.xid}
+	}
+	if g.Status != GlobalBegin {
+		return 0, &tcError{exceptionGlobalNotActive, fmt.Sprintf("global transaction %s is %s", req.xid, g.Status)}
+	}
+	rows := lockRows(req.resourceID, req.lockKey)
+	if holder := s.lockHolder(req.xid, rows); holder != "" {
+		return 0, &tcError{exceptionLockKeyConflict, fmt.Sprintf("lock key %s is held by %s", req.lockKey, holder)}
+	}
+	for _, row := range rows {
+		if s.locks[row] != req.xid {
+			s.locks[row] = req.xid
+			g.locks = append(g.locks, row)
+		}
+	}
+
+	s.nextID++
+	b := Branch{
+		ID:              s.nextID,
+		Type:            req.branchType,
+		ResourceID:      req.resourceID,
+		LockKey:         req.lockKey,
+		ApplicationData: req.applicationData,
+		Status:          BranchRegistered,
+	}
+	g.Branches = append(g.Branches, b)
+	g.owners[b.ID] = c
+	s.logf("faketc: %s registered %s branch %d on %s", req.xid, b.Type, b.ID, b.ResourceID)
+	return b.ID, nil
+}
+
+// lockable answers a global lock query: the rows are free or already held
+// by the asking transaction.
+func (s *Server) lockable(req branchRegisterRequest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lockHolder(req.xid, lockRows(req.resourceID, req.lockKey)) == ""
+}
+
+func (s *Server) lockHolder(xid string, rows []string) string {
+	for _, row := range rows {
+		if holder, ok := s.locks[row]; ok && holder != xid {
+			return holder
+		}
+	}
+	return ""
+}
+
+// lockRows splits an AT lock key, "table:pk1,pk2;table2:pk3", into one key
+// per row.
+func lockRows(resourceID, lockKey string) []string {
+	var rows []string
+	for _, tableKeys := range strings.Split(lockKey, ";") {
+		table, pks, ok := strings.Cut(tableKeys, ":")
+		if !ok {
+			continue
+		}
+		for _, pk := range strings.Split(pks, ",") {
+			if pk != "" {
+				rows = append(rows, resourceID+"^^^"+table+"^^^"+pk)
+			}
+		}
+	}
+	return rows
+}
+
+func (s *Server) reportBranch(req branchReportRequest) *tcError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.globals[req.xid]
+	if !ok {
+		return &tcError{exceptionGlobalTransactionAbsent, "global transaction does not exist: " + req.xid}
+	}
+	for i := range g.Branches {
+		if g.Branches[i].ID == req.branchID {
+			g.Branches[i].Status = req.status
+			if req.applicationData != "" {
+				g.Branches[i].ApplicationData = req.applicationData
+			}
+			return nil
+		}
+	}
+	return &tcError{exceptionBranchAbsent, fmt.Sprintf("branch %d does not exist in %s", req.branchID, req.xid)}
+}
+
+// status returns the status of xid. Like Seata, an unknown transaction is
+// reported as Finished.
+func (s *Server) status(xid string) GlobalStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if g, ok := s.globals[xid]; ok {
+		return g.Status
+	}
+	return GlobalFinished
+}
+
+// report records the status the Saga engine reports for its transaction.
+func (s *Server) report(req globalReportRequest) GlobalStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.globals[req.xid]
+	if !ok {
+		return GlobalFinished
+	}
+	g.Status = req.status
+	if g.Status.Ended() {
+		s.release(g)
+	}
+	s.logf("faketc: %s reported %s", req.xid, g.Status)
+	return g.Status
+}
+
+// phase is one direction of phase two: the request sent to each branch,
+// the branch statuses it ends in, and the statuses the transaction goes
+// through.
+type phase struct {
+	typeCode int16
+	done     BranchStatus
+	final    BranchStatus
+	running  GlobalStatus
+	retrying GlobalStatus
+	ended    GlobalStatus
+	failed   GlobalStatus
+}
+
+var (
+	commitPhase = phase{typeBranchCommit, BranchPhaseTwoCommitted, BranchPhaseTwoCommitFailedFinal,
+		GlobalCommitting, GlobalCommitRetrying, GlobalCommitted, GlobalCommitFailed}
+	rollbackPhase = phase{typeBranchRollback, BranchPhaseTwoRollbacked, BranchPhaseTwoRollbackFailedFinal,
+		GlobalRollbacking, GlobalRollbackRetrying, GlobalRollbacked, GlobalRollbackFailed}
+	timeoutRollbackPhase = phase{typeBranchRollback, BranchPhaseTwoRollbacked, BranchPhaseTwoRollbackFailedFinal,
+		GlobalTimeoutRollbacking, GlobalTimeoutRollbackRetrying, GlobalTimeoutRollbacked, GlobalTimeoutRollbackFailed}
+)
+
+// commit and rollback end a transaction that is still in Begin and return
+// the status phase two leaves it in.
+func (s *Server) commit(xid string) GlobalStatus {
+	return s.end(xid, commitPhase)
+}
+
+func (s *Server) rollback(xid string) GlobalStatus {
+	return s.end(xid, rollbackPhase)
+}
+
+func (s *Server) end(xid string, p phase) GlobalStatus {
+	s.mu.Lock()
+	g, ok := s.globals[xid]
+	if !ok {
+		s.mu.Unlock()
+		return GlobalFinished
+	}
+	if g.Status != GlobalBegin {
+		status := g.Status
+		s.mu.Unlock()
+		return status
+	}
+	g.Status = p.running
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	s.mu.Unlock()
+	return s.phaseTwo(g, p)
+}
+
+// expire rolls back a transaction still in Begin when its timeout
+// elapses. Saga transactions are left to the engine, which compensates
+// them itself.
+func (s *Server) expire(xid string) {
+	s.mu.Lock()
+	g := s.globals[xid]
+	if g.Status != GlobalBegin {
+		s.mu.Unlock()
+		return
+	}
+	for _, b := range g.Branches {
+		if b.Type == BranchSAGA {
+			s.mu.Unlock()
+			return
+		}
+	}
+	g.Status = GlobalTimeoutRollbacking
+	s.mu.Unlock()
+	s.logf("faketc: %s timed out after %s", xid, g.Timeout)
+	s.phaseTwo(g, timeoutRollbackPhase)
+}
+
+// phaseTwo sends p to every branch that has not ended it yet, in reverse
+// registration order for rollbacks. Branches whose phase one failed are
+// skipped and Saga branches are left to the engine. The first branch that
+// does not end as expected stops phase two: if it failed for good the
+// transaction fails, otherwise, like Seata, the remaining branches are
+// retried every RetryInterval and the locks stay held meanwhile.
+func (s *Server) phaseTwo(g *global, p phase) GlobalStatus {
+	s.mu.Lock()
+	branches := append([]Branch(nil), g.Branches...)
+	s.mu.Unlock()
+
+	if p.typeCode == typeBranchRollback {
+		for i, j := 0, len(branches)-1; i < j; i, j = i+1, j-1 {
+			branches[i], branches[j] = branches[j], branches[i]
+		}
+	}
+	status := p.ended
+	for _, b := range branches {
+		if b.Type == BranchSAGA || b.Status == BranchPhaseOneFailed || b.Status == p.done {
+			continue
+		}
+		got, err := s.call(g, p.typeCode, b)
+		s.mu.Lock()
+		for i := range g.Branches {
+			if g.Branches[i].ID == b.ID {
+				g.Branches[i].Status = got
+			}
+		}
+		s.mu.Unlock()
+		if err == nil && got == p.done {
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("branch ended %s", got)
+		}
+		s.logf("faketc: %s %s branch %d on %s: %v", g.XID, p.running, b.ID, b.ResourceID, err)
+		status = p.retrying
+		if got == p.final {
+			status = p.failed
+		}
+		break
+	}
+
+	s.mu.Lock()
+	g.Status = status
+	if status == p.retrying {
+		s.after(s.cfg.RetryInterval, func() { s.phaseTwo(g, p) })
+	} else {
+		s.release(g)
+	}
+	s.mu.Unlock()
+	s.logf("faketc: %s %s", g.XID, status)
+	return status
+}
+
+// after runs f once d elapses unless the server is closed by then; Close
+// waits for f to return. Call it with s.mu held.
+func (s *Server) after(d time.Duration, f func()) *time.Timer {
+	return time.AfterFunc(d, func() {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return
+		}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		defer s.wg.Done()
+		f()
+	})
+}
+
+// call sends one phase-two request to the connection that registered b,
+// or to any RM that registered its resource if that one is gone.
+func (s *Server) call(g *global, typeCode int16, b Branch) (BranchStatus, error) {
+	s.mu.Lock()
+	c := g.owners[b.ID]
+	if c == nil || !s.conns[c] {
+		c = nil
+		for other := range s.conns {
+			if other.serves(b.ResourceID) {
+				c = other
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	if c == nil {
+		return b.Status, fmt.Errorf("no RM connected for resource %s", b.ResourceID)
+	}
+	resp, err := c.call(encodeBranchEnd(typeCode, g.XID, &b), s.cfg.CallbackTimeout)
+	if err != nil {
+		return b.Status, err
+	}
+	if resp.failed {
+		return resp.status, fmt.Errorf("RM failed: %s", resp.msg)
+	}
+	return resp.status, nil
+}
+
+func (s *Server) release(g *global) {
+	for _, row := range g.locks {
+		if s.locks[row] == g.XID {
+			delete(s.locks, row)
+		}
+	}
+	g.locks = nil
+}
+
+// dispatch handles one request and returns the encoded response.
+func (s *Server) dispatch(c *conn, msg any) []byte {
+	var e encoder
+	switch m := msg.(type) {
+	case registerRequest:
+		resultType := typeRegisterTMResult
+		if m.typeCode == typeRegisterRM {
+			resultType = typeRegisterRMResult
+			c.register(m.resourceIDs)
+		}
+		e.i16(resultType)
+		e.result(nil)
+		e.u8(1) // identified
+		e.str16(m.version)
+	case globalBeginRequest:
+		xid := s.begin(m)
+		e.i16(typeGlobalBeginResult)
+		e.transactionResult(nil)
+		e.str16(xid)
+		e.str16("")
+	case globalEndRequest:
+		var status GlobalStatus
+		switch m.typeCode {
+		case typeGlobalCommit:
+			status = s.commit(m.xid)
+		case typeGlobalRollback:
+			status = s.rollback(m.xid)
+		default:
+			status = s.status(m.xid)
+		}
+		e.i16(m.typeCode + 1) // each result type follows its request type
+		e.transactionResult(nil)
+		e.u8(byte(status))
+	case globalReportRequest:
+		status := s.report(m)
+		e.i16(typeGlobalReportResult)
+		e.transactionResult(nil)
+		e.u8(byte(status))
+	case branchRegisterRequest:
+		if m.typeCode == typeGlobalLockQuery {
+			var lockable int16
+			if s.lockable(m) {
+				lockable = 1
+			}
+			e.i16(typeGlobalLockQueryResult)
+			e.transactionResult(nil)
+			e.i16(lockable)
+			break
+		}
+		id, err := s.registerBranch(c, m)
+		e.i16(typeBranchRegisterResult)
+		e.transactionResult(err)
+		e.i64(id)
+	case branchReportRequest:
+		e.i16(typeBranchStatusReportResult)
+		e.transactionResult(s.reportBranch(m))
+	case mergedRequest:
+		var content encoder
+		content.i16(int16(len(m.messages)))
+		for _, sub := range m.messages {
+			content.Write(s.dispatch(c, sub))
+		}
+		e.i16(typeSeataMergeResult)
+		e.i32(int32(content.Len()))
+		e.Write(content.Bytes())
+	default:
+		return nil
+	}
+	return e.Bytes()
+}
+
+// conn is one client connection. Seata clients share a connection between
+// their TM and RM, so requests are handled concurrently: a GlobalCommit
+// waits for the BranchCommit it sends back over the same connection.
+type conn struct {
+	s  *Server
+	nc net.Conn
+
+	wmu sync.Mutex
+
+	mu        sync.Mutex
+	pending   map[uint32]chan branchEndResponse
+	resources map[string]bool
+}
+
+func (c *conn) serve() {
+	defer c.s.wg.Done()
+	defer c.drop()
+	r := bufio.NewReader(c.nc)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				c.s.logf("faketc: %s: %v", c.nc.RemoteAddr(), err)
+			}
+			return
+		}
+		switch f.kind {
+		case frameHeartbeatRequest:
+			if err := c.write(frame{kind: frameHeartbeatResponse, requestID: f.requestID}); err != nil {
+				return
+			}
+		case frameResponse:
+			c.resolve(f)
+		case frameRequestSync, frameRequestOneway:
+			c.s.wg.Add(1)
+			go c.handle(f)
+		}
+	}
+}
+
+func (c *conn) handle(f frame) {
+	defer c.s.wg.Done()
+	msg, err := decodeMessage(&decoder{b: f.body})
+	if err != nil {
+		c.s.logf("faketc: %s: %v", c.nc.RemoteAddr(), err)
+		return
+	}
+	body := c.s.dispatch(c, msg)
+	if f.kind == frameRequestSync && body != nil {
+		if err := c.write(frame{kind: frameResponse, requestID: f.requestID, body: body}); err != nil {
+			c.s.logf("faketc: %s: %v", c.nc.RemoteAddr(), err)
+		}
+	}
+}
+
+func (c *conn) write(f frame) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return writeFrame(c.nc, f)
+}
+
+// call sends a request and waits for the response with the same id.
+func (c *conn) call(body []byte, timeout time.Duration) (branchEndResponse, error) {
+	id := c.s.requestID.Add(1)
+	ch := make(chan branchEndResponse, 1)
+	c.mu.Lock()
+	if c.pending == nil {
+		c.mu.Unlock()
+		return branchEndResponse{}, errors.New("connection closed")
+	}
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(frame{kind: frameRequestSync, requestID: id, body: body}); err != nil {
+		return branchEndResponse{}, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return branchEndResponse{}, errors.New("connection closed")
+		}
+		return resp, nil
+	case <-timer.C:
+		return branchEndResponse{}, fmt.Errorf("no response within %s", timeout)
+	}
+}
+
+func (c *conn) resolve(f frame) {
+	msg, err := decodeMessage(&decoder{b: f.body})
+	if err != nil {
+		c.s.logf("faketc: %s: %v", c.nc.RemoteAddr(), err)
+		return
+	}
+	resp, ok := msg.(branchEndResponse)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	ch := c.pending[f.requestID]
+	c.mu.Unlock()
+	if ch != nil {
+		ch <- resp
+	}
+}
+
+func (c *conn) register(resourceIDs string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resources == nil {
+		c.resources = make(map[string]bool)
+	}
+	for _, id := range strings.Split(resourceIDs, ",") {
+		if id != "" {
+			c.resources[id] = true
+		}
+	}
+}
+
+func (c *conn) serves(resourceID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resources[resourceID]
+}
+
+// drop forgets the connection and fails the calls still waiting on it.
+func (c *conn) drop() {
+	c.nc.Close()
+	c.s.mu.Lock()
+	delete(c.s.conns, c)
+	c.s.mu.Unlock()
+
+	c.mu.Lock()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.pending = nil
+	c.mu.Unlock()
+}
@@ -0,0 +1,464 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package faketc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testResource = "jdbc:mysql://127.0.0.1:3306/seata_client"
+
+// fakeRM is a client connection acting as TM and RM, like a seata-go
+// client: it sends requests and answers the phase-two calls of the server.
+type fakeRM struct {
+	t      *testing.T
+	nc     net.Conn
+	nextID uint32
+
+	mu      sync.Mutex
+	pending map[uint32]chan []byte
+	// answer decides how a branch ends a phase-two call; nil ends it as
+	// asked.
+	answer func(typeCode int16, branchID int64) BranchStatus
+	// calls records the phase-two calls received, in order.
+	calls []phaseTwoCall
+}
+
+type phaseTwoCall struct {
+	typeCode int16
+	branchID int64
+}
+
+func startServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	cfg.Addr = "127.0.0.1:0"
+	cfg.Logf = t.Logf
+	s, err := Start(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// connect dials s and registers as TM and as RM of testResource.
+func connect(t *testing.T, s *Server) *fakeRM {
+	t.Helper()
+	nc, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := &fakeRM{t: t, nc: nc, pending: make(map[uint32]chan []byte)}
+	t.Cleanup(func() { nc.Close() })
+	go rm.serve()
+	for _, typeCode := range []int16{typeRegisterTM, typeRegisterRM} {
+		d := rm.request(registerBody(typeCode, testResource))
+		if got := d.i16(); got != typeCode+1 || d.u8() != resultSuccess {
+			t.Fatalf("register %d: got result type %d", typeCode, got)
+		}
+	}
+	return rm
+}
+
+func (rm *fakeRM) serve() {
+	r := bufio.NewReader(rm.nc)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		switch f.kind {
+		case frameResponse:
+			rm.mu.Lock()
+			ch := rm.pending[f.requestID]
+			delete(rm.pending, f.requestID)
+			rm.mu.Unlock()
+			if ch != nil {
+				ch <- f.body
+			}
+		case frameRequestSync:
+			d := decoder{b: f.body}
+			typeCode, xid, branchID := d.i16(), d.str16(), d.i64()
+			rm.mu.Lock()
+			rm.calls = append(rm.calls, phaseTwoCall{typeCode, branchID})
+			answer := rm.answer
+			rm.mu.Unlock()
+			status := BranchPhaseTwoCommitted
+			if typeCode == typeBranchRollback {
+				status = BranchPhaseTwoRollbacked
+			}
+			if answer != nil {
+				status = answer(typeCode, branchID)
+			}
+			body := branchEndResultBody(typeCode+1, xid, branchID, status, "")
+			_ = writeFrame(rm.nc, frame{kind: frameResponse, requestID: f.requestID, body: body})
+		}
+	}
+}
+
+// request sends body and returns a decoder over the response.
+func (rm *fakeRM) request(body []byte) *decoder {
+	rm.t.Helper()
+	ch := make(chan []byte, 1)
+	rm.mu.Lock()
+	rm.nextID++
+	id := rm.nextID
+	rm.pending[id] = ch
+	err := writeFrame(rm.nc, frame{kind: frameRequestSync, requestID: id, body: body})
+	rm.mu.Unlock()
+	if err != nil {
+		rm.t.Fatal(err)
+	}
+	select {
+	case resp := <-ch:
+		return &decoder{b: resp}
+	case <-time.After(5 * time.Second):
+		rm.t.Fatalf("no response to request type %d", int16(body[0])<<8|int16(body[1]))
+		return nil
+	}
+}
+
+// transactionResult reads a response header of the given type and returns
+// the exception code of a failed result.
+func transactionResult(d *decoder, typeCode int16) (*tcError, error) {
+	if got := d.i16(); got != typeCode {
+		return nil, fmt.Errorf("got result type %d, want %d", got, typeCode)
+	}
+	var failure *tcError
+	if d.u8() == resultFailed {
+		failure = &tcError{msg: d.str16()}
+	}
+	code := d.u8()
+	if failure != nil {
+		failure.code = code
+	}
+	return failure, d.err
+}
+
+func (rm *fakeRM) begin(timeout time.Duration) string {
+	rm.t.Helper()
+	d := rm.request(beginBody(int32(timeout/time.Millisecond), rm.t.Name()))
+	if failure, err := transactionResult(d, typeGlobalBeginResult); err != nil || failure != nil {
+		rm.t.Fatalf("begin: %v %v", err, failure)
+	}
+	return d.str16()
+}
+
+func (rm *fakeRM) register(xid string, branchType BranchType, lockKey string) (int64, *tcError) {
+	rm.t.Helper()
+	d := rm.request(branchRegisterBody(typeBranchRegister, xid, branchType, testResource, lockKey))
+	failure, err := transactionResult(d, typeBranchRegisterResult)
+	if err != nil {
+		rm.t.Fatalf("register branch: %v", err)
+	}
+	return d.i64(), failure
+}
+
+func (rm *fakeRM) mustRegister(xid string, branchType BranchType, lockKey string) int64 {
+	rm.t.Helper()
+	id, failure := rm.register(xid, branchType, lockKey)
+	if failure != nil {
+		rm.t.Fatalf("register branch: %s", failure.msg)
+	}
+	return id
+}
+
+// end sends GlobalCommit, GlobalRollback or GlobalStatus and returns the
+// status of the transaction.
+func (rm *fakeRM) end(typeCode int16, xid string) GlobalStatus {
+	rm.t.Helper()
+	d := rm.request(endBody(typeCode, xid))
+	if failure, err := transactionResult(d, typeCode+1); err != nil || failure != nil {
+		rm.t.Fatalf("end %d: %v %v", typeCode, err, failure)
+	}
+	return GlobalStatus(d.u8())
+}
+
+func (rm *fakeRM) lockable(xid, lockKey string) bool {
+	rm.t.Helper()
+	d := rm.request(branchRegisterBody(typeGlobalLockQuery, xid, BranchAT, testResource, lockKey))
+	if failure, err := transactionResult(d, typeGlobalLockQueryResult); err != nil || failure != nil {
+		rm.t.Fatalf("lock query: %v %v", err, failure)
+	}
+	return d.i16() == 1
+}
+
+func (rm *fakeRM) phaseTwoCalls() []phaseTwoCall {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return append([]phaseTwoCall(nil), rm.calls...)
+}
+
+func (rm *fakeRM) setAnswer(answer func(typeCode int16, branchID int64) BranchStatus) {
+	rm.mu.Lock()
+	rm.answer = answer
+	rm.mu.Unlock()
+}
+
+// expectGlobal waits for xid to reach status and checks its branch
+// statuses in registration order.
+func expectGlobal(t *testing.T, s *Server, xid string, status GlobalStatus, branches ...BranchStatus) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g, ok := s.Global(xid)
+		if !ok {
+			t.Fatalf("no global %s", xid)
+		}
+		if g.Status == status {
+			var got []BranchStatus
+			for _, b := range g.Branches {
+				got = append(got, b.Status)
+			}
+			if !reflect.DeepEqual(got, branches) {
+				t.Fatalf("%s branches are %v, want %v", xid, got, branches)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is %s, want %s", xid, g.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	if got := rm.end(typeGlobalStatus, xid); got != GlobalBegin {
+		t.Fatalf("status is %s, want Begin", got)
+	}
+	at := rm.mustRegister(xid, BranchAT, "order_tbl:1")
+	tcc := rm.mustRegister(xid, BranchTCC, "")
+	if got := rm.end(typeGlobalCommit, xid); got != GlobalCommitted {
+		t.Fatalf("commit ended %s", got)
+	}
+	expectGlobal(t, s, xid, GlobalCommitted, BranchPhaseTwoCommitted, BranchPhaseTwoCommitted)
+	want := []phaseTwoCall{{typeBranchCommit, at}, {typeBranchCommit, tcc}}
+	if got := rm.phaseTwoCalls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+	if got := rm.end(typeGlobalStatus, xid); got != GlobalCommitted {
+		t.Fatalf("status is %s after commit", got)
+	}
+	if got := rm.end(typeGlobalRollback, xid); got != GlobalCommitted {
+		t.Fatalf("rollback after commit ended %s", got)
+	}
+	if _, failure := rm.register(xid, BranchAT, "order_tbl:2"); failure == nil || failure.code != exceptionGlobalNotActive {
+		t.Fatalf("registered a branch after commit: %+v", failure)
+	}
+}
+
+func TestRollbackInReverseOrder(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	var want []phaseTwoCall
+	for i := 0; i < 3; i++ {
+		id := rm.mustRegister(xid, BranchTCC, "")
+		want = append([]phaseTwoCall{{typeBranchRollback, id}}, want...)
+	}
+	if got := rm.end(typeGlobalRollback, xid); got != GlobalRollbacked {
+		t.Fatalf("rollback ended %s", got)
+	}
+	expectGlobal(t, s, xid, GlobalRollbacked, BranchPhaseTwoRollbacked, BranchPhaseTwoRollbacked, BranchPhaseTwoRollbacked)
+	if got := rm.phaseTwoCalls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+}
+
+func TestPhaseOneFailedBranchIsSkipped(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	failed := rm.mustRegister(xid, BranchTCC, "")
+	done := rm.mustRegister(xid, BranchTCC, "")
+	d := rm.request(branchReportBody(xid, failed, BranchPhaseOneFailed, testResource, BranchTCC))
+	if failure, err := transactionResult(d, typeBranchStatusReportResult); err != nil || failure != nil {
+		t.Fatalf("report branch: %v %v", err, failure)
+	}
+	if got := rm.end(typeGlobalRollback, xid); got != GlobalRollbacked {
+		t.Fatalf("rollback ended %s", got)
+	}
+	expectGlobal(t, s, xid, GlobalRollbacked, BranchPhaseOneFailed, BranchPhaseTwoRollbacked)
+	if got, want := rm.phaseTwoCalls(), []phaseTwoCall{{typeBranchRollback, done}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+}
+
+func TestFailedBranchStopsPhaseTwo(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	first := rm.mustRegister(xid, BranchAT, "order_tbl:1")
+	second := rm.mustRegister(xid, BranchAT, "order_tbl:2")
+	rm.mustRegister(xid, BranchAT, "order_tbl:3")
+	rm.setAnswer(func(typeCode int16, branchID int64) BranchStatus {
+		if branchID == second {
+			return BranchPhaseTwoCommitFailedFinal
+		}
+		return BranchPhaseTwoCommitted
+	})
+	if got := rm.end(typeGlobalCommit, xid); got != GlobalCommitFailed {
+		t.Fatalf("commit ended %s", got)
+	}
+	expectGlobal(t, s, xid, GlobalCommitFailed, BranchPhaseTwoCommitted, BranchPhaseTwoCommitFailedFinal, BranchRegistered)
+	want := []phaseTwoCall{{typeBranchCommit, first}, {typeBranchCommit, second}}
+	if got := rm.phaseTwoCalls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+	if !rm.lockable(rm.begin(time.Minute), "order_tbl:1,2,3") {
+		t.Fatal("a failed transaction kept its locks")
+	}
+}
+
+func TestRetryableBranchIsRetried(t *testing.T) {
+	s := startServer(t, Config{RetryInterval: 10 * time.Millisecond})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	first := rm.mustRegister(xid, BranchAT, "order_tbl:1")
+	second := rm.mustRegister(xid, BranchAT, "order_tbl:2")
+	var mu sync.Mutex
+	attempts := 0
+	rm.setAnswer(func(typeCode int16, branchID int64) BranchStatus {
+		mu.Lock()
+		defer mu.Unlock()
+		if branchID == second && attempts < 2 {
+			attempts++
+			return BranchPhaseTwoCommitFailedRetryable
+		}
+		return BranchPhaseTwoCommitted
+	})
+	if got := rm.end(typeGlobalCommit, xid); got != GlobalCommitRetrying {
+		t.Fatalf("commit ended %s", got)
+	}
+	if rm.lockable(rm.begin(time.Minute), "order_tbl:2") {
+		t.Fatal("a retrying transaction released its locks")
+	}
+	expectGlobal(t, s, xid, GlobalCommitted, BranchPhaseTwoCommitted, BranchPhaseTwoCommitted)
+	want := []phaseTwoCall{{typeBranchCommit, first}, {typeBranchCommit, second}, {typeBranchCommit, second}, {typeBranchCommit, second}}
+	if got := rm.phaseTwoCalls(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+}
+
+func TestTimeoutRollsBack(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(50 * time.Millisecond)
+	id := rm.mustRegister(xid, BranchTCC, "")
+	expectGlobal(t, s, xid, GlobalTimeoutRollbacked, BranchPhaseTwoRollbacked)
+	if got, want := rm.phaseTwoCalls(), []phaseTwoCall{{typeBranchRollback, id}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("phase two calls %v, want %v", got, want)
+	}
+	if got := rm.end(typeGlobalCommit, xid); got != GlobalTimeoutRollbacked {
+		t.Fatalf("commit after the timeout ended %s", got)
+	}
+	if _, failure := rm.register(xid, BranchTCC, ""); failure == nil || failure.code != exceptionGlobalNotActive {
+		t.Fatalf("registered a branch after the timeout: %+v", failure)
+	}
+}
+
+func TestLocks(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	holder := rm.begin(time.Minute)
+	rm.mustRegister(holder, BranchAT, "order_tbl:1,2;account_tbl:9")
+	other := rm.begin(time.Minute)
+	if rm.lockable(other, "order_tbl:2") {
+		t.Fatal("a held row is lockable")
+	}
+	if !rm.lockable(holder, "order_tbl:2") || !rm.lockable(other, "order_tbl:3") {
+		t.Fatal("a row is not lockable by its holder or while free")
+	}
+	if _, failure := rm.register(other, BranchAT, "account_tbl:9"); failure == nil || failure.code != exceptionLockKeyConflict {
+		t.Fatalf("registered a held row: %+v", failure)
+	}
+	rm.end(typeGlobalRollback, holder)
+	rm.mustRegister(other, BranchAT, "account_tbl:9")
+}
+
+func TestSagaReport(t *testing.T) {
+	s := startServer(t, Config{})
+	rm := connect(t, s)
+
+	xid := rm.begin(time.Minute)
+	id := rm.mustRegister(xid, BranchSAGA, "")
+	d := rm.request(mergeBody(
+		branchReportBody(xid, id, BranchPhaseOneDone, testResource, BranchSAGA),
+		reportBody(xid, GlobalCommitted),
+	))
+	if got := d.i16(); got != typeSeataMergeResult {
+		t.Fatalf("got result type %d", got)
+	}
+	d.i32()
+	if n := d.i16(); n != 2 {
+		t.Fatalf("got %d merged results", n)
+	}
+	if failure, err := transactionResult(d, typeBranchStatusReportResult); err != nil || failure != nil {
+		t.Fatalf("report branch: %v %v", err, failure)
+	}
+	if failure, err := transactionResult(d, typeGlobalReportResult); err != nil || failure != nil {
+		t.Fatalf("report global: %v %v", err, failure)
+	}
+	if got := GlobalStatus(d.u8()); got != GlobalCommitted {
+		t.Fatalf("report answered %s", got)
+	}
+	expectGlobal(t, s, xid, GlobalCommitted, BranchPhaseOneDone)
+	if calls := rm.phaseTwoCalls(); len(calls) != 0 {
+		t.Fatalf("Saga branch got phase two calls %v", calls)
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	s, err := Start(Config{Addr: "127.0.0.1:0", RetryInterval: 10 * time.Millisecond, Logf: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm := connect(t, s)
+	xid := rm.begin(time.Minute)
+	rm.mustRegister(xid, BranchTCC, "")
+	rm.setAnswer(func(int16, int64) BranchStatus { return BranchPhaseTwoRollbackFailedRetryable })
+	if got := rm.end(typeGlobalRollback, xid); got != GlobalRollbackRetrying {
+		t.Fatalf("rollback ended %s", got)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Close() }()
+	select {
+	case err := <-done:
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return while a branch was being retried")
+	}
+}
@@ -0,0 +1,120 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package faketc
+
+import "fmt"
+
+// GlobalStatus is the status of a global transaction, with the codes Seata
+// uses on the wire.
+type GlobalStatus byte
+
+const (
+	GlobalUnknown                 GlobalStatus = 0
+	GlobalBegin                   GlobalStatus = 1
+	GlobalCommitting              GlobalStatus = 2
+	GlobalCommitRetrying          GlobalStatus = 3
+	GlobalRollbacking             GlobalStatus = 4
+	GlobalRollbackRetrying        GlobalStatus = 5
+	GlobalTimeoutRollbacking      GlobalStatus = 6
+	GlobalTimeoutRollbackRetrying GlobalStatus = 7
+	GlobalAsyncCommitting         GlobalStatus = 8
+	GlobalCommitted               GlobalStatus = 9
+	GlobalCommitFailed            GlobalStatus = 10
+	GlobalRollbacked              GlobalStatus = 11
+	GlobalRollbackFailed          GlobalStatus = 12
+	GlobalTimeoutRollbacked       GlobalStatus = 13
+	GlobalTimeoutRollbackFailed   GlobalStatus = 14
+	GlobalFinished                GlobalStatus = 15
+)
+
+var globalStatusNames = []string{
+	"UnKnown", "Begin", "Committing", "CommitRetrying", "Rollbacking", "RollbackRetrying",
+	"TimeoutRollbacking", "TimeoutRollbackRetrying", "AsyncCommitting", "Committed", "CommitFailed",
+	"Rollbacked", "RollbackFailed", "TimeoutRollbacked", "TimeoutRollbackFailed", "Finished",
+}
+
+func (s GlobalStatus) String() string {
+	if int(s) < len(globalStatusNames) {
+		return globalStatusNames[s]
+	}
+	return fmt.Sprintf("GlobalStatus(%d)", byte(s))
+}
+
+// Ended reports whether the transaction reached a final status.
+func (s GlobalStatus) Ended() bool {
+	switch s {
+	case GlobalCommitted, GlobalCommitFailed, GlobalRollbacked, GlobalRollbackFailed,
+		GlobalTimeoutRollbacked, GlobalTimeoutRollbackFailed, GlobalFinished:
+		return true
+	}
+	return false
+}
+
+// BranchStatus is the status of a branch transaction.
+type BranchStatus byte
+
+const (
+	BranchUnknown                         BranchStatus = 0
+	BranchRegistered                      BranchStatus = 1
+	BranchPhaseOneDone                    BranchStatus = 2
+	BranchPhaseOneFailed                  BranchStatus = 3
+	BranchPhaseOneTimeout                 BranchStatus = 4
+	BranchPhaseTwoCommitted               BranchStatus = 5
+	BranchPhaseTwoCommitFailedRetryable   BranchStatus = 6
+	BranchPhaseTwoCommitFailedFinal       BranchStatus = 7
+	BranchPhaseTwoRollbacked              BranchStatus = 8
+	BranchPhaseTwoRollbackFailedRetryable BranchStatus = 9
+	BranchPhaseTwoRollbackFailedFinal     BranchStatus = 10
+)
+
+var branchStatusNames = []string{
+	"Unknown", "Registered", "PhaseOne_Done", "PhaseOne_Failed", "PhaseOne_Timeout",
+	"PhaseTwo_Committed", "PhaseTwo_CommitFailed_Retryable", "PhaseTwo_CommitFailed_Unretryable",
+	"PhaseTwo_Rollbacked", "PhaseTwo_RollbackFailed_Retryable", "PhaseTwo_RollbackFailed_Unretryable",
+}
+
+func (s BranchStatus) String() string {
+	if int(s) < len(branchStatusNames) {
+		return branchStatusNames[s]
+	}
+	return fmt.Sprintf("BranchStatus(%d)", byte(s))
+}
+
+// BranchType is the transaction mode of a branch.
+type BranchType byte
+
+const (
+	BranchAT   BranchType = 0
+	BranchTCC  BranchType = 1
+	BranchSAGA BranchType = 2
+	BranchXA   BranchType = 3
+)
+
+func (t BranchType) String() string {
+	switch t {
+	case BranchAT:
+		return "AT"
+	case BranchTCC:
+		return "TCC"
+	case BranchSAGA:
+		return "SAGA"
+	case BranchXA:
+		return "XA"
+	}
+	return fmt.Sprintf("BranchType(%d)", byte(t))
+}
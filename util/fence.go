@@ -0,0 +1,51 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"seata.apache.org/seata-go/pkg/rm/tcc/fence/enum"
+)
+
+// FenceLogTable is tcc.fence.log-table-name in conf/seatago.yml.
+const FenceLogTable = "tcc_fence_log_test"
+
+// WaitFenceStatus waits for the fence record of the only branch of xid to
+// reach want, which the TC drives asynchronously.
+func WaitFenceStatus(db *sql.DB, xid string, want enum.FenceStatus, timeout time.Duration) error {
+	if xid == "" {
+		return errors.New("the global transaction did not begin")
+	}
+	deadline := time.Now().Add(timeout)
+	var status enum.FenceStatus
+	for time.Now().Before(deadline) {
+		err := db.QueryRow("SELECT status FROM "+FenceLogTable+" WHERE xid = ?", xid).Scan(&status)
+		if err == nil && status == want {
+			return nil
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return fmt.Errorf("fence log of %s has status %d after %s, want %d", xid, status, timeout, want)
+}
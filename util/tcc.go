@@ -0,0 +1,123 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"seata.apache.org/seata-go/pkg/rm/tcc/fence"
+)
+
+// FencedPhase is the business part of one TCC phase. It runs inside tx,
+// after the fence check of the phase, and param is the Prepare argument,
+// which the second phase gets back from the action context.
+type FencedPhase[P any] func(ctx context.Context, tx *sql.Tx, param P) error
+
+// FencedTCCAction is a TCC action whose phases each run in one local
+// transaction on db, together with their tcc_fence_log record, so that
+// duplicate commits, empty rollbacks and suspended prepares are stopped by
+// the fence. P is the type of the Prepare argument; it is carried to Commit
+// and Rollback by TypedTCC.
+type FencedTCCAction[P any] struct {
+	name     string
+	db       *sql.DB
+	prepare  FencedPhase[P]
+	commit   FencedPhase[P]
+	rollback FencedPhase[P]
+
+	tccOnce sync.Once
+	tcc     *TypedTCC[P]
+	tccErr  error
+}
+
+// NewFencedTCCAction returns the action name running the given phases on
+// db, which is shared by all calls and owned by the caller.
+func NewFencedTCCAction[P any](name string, db *sql.DB, prepare FencedPhase[P],
+	commit FencedPhase[P], rollback FencedPhase[P]) *FencedTCCAction[P] {
+	return &FencedTCCAction[P]{
+		name:     name,
+		db:       db,
+		prepare:  prepare,
+		commit:   commit,
+		rollback: rollback,
+	}
+}
+
+// TCC returns the TypedTCC proxy of a, creating it on the first call.
+func (a *FencedTCCAction[P]) TCC() (*TypedTCC[P], error) {
+	a.tccOnce.Do(func() {
+		a.tcc, a.tccErr = NewTypedTCC[P](a)
+	})
+	return a.tcc, a.tccErr
+}
+
+func (a *FencedTCCAction[P]) Prepare(ctx context.Context, param P) error {
+	return withFence(ctx, a.db, func(tx *sql.Tx) error {
+		return a.prepare(ctx, tx, param)
+	})
+}
+
+func (a *FencedTCCAction[P]) Commit(ctx context.Context, param P) error {
+	return withFence(ctx, a.db, func(tx *sql.Tx) error {
+		return a.commit(ctx, tx, param)
+	})
+}
+
+func (a *FencedTCCAction[P]) Rollback(ctx context.Context, param P) error {
+	return withFence(ctx, a.db, func(tx *sql.Tx) error {
+		return a.rollback(ctx, tx, param)
+	})
+}
+
+func (a *FencedTCCAction[P]) GetActionName() string {
+	return a.name
+}
+
+// withFence runs phase and the fence check of the current phase in one
+// local transaction, committing both or neither.
+func withFence(ctx context.Context, db *sql.DB, phase func(tx *sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("transaction begin failed, msg :%w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("business method throw error: %w, rollback result: %v", err, tx.Rollback())
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	return fence.WithFence(ctx, tx, func() error {
+		return phase(tx)
+	})
+}
+
+// GormTx returns db bound to ctx and running its statements on tx, for
+// phases written with gorm.
+func GormTx(ctx context.Context, db *gorm.DB, tx *sql.Tx) *gorm.DB {
+	session := db.WithContext(ctx)
+	session.Statement.ConnPool = tx
+	return session
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one or more
+ * contributor license agreements.  See the NOTICE file distributed with
+ * this work for additional information regarding copyright ownership.
+ * The ASF licenses this file to You under the Apache License, Version 2.0
+ * (the "License"); you may not use this file except in compliance with
+ * the License.  You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"seata.apache.org/seata-go/pkg/rm/tcc"
+	"seata.apache.org/seata-go/pkg/tm"
+)
+
+// TCCPayloadKey is the action context key under which TypedTCC carries the
+// JSON encoded Prepare argument to the second phase.
+const TCCPayloadKey = "tccPayload"
+
+// TypedTCCService is a TCC action with a typed argument. Commit and Rollback
+// receive the argument Prepare was called with, decoded from the action
+// context, so they act on exactly the resources Prepare touched. The action
+// context itself is still available through tm.GetBusinessActionContext.
+type TypedTCCService[P any] interface {
+	GetActionName() string
+	Prepare(ctx context.Context, param P) error
+	Commit(ctx context.Context, param P) error
+	Rollback(ctx context.Context, param P) error
+}
+
+// TypedTCC wraps the tcc.TCCServiceProxy of a TypedTCCService. Prepare
+// serializes its argument into the BusinessActionContext of the branch, and
+// the second phase decodes it back.
+type TypedTCC[P any] struct {
+	name  string
+	proxy *tcc.TCCServiceProxy
+}
+
+// NewTypedTCC creates the proxy of service. Like tcc.NewTCCServiceProxy, it
+// registers the action by name, so call it once per action and process.
+func NewTypedTCC[P any](service TypedTCCService[P]) (*TypedTCC[P], error) {
+	proxy, err := tcc.NewTCCServiceProxy(&typedAction[P]{service: service})
+	if err != nil {
+		return nil, fmt.Errorf("get %s tcc service proxy error, %w", service.GetActionName(), err)
+	}
+	return &TypedTCC[P]{name: service.GetActionName(), proxy: proxy}, nil
+}
+
+// Prepare runs the first phase of the action as a branch of the global
+// transaction in ctx.
+func (t *TypedTCC[P]) Prepare(ctx context.Context, param P) error {
+	payload, err := json.Marshal(param)
+	if err != nil {
+		return fmt.Errorf("encode %s prepare param: %w", t.name, err)
+	}
+	ok, err := t.proxy.Prepare(ctx, typedParam{Payload: string(payload)})
+	if err != nil {
+		return err
+	}
+	if ok, _ := ok.(bool); !ok {
+		return fmt.Errorf("%s prepare returned false", t.name)
+	}
+	return nil
+}
+
+// Proxy returns the underlying proxy.
+func (t *TypedTCC[P]) Proxy() *tcc.TCCServiceProxy {
+	return t.proxy
+}
+
+// typedParam is what the proxy sees as the Prepare argument; the tccParam
+// tag copies the payload into the action context.
+type typedParam struct {
+	Payload string `tccParam:"tccPayload"`
+}
+
+// typedAction adapts a TypedTCCService to the interface{} based TCC
+// interface the proxy calls.
+type typedAction[P any] struct {
+	service TypedTCCService[P]
+}
+
+func (a *typedAction[P]) Prepare(ctx context.Context, params interface{}) (bool, error) {
+	param, ok := params.(typedParam)
+	if !ok {
+		return false, fmt.Errorf("%s prepare param has type %T, call it through TypedTCC", a.service.GetActionName(), params)
+	}
+	p, err := decodePayload[P](a.service.GetActionName(), param.Payload)
+	if err != nil {
+		return false, err
+	}
+	err = a.service.Prepare(ctx, p)
+	return err == nil, err
+}
+
+func (a *typedAction[P]) Commit(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
+	p, err := actionPayload[P](a.service.GetActionName(), businessActionContext)
+	if err != nil {
+		return false, err
+	}
+	err = a.service.Commit(ctx, p)
+	return err == nil, err
+}
+
+func (a *typedAction[P]) Rollback(ctx context.Context, businessActionContext *tm.BusinessActionContext) (bool, error) {
+	p, err := actionPayload[P](a.service.GetActionName(), businessActionContext)
+	if err != nil {
+		return false, err
+	}
+	err = a.service.Rollback(ctx, p)
+	return err == nil, err
+}
+
+func (a *typedAction[P]) GetActionName() string {
+	return a.service.GetActionName()
+}
+
+func actionPayload[P any](name string, businessActionContext *tm.BusinessActionContext) (P, error) {
+	var p P
+	if businessActionContext == nil {
+		return p, fmt.Errorf("%s: missing business action context", name)
+	}
+	payload, ok := businessActionContext.ActionContext[TCCPayloadKey].(string)
+	if !ok {
+		return p, fmt.Errorf("%s: action context of %s/%d carries no %s", name,
+			businessActionContext.Xid, businessActionContext.BranchId, TCCPayloadKey)
+	}
+	return decodePayload[P](name, payload)
+}
+
+func decodePayload[P any](name string, payload string) (P, error) {
+	var p P
+	if err := json.Unmarshal([]byte(payload), &p); err != nil {
+		return p, fmt.Errorf("decode %s param: %w", name, err)
+	}
+	return p, nil
+}